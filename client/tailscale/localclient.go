@@ -350,6 +350,33 @@ func (lc *LocalClient) DebugAction(ctx context.Context, action string) error {
 	return nil
 }
 
+// DebugSSHPolicy returns the SSH access policy that Tailscale SSH enforces:
+// the tailnet's policy merged with the local SSH policy file, if any.
+// It returns nil if there's no policy.
+func (lc *LocalClient) DebugSSHPolicy(ctx context.Context) (*tailcfg.SSHPolicy, error) {
+	body, err := lc.send(ctx, "GET", "/localapi/v0/debug-ssh-policy", 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: %s", err, body)
+	}
+	return decodeJSON[*tailcfg.SSHPolicy](body)
+}
+
+// SSHSessions returns the active Tailscale SSH sessions on this node.
+func (lc *LocalClient) SSHSessions(ctx context.Context) ([]*ipnstate.SSHSession, error) {
+	body, err := lc.get200(ctx, "/localapi/v0/ssh-sessions")
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON[[]*ipnstate.SSHSession](body)
+}
+
+// KillSSHSession terminates the Tailscale SSH session with the given ID, or
+// all the sessions on the connection if id is a connection ID.
+func (lc *LocalClient) KillSSHSession(ctx context.Context, id string) error {
+	_, err := lc.send(ctx, "POST", "/localapi/v0/ssh-kill-session?id="+url.QueryEscape(id), 200, nil)
+	return err
+}
+
 // SetDevStoreKeyValue set a statestore key/value. It's only meant for development.
 // The schema (including when keys are re-read) is not a stable interface.
 func (lc *LocalClient) SetDevStoreKeyValue(ctx context.Context, key, value string) error {
@@ -895,6 +922,16 @@ func (lc *LocalClient) GetServeConfig(ctx context.Context) (*ipn.ServeConfig, er
 	return getServeConfigFromJSON(body)
 }
 
+// ServeBackendStatus returns the status of the backends of load balanced
+// serve handlers.
+func (lc *LocalClient) ServeBackendStatus(ctx context.Context) ([]ipn.ServeBackendStatus, error) {
+	body, err := lc.send(ctx, "GET", "/localapi/v0/serve-backends", 200, nil)
+	if err != nil {
+		return nil, fmt.Errorf("getting serve backend status: %w", err)
+	}
+	return decodeJSON[[]ipn.ServeBackendStatus](body)
+}
+
 func getServeConfigFromJSON(body []byte) (sc *ipn.ServeConfig, err error) {
 	if err := json.Unmarshal(body, &sc); err != nil {
 		return nil, err
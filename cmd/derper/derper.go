@@ -50,12 +50,24 @@
 
 	meshPSKFile    = flag.String("mesh-psk-file", defaultMeshPSKFile(), "if non-empty, path to file containing the mesh pre-shared key file. It should contain some hex string; whitespace is trimmed.")
 	meshWith       = flag.String("mesh-with", "", "optional comma-separated list of hostnames to mesh with; the server's own hostname can be in the list")
+	meshConfig     = flag.String("mesh-config", "", "optional path to a JSON tailcfg.DERPMap; the server meshes with the other nodes in the region of the node whose HostName is --hostname, and re-reads the file on SIGHUP")
 	bootstrapDNS   = flag.String("bootstrap-dns-names", "", "optional comma-separated list of hostnames to make available at /bootstrap-dns")
 	unpublishedDNS = flag.String("unpublished-bootstrap-dns-names", "", "optional comma-separated list of hostnames to make available at /bootstrap-dns and not publish in the list")
 	verifyClients  = flag.Bool("verify-clients", false, "verify clients to this DERP server through a local tailscaled instance.")
 
+	verifyClientAllowlist   = flag.String("verify-client-allowlist", "", "if non-empty, path to a file of node keys, one per line, of the only clients to accept. It's re-read when it changes.")
+	verifyClientURL         = flag.String("verify-client-url", "", "if non-empty, an admission controller URL to POST each client's key and IP to (as JSON tailcfg.DERPAdmitClientRequest) to decide whether to accept it")
+	verifyClientURLFailOpen = flag.Bool("verify-client-url-fail-open", false, "whether to accept clients when the --verify-client-url admission controller is unavailable, rather than rejecting them")
+
+	drainTimeout = flag.Duration("drain-timeout", 0, "if non-zero, how long to drain clients to other servers on SIGTERM before exiting; zero means SIGTERM exits immediately. A POST to /debug/drain always drains, for this long or else for 30s. Clients reconnecting during the drain only move to another server if a load balancer sends them there; otherwise they reconnect here and are disconnected when the drain ends.")
+
 	acceptConnLimit = flag.Float64("accept-connection-limit", math.Inf(+1), "rate limit for accepting new connection")
 	acceptConnBurst = flag.Int("accept-connection-burst", math.MaxInt, "burst limit for accepting new connection")
+
+	perClientRateLimit = flag.Int("per-client-rate-limit", 0, "if non-zero, rate limit in bytes per second for packets sent by each client key; excess packets are dropped")
+	perClientRateBurst = flag.Int("per-client-rate-burst", 0, "burst limit in bytes for --per-client-rate-limit; if zero, one second's worth")
+	perIPRateLimit     = flag.Int("per-ip-rate-limit", 0, "if non-zero, rate limit in bytes per second for packets sent by all clients from each source IP; excess packets are dropped")
+	perIPRateBurst     = flag.Int("per-ip-rate-burst", 0, "burst limit in bytes for --per-ip-rate-limit; if zero, one second's worth")
 )
 
 var (
@@ -152,6 +164,15 @@ func main() {
 
 	s := derp.NewServer(cfg.PrivateKey, log.Printf)
 	s.SetVerifyClient(*verifyClients)
+	verifier, err := newClientVerifier()
+	if err != nil {
+		log.Fatalf("derper: %v", err)
+	}
+	if verifier != nil {
+		s.SetVerifier(verifier)
+	}
+	s.SetPerClientRateLimit(*perClientRateLimit, *perClientRateBurst)
+	s.SetPerIPRateLimit(*perIPRateLimit, *perIPRateBurst)
 
 	if *meshPSKFile != "" {
 		b, err := os.ReadFile(*meshPSKFile)
@@ -218,6 +239,11 @@ func main() {
 		}
 	}))
 	debug.Handle("traffic", "Traffic check", http.HandlerFunc(s.ServeDebugTraffic))
+	debug.Handle("drain", "Drain clients to other servers (via a load balancer) and exit", serveDrain(s))
+	if curMesh != nil {
+		debug.Handle("mesh", "Mesh peers", curMesh)
+	}
+	drainOnSIGTERM(s)
 
 	if *runSTUN {
 		go serveSTUN(listenHost, *stunPort)
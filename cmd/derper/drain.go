@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"tailscale.com/derp"
+)
+
+// drainTryFor is how long draining tells clients to keep trying to
+// reconnect before falling back to their usual connection failure logic.
+const drainTryFor = 5 * time.Second
+
+// defaultDrainTimeout is how long a drain requested with /debug/drain
+// takes when --drain-timeout isn't set.
+const defaultDrainTimeout = 30 * time.Second
+
+var drainOnce sync.Once
+
+// drainAndExit drains s for maintenance and then exits the process.
+//
+// Clients are told to reconnect at random times over the first half of
+// --drain-timeout (or defaultDrainTimeout, if unset), which gives a load
+// balancer time to send them to another derper. Without one, they
+// reconnect to this server, which keeps accepting them. Whichever clients
+// are still connected at the end are disconnected.
+func drainAndExit(s *derp.Server, why string) {
+	drainOnce.Do(func() {
+		timeout := *drainTimeout
+		if timeout <= 0 {
+			timeout = defaultDrainTimeout
+		}
+		log.Printf("derper: draining (%s) for up to %v", why, timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := s.Drain(ctx, timeout/2, drainTryFor); err != nil {
+			log.Printf("derper: drain: %v; exiting anyway", err)
+		} else {
+			log.Printf("derper: drained; exiting")
+		}
+		s.Close()
+		os.Exit(0)
+	})
+}
+
+// drainOnSIGTERM drains s and exits on SIGTERM, if --drain-timeout is
+// non-zero. A second SIGTERM exits immediately.
+func drainOnSIGTERM(s *derp.Server) {
+	if *drainTimeout <= 0 {
+		return
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		go drainAndExit(s, "SIGTERM")
+		<-sigc
+		log.Fatalf("derper: second SIGTERM while draining; exiting")
+	}()
+}
+
+// serveDrain is the debug handler that starts draining s.
+func serveDrain(s *derp.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, "POST to this URL to drain clients from this server and exit.\nClients only move to another server if a load balancer sends their reconnects there.\n")
+			return
+		}
+		go drainAndExit(s, "requested by "+r.RemoteAddr)
+		io.WriteString(w, "draining\n")
+	})
+}
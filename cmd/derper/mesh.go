@@ -6,42 +6,307 @@
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"html"
+	"io"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"golang.org/x/exp/slices"
 	"tailscale.com/derp"
 	"tailscale.com/derp/derphttp"
+	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/strs"
 )
 
+// meshPingInterval is how often each mesh peer is pinged to check the
+// health of the connection to it.
+const meshPingInterval = 15 * time.Second
+
+// mesh is the set of derpers that this one meshes with.
+type mesh struct {
+	s *derp.Server
+
+	mu    sync.Mutex
+	peers map[string]*meshPeer // by name
+}
+
+var curMesh *mesh // or nil if not meshing
+
 func startMesh(s *derp.Server) error {
-	if *meshWith == "" {
+	if *meshWith == "" && *meshConfig == "" {
 		return nil
 	}
 	if !s.HasMeshKey() {
-		return errors.New("--mesh-with requires --mesh-psk-file")
+		return errors.New("--mesh-with and --mesh-config require --mesh-psk-file")
 	}
-	for _, host := range strings.Split(*meshWith, ",") {
-		if err := startMeshWithHost(s, host); err != nil {
+	if *meshWith != "" && *meshConfig != "" {
+		return errors.New("--mesh-with and --mesh-config are mutually exclusive")
+	}
+	m := &mesh{s: s, peers: map[string]*meshPeer{}}
+	if *meshConfig != "" {
+		if err := m.loadConfig(*meshConfig, *hostname); err != nil {
 			return err
 		}
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGHUP)
+		go func() {
+			for range sigc {
+				log.Printf("derper: SIGHUP; reloading %s", *meshConfig)
+				if err := m.loadConfig(*meshConfig, *hostname); err != nil {
+					log.Printf("derper: reloading mesh config: %v; keeping previous mesh", err)
+				}
+			}
+		}()
+	} else {
+		for _, host := range strings.Split(*meshWith, ",") {
+			p, err := startMeshWithHost(s, host)
+			if err != nil {
+				return err
+			}
+			m.peers[host] = p
+		}
 	}
+	curMesh = m
 	return nil
 }
 
-func startMeshWithHost(s *derp.Server, host string) error {
-	logf := logger.WithPrefix(log.Printf, fmt.Sprintf("mesh(%q): ", host))
-	c, err := derphttp.NewClient(s.PrivateKey(), "https://"+host+"/derp", logf)
+// loadConfig reads the tailcfg.DERPMap in the JSON file at path and
+// meshes with the other nodes in the region of the node named by
+// hostname, starting and stopping peers to match.
+func (m *mesh) loadConfig(path, hostname string) error {
+	b, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
+	nodes, err := meshNodesFromConfig(b, hostname)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	want := map[string]*tailcfg.DERPNode{}
+	for _, n := range nodes {
+		want[n.Name] = n
+	}
+	for name, p := range m.peers {
+		if n, ok := want[name]; !ok || *n != *p.node {
+			log.Printf("mesh: removing peer %s", name)
+			p.stop()
+			delete(m.peers, name)
+		}
+	}
+	for name, n := range want {
+		if _, ok := m.peers[name]; ok {
+			continue
+		}
+		log.Printf("mesh: adding peer %s (%s)", name, n.HostName)
+		m.peers[name] = startMeshWithNode(m.s, n)
+	}
+	return nil
+}
+
+// meshNodesFromConfig parses the JSON tailcfg.DERPMap b and returns the
+// nodes to mesh with: the DERP nodes in the same region as the node whose
+// HostName is hostname, other than that node itself.
+func meshNodesFromConfig(b []byte, hostname string) ([]*tailcfg.DERPNode, error) {
+	var dm tailcfg.DERPMap
+	if err := json.Unmarshal(b, &dm); err != nil {
+		return nil, err
+	}
+	for _, r := range dm.Regions {
+		if r == nil {
+			continue
+		}
+		i := slices.IndexFunc(r.Nodes, func(n *tailcfg.DERPNode) bool {
+			return n != nil && n.HostName == hostname
+		})
+		if i == -1 {
+			continue
+		}
+		var nodes []*tailcfg.DERPNode
+		for _, n := range r.Nodes {
+			if n == nil || n.HostName == hostname || n.STUNOnly {
+				continue
+			}
+			if n.Name == "" || n.HostName == "" {
+				return nil, fmt.Errorf("region %d has a node without a Name or HostName", r.RegionID)
+			}
+			nodes = append(nodes, n)
+		}
+		return nodes, nil
+	}
+	return nil, fmt.Errorf("no node with HostName %q", hostname)
+}
+
+// meshPeer is a derper that this one meshes with, and the state of the
+// connection to it.
+type meshPeer struct {
+	name   string
+	node   *tailcfg.DERPNode // from --mesh-config, or nil for --mesh-with
+	s      *derp.Server
+	c      *derphttp.Client
+	cancel context.CancelFunc
+
+	packetsForwarded expvar.Int // to the peer
+	forwardErrors    expvar.Int
+
+	mu       sync.Mutex
+	stopped  bool
+	present  map[key.NodePublic]bool // clients connected to the peer
+	lastPing time.Time               // when the last ping finished
+	pingRTT  time.Duration           // of the last ping, if it succeeded
+	pingErr  error                   // of the last ping
+}
+
+func newMeshPeer(s *derp.Server, name string, c *derphttp.Client) *meshPeer {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &meshPeer{
+		name:    name,
+		s:       s,
+		c:       c,
+		cancel:  cancel,
+		present: map[key.NodePublic]bool{},
+	}
 	c.MeshKey = s.MeshKey()
+	logf := logger.WithPrefix(log.Printf, fmt.Sprintf("mesh(%q): ", name))
+	go c.RunWatchConnectionLoop(ctx, s.PublicKey(), logf, p.add, p.remove)
+	go p.pingLoop(ctx)
+	return p
+}
+
+// ForwardPacket implements derp.PacketForwarder, counting the packets
+// forwarded to the peer.
+func (p *meshPeer) ForwardPacket(src, dst key.NodePublic, payload []byte) error {
+	err := p.c.ForwardPacket(src, dst, payload)
+	if err != nil {
+		p.forwardErrors.Add(1)
+	} else {
+		p.packetsForwarded.Add(1)
+	}
+	return err
+}
+
+func (p *meshPeer) add(k key.NodePublic) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	p.present[k] = true
+	p.s.AddPacketForwarder(k, p)
+}
+
+func (p *meshPeer) remove(k key.NodePublic) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	delete(p.present, k)
+	p.s.RemovePacketForwarder(k, p)
+}
+
+// stop disconnects from the peer and stops forwarding packets to it.
+func (p *meshPeer) stop() {
+	p.cancel()
+	p.c.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	for k := range p.present {
+		p.s.RemovePacketForwarder(k, p)
+	}
+	p.present = nil
+}
+
+func (p *meshPeer) pingLoop(ctx context.Context) {
+	t := time.NewTicker(meshPingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		start := time.Now()
+		err := p.c.Ping(ctx)
+		p.mu.Lock()
+		p.lastPing = time.Now()
+		p.pingRTT = p.lastPing.Sub(start)
+		p.pingErr = err
+		p.mu.Unlock()
+	}
+}
+
+// ServeHTTP serves the debug page listing the mesh peers and the health
+// of the connections to them.
+func (m *mesh) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	peers := make([]*meshPeer, 0, len(m.peers))
+	for _, p := range m.peers {
+		peers = append(peers, p)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(peers, func(a, b *meshPeer) bool { return a.name < b.name })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, "<html><body><h1>Mesh peers</h1>\n")
+	io.WriteString(w, "<table border=1 cellpadding=4><tr><th>Peer</th><th>Health</th><th>Ping RTT</th><th>Clients</th><th>Packets forwarded</th><th>Forward errors</th></tr>\n")
+	for _, p := range peers {
+		p.mu.Lock()
+		health := "unknown"
+		var rtt string
+		switch {
+		case p.lastPing.IsZero():
+		case p.pingErr != nil:
+			health = "error: " + p.pingErr.Error()
+		default:
+			health = fmt.Sprintf("ok (%v ago)", time.Since(p.lastPing).Round(time.Second))
+			rtt = p.pingRTT.Round(time.Microsecond).String()
+		}
+		clients := len(p.present)
+		p.mu.Unlock()
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td></tr>\n",
+			html.EscapeString(p.name), html.EscapeString(health), rtt, clients,
+			p.packetsForwarded.Value(), p.forwardErrors.Value())
+	}
+	io.WriteString(w, "</table></body></html>\n")
+}
+
+// startMeshWithNode starts meshing with the --mesh-config node n.
+func startMeshWithNode(s *derp.Server, n *tailcfg.DERPNode) *meshPeer {
+	logf := logger.WithPrefix(log.Printf, fmt.Sprintf("mesh(%q): ", n.Name))
+	region := &tailcfg.DERPRegion{
+		RegionID: n.RegionID,
+		Nodes:    []*tailcfg.DERPNode{n},
+	}
+	c := derphttp.NewRegionClient(s.PrivateKey(), logf, func() *tailcfg.DERPRegion { return region })
+	p := newMeshPeer(s, n.Name, c)
+	p.node = n
+	return p
+}
+
+// startMeshWithHost starts meshing with the --mesh-with host.
+func startMeshWithHost(s *derp.Server, host string) (*meshPeer, error) {
+	logf := logger.WithPrefix(log.Printf, fmt.Sprintf("mesh(%q): ", host))
+	c, err := derphttp.NewClient(s.PrivateKey(), "https://"+host+"/derp", logf)
+	if err != nil {
+		return nil, err
+	}
 
 	// For meshed peers within a region, connect via VPC addresses.
 	c.SetURLDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -69,8 +334,5 @@ func startMeshWithHost(s *derp.Server, host string) error {
 		return d.DialContext(ctx, network, addr)
 	})
 
-	add := func(k key.NodePublic) { s.AddPacketForwarder(k, c) }
-	remove := func(k key.NodePublic) { s.RemovePacketForwarder(k, c) }
-	go c.RunWatchConnectionLoop(context.Background(), s.PublicKey(), logf, add, remove)
-	return nil
+	return newMeshPeer(s, host, c), nil
 }
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+	"tailscale.com/derp"
+	"tailscale.com/types/key"
+)
+
+const testMeshConfig = `{
+	"Regions": {
+		"1": {
+			"RegionID": 1,
+			"Nodes": [
+				{"Name": "1a", "RegionID": 1, "HostName": "derp1a.invalid"},
+				{"Name": "1b", "RegionID": 1, "HostName": "derp1b.invalid"},
+				{"Name": "1c", "RegionID": 1, "HostName": "derp1c.invalid"},
+				{"Name": "1s", "RegionID": 1, "HostName": "stun1.invalid", "STUNOnly": true}
+			]
+		},
+		"2": {
+			"RegionID": 2,
+			"Nodes": [
+				{"Name": "2a", "RegionID": 2, "HostName": "derp2a.invalid"}
+			]
+		}
+	}
+}`
+
+func TestMeshNodesFromConfig(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     []string // node names
+		wantErr  bool
+	}{
+		{hostname: "derp1a.invalid", want: []string{"1b", "1c"}},
+		{hostname: "derp1c.invalid", want: []string{"1a", "1b"}},
+		{hostname: "derp2a.invalid", want: nil},
+		{hostname: "derp3a.invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		nodes, err := meshNodesFromConfig([]byte(testMeshConfig), tt.hostname)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v; wantErr %v", tt.hostname, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, n := range nodes {
+			got = append(got, n.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q; want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestMeshLoadConfig(t *testing.T) {
+	s := derp.NewServer(key.NewNode(), t.Logf)
+	defer s.Close()
+	s.SetMeshKey(strings.Repeat("ab", 32))
+	m := &mesh{s: s, peers: map[string]*meshPeer{}}
+	defer func() {
+		for _, p := range m.peers {
+			p.stop()
+		}
+	}()
+
+	path := filepath.Join(t.TempDir(), "derpmap.json")
+	load := func(config string, wantPeers ...string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.loadConfig(path, "derp1a.invalid"); err != nil {
+			t.Fatal(err)
+		}
+		got := maps.Keys(m.peers)
+		slices.Sort(got)
+		if !slices.Equal(got, wantPeers) {
+			t.Fatalf("peers = %q; want %q", got, wantPeers)
+		}
+	}
+
+	load(testMeshConfig, "1b", "1c")
+	p1b := m.peers["1b"]
+
+	// Remove 1c and change 1b's port.
+	load(strings.NewReplacer(
+		`{"Name": "1c", "RegionID": 1, "HostName": "derp1c.invalid"},`, "",
+		`"HostName": "derp1b.invalid"`, `"HostName": "derp1b.invalid", "DERPPort": 8443`,
+	).Replace(testMeshConfig), "1b")
+	if m.peers["1b"] == p1b {
+		t.Error("changed peer 1b wasn't restarted")
+	}
+	p1b = m.peers["1b"]
+
+	load(testMeshConfig, "1b", "1c")
+	if m.peers["1b"] == p1b {
+		t.Error("changed peer 1b wasn't restarted")
+	}
+	p1b = m.peers["1b"]
+	load(testMeshConfig, "1b", "1c")
+	if m.peers["1b"] != p1b {
+		t.Error("unchanged peer 1b was restarted")
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.loadConfig(path, "derp1a.invalid"); err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	if len(m.peers) != 2 {
+		t.Errorf("invalid config changed peers: %v", maps.Keys(m.peers))
+	}
+}
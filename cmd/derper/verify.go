@@ -0,0 +1,219 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/derp"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logger"
+)
+
+// failOpenAdmits counts the clients that --verify-client-url-fail-open
+// accepted because the admission controller couldn't be asked. They're
+// also logged, but rate limited.
+var failOpenAdmits = expvar.NewInt("counter_verify_client_url_fail_open_admits")
+
+// newClientVerifier returns the verifier selected by the
+// --verify-client-allowlist and --verify-client-url flags, or nil if
+// neither is set. If both are, clients must pass both.
+//
+// The --verify-clients LocalAPI check is configured separately, with
+// derp.Server.SetVerifyClient.
+func newClientVerifier() (derp.ClientVerifier, error) {
+	var vs multiVerifier
+	if *verifyClientAllowlist != "" {
+		v, err := newAllowlistVerifier(*verifyClientAllowlist)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	if *verifyClientURL != "" {
+		vs = append(vs, &webhookVerifier{
+			url:      *verifyClientURL,
+			failOpen: *verifyClientURLFailOpen,
+			logf:     logger.RateLimitedFn(log.Printf, time.Minute, 5, 100),
+		})
+	}
+	switch len(vs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return vs[0], nil
+	}
+	return vs, nil
+}
+
+// multiVerifier is a derp.ClientVerifier that only accepts the clients
+// that all of its verifiers accept.
+type multiVerifier []derp.ClientVerifier
+
+func (vs multiVerifier) VerifyClient(ctx context.Context, clientKey key.NodePublic, remoteAddr netip.AddrPort) error {
+	for _, v := range vs {
+		if err := v.VerifyClient(ctx, clientKey, remoteAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowlistVerifier is a derp.ClientVerifier that only accepts the clients
+// whose node keys are listed in a file.
+//
+// The file has one node key ("nodekey:...") per line. Blank lines and
+// lines starting with '#' are ignored. The file is re-read when it
+// changes; if it then can't be read or parsed, the error is logged and the
+// previous list stays in use.
+type allowlistVerifier struct {
+	path string
+	logf logger.Logf
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	keys    map[key.NodePublic]bool
+}
+
+func newAllowlistVerifier(path string) (*allowlistVerifier, error) {
+	v := &allowlistVerifier{path: path, logf: log.Printf}
+	if err := v.reloadLocked(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *allowlistVerifier) VerifyClient(ctx context.Context, clientKey key.NodePublic, remoteAddr netip.AddrPort) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.reloadLocked(); err != nil {
+		v.logf("verify-client-allowlist: %v; using previous list", err)
+	}
+	if !v.keys[clientKey] {
+		return fmt.Errorf("client %v not in allowlist", clientKey)
+	}
+	return nil
+}
+
+// reloadLocked re-reads the allowlist file if it's changed since it was
+// last read. v.mu must be held, or v not yet shared.
+func (v *allowlistVerifier) reloadLocked() error {
+	fi, err := os.Stat(v.path)
+	if err != nil {
+		return err
+	}
+	if v.keys != nil && fi.ModTime().Equal(v.modTime) && fi.Size() == v.size {
+		return nil
+	}
+	b, err := os.ReadFile(v.path)
+	if err != nil {
+		return err
+	}
+	keys, err := parseAllowlist(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", v.path, err)
+	}
+	if v.keys != nil {
+		v.logf("verify-client-allowlist: loaded %d keys from %s", len(keys), v.path)
+	}
+	v.modTime, v.size, v.keys = fi.ModTime(), fi.Size(), keys
+	return nil
+}
+
+// parseAllowlist parses the contents of an allowlistVerifier file.
+func parseAllowlist(b []byte) (map[key.NodePublic]bool, error) {
+	keys := map[key.NodePublic]bool{}
+	bs := bufio.NewScanner(bytes.NewReader(b))
+	for lineNum := 1; bs.Scan(); lineNum++ {
+		line := strings.TrimSpace(bs.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var k key.NodePublic
+		if err := k.UnmarshalText([]byte(line)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		keys[k] = true
+	}
+	if err := bs.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// webhookVerifier is a derp.ClientVerifier that asks an HTTP admission
+// controller whether to accept each client, by POSTing it a JSON
+// tailcfg.DERPAdmitClientRequest and reading back a
+// tailcfg.DERPAdmitClientResponse.
+type webhookVerifier struct {
+	url string
+	// failOpen is whether to accept clients when the admission
+	// controller can't be reached or returns an error.
+	failOpen bool
+	logf     logger.Logf
+	hc       *http.Client // or nil for http.DefaultClient
+}
+
+func (v *webhookVerifier) VerifyClient(ctx context.Context, clientKey key.NodePublic, remoteAddr netip.AddrPort) error {
+	allow, err := v.admit(ctx, clientKey, remoteAddr.Addr())
+	if err != nil {
+		if v.failOpen {
+			failOpenAdmits.Add(1)
+			v.logf("verify-client-url: admitting %v after error: %v", clientKey, err)
+			return nil
+		}
+		return fmt.Errorf("admission controller: %w", err)
+	}
+	if !allow {
+		return fmt.Errorf("client %v denied by admission controller", clientKey)
+	}
+	return nil
+}
+
+func (v *webhookVerifier) admit(ctx context.Context, clientKey key.NodePublic, src netip.Addr) (allow bool, err error) {
+	body, err := json.Marshal(tailcfg.DERPAdmitClientRequest{
+		NodePublic: clientKey,
+		Source:     src,
+	})
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", v.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := v.hc
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %v", res.Status)
+	}
+	var jres tailcfg.DERPAdmitClientResponse
+	if err := json.NewDecoder(res.Body).Decode(&jres); err != nil {
+		return false, err
+	}
+	return jres.Allow, nil
+}
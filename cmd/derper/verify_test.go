@@ -0,0 +1,107 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func TestAllowlistVerifier(t *testing.T) {
+	ctx := context.Background()
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	path := filepath.Join(t.TempDir(), "allowlist")
+	write := func(s string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// Don't depend on the filesystem's timestamp granularity.
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(v *allowlistVerifier, k key.NodePublic, wantOK bool) {
+		t.Helper()
+		err := v.VerifyClient(ctx, k, netip.AddrPort{})
+		if (err == nil) != wantOK {
+			t.Errorf("VerifyClient(%v) = %v; want ok=%v", k.ShortString(), err, wantOK)
+		}
+	}
+
+	if _, err := newAllowlistVerifier(path); err == nil {
+		t.Fatal("missing allowlist accepted")
+	}
+
+	t0 := time.Now().Add(-time.Hour)
+	write("# test nodes\n\n"+k1.String()+"\n", t0)
+	v, err := newAllowlistVerifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.logf = t.Logf
+	check(v, k1, true)
+	check(v, k2, false)
+
+	write(k2.String()+"\n", t0.Add(time.Second))
+	check(v, k1, false)
+	check(v, k2, true)
+
+	// An invalid file leaves the previous list in place.
+	write("bogus\n", t0.Add(2*time.Second))
+	check(v, k1, false)
+	check(v, k2, true)
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	ctx := context.Background()
+	allowed := key.NewNode().Public()
+	src := netip.MustParseAddrPort("1.2.3.4:567")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req tailcfg.DERPAdmitClientRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if req.Source != src.Addr() {
+			t.Errorf("Source = %v; want %v", req.Source, src.Addr())
+		}
+		json.NewEncoder(w).Encode(tailcfg.DERPAdmitClientResponse{
+			Allow: req.NodePublic == allowed,
+		})
+	}))
+	defer ts.Close()
+
+	v := &webhookVerifier{url: ts.URL, logf: t.Logf}
+	if err := v.VerifyClient(ctx, allowed, src); err != nil {
+		t.Errorf("allowed client rejected: %v", err)
+	}
+	if err := v.VerifyClient(ctx, key.NewNode().Public(), src); err == nil {
+		t.Error("denied client accepted")
+	}
+
+	ts.Close()
+	if err := v.VerifyClient(ctx, allowed, src); err == nil {
+		t.Error("client accepted with admission controller down")
+	}
+	v.failOpen = true
+	admits := failOpenAdmits.Value()
+	if err := v.VerifyClient(ctx, key.NewNode().Public(), src); err != nil {
+		t.Errorf("client rejected with admission controller down and fail open: %v", err)
+	}
+	if got := failOpenAdmits.Value() - admits; got != 1 {
+		t.Errorf("fail-open admissions counted = %d; want 1", got)
+	}
+}
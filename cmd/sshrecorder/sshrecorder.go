@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The sshrecorder binary is a reference server for Tailscale SSH session
+// recordings. It joins the tailnet as its own node and stores the
+// recordings that Tailscale SSH servers upload to it as asciinema cast
+// files, one directory per recorded node.
+//
+// To record sessions, list the sshrecorder node's Tailscale IP and port in
+// the Recorders of the SSH policy's actions:
+//
+//	"recorders": ["100.101.102.103:80"]
+//
+// Set the TS_AUTHKEY environment variable to have this server automatically
+// join your tailnet, or look for the logged auth link on first start.
+package main // import "tailscale.com/cmd/sshrecorder"
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tailscale.com/tsnet"
+)
+
+var (
+	hostname     = flag.String("hostname", "sshrecorder", "Tailscale hostname to serve on")
+	tailscaleDir = flag.String("state-dir", "", "Alternate directory to use for Tailscale state storage. If empty, a default is used.")
+	listenPort   = flag.Int("port", 80, "port to listen for recordings on")
+	recordingDir = flag.String("dir", "recordings", "directory to store recordings in")
+)
+
+func main() {
+	flag.Parse()
+	if *hostname == "" || strings.Contains(*hostname, ".") {
+		log.Fatal("missing or invalid --hostname")
+	}
+	if err := os.MkdirAll(*recordingDir, 0700); err != nil {
+		log.Fatal(err)
+	}
+	ts := &tsnet.Server{
+		Dir:      *tailscaleDir,
+		Hostname: *hostname,
+	}
+	defer ts.Close()
+	ln, err := ts.Listen("tcp", fmt.Sprintf(":%d", *listenPort))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ln.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/record", ts.WhoIsHandler(http.HandlerFunc(serveRecord), &tsnet.WhoIsOptions{
+		RejectUnknown: true,
+	}))
+	log.Printf("listening for recordings on :%d", *listenPort)
+	log.Fatal(http.Serve(ln, mux))
+}
+
+// serveRecord stores the recording uploaded in r's body, responding with
+// 200 OK once all of it is safely on disk.
+func serveRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := tsnet.IdentityFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unknown tailnet peer", http.StatusForbidden)
+		return
+	}
+	dir := filepath.Join(*recordingDir, string(id.Node.StableID))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("creating recording dir: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.CreateTemp(dir, fmt.Sprintf("ssh-session-%v-*.cast", time.Now().UnixNano()))
+	if err != nil {
+		log.Printf("creating recording: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("recording session from %v (%v) to %v", id.Node.ComputedName, id.UserProfile.LoginName, f.Name())
+	_, err = io.Copy(f, r.Body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("recording %v: %v", f.Name(), err)
+		http.Error(w, "recording failed", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("finished recording %v", f.Name())
+}
@@ -6,6 +6,8 @@
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -16,6 +18,7 @@
 
 	qt "github.com/frankban/quicktest"
 	"github.com/google/go-cmp/cmp"
+	gossh "golang.org/x/crypto/ssh"
 	"tailscale.com/health/healthmsg"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
@@ -1236,3 +1239,68 @@ func TestParseNLArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLocalForward(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantListen string
+		wantRemote string
+		wantErr    bool
+	}{
+		{spec: "8080:localhost:80", wantListen: "localhost:8080", wantRemote: "localhost:80"},
+		{spec: "0.0.0.0:8080:db:5432", wantListen: "0.0.0.0:8080", wantRemote: "db:5432"},
+		{spec: ":8080:db:5432", wantListen: ":8080", wantRemote: "db:5432"},
+		{spec: "[::1]:8080:[fd7a:115c:a1e0::1]:80", wantListen: "[::1]:8080", wantRemote: "[fd7a:115c:a1e0::1]:80"},
+		{spec: "8080:[::1]:80", wantListen: "localhost:8080", wantRemote: "[::1]:80"},
+		{spec: "8080", wantErr: true},
+		{spec: "8080:db", wantErr: true},
+		{spec: "8080::80", wantErr: true},
+		{spec: "8080:[::1:80", wantErr: true},
+		{spec: "a:b:c:d:e", wantErr: true},
+	}
+	for _, tt := range tests {
+		listen, remote, err := parseLocalForward(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLocalForward(%q) err = %v; wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if listen != tt.wantListen || remote != tt.wantRemote {
+			t.Errorf("parseLocalForward(%q) = %q, %q; want %q, %q", tt.spec, listen, remote, tt.wantListen, tt.wantRemote)
+		}
+	}
+}
+
+func TestSSHHostKeyCallback(t *testing.T) {
+	newKey := func() gossh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := gossh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	known, unknown := newKey(), newKey()
+	ps := &ipnstate.PeerStatus{
+		DNSName: "foo.bar.ts.net.",
+		SSH_HostKeys: []string{
+			"not a key",
+			strings.TrimSpace(string(gossh.MarshalAuthorizedKey(known))),
+		},
+	}
+	cb, err := sshHostKeyCallback(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cb("foo.bar.ts.net:22", nil, known); err != nil {
+		t.Errorf("known key: %v", err)
+	}
+	if err := cb("foo.bar.ts.net:22", nil, unknown); err == nil {
+		t.Error("unknown key accepted")
+	}
+	if _, err := sshHostKeyCallback(&ipnstate.PeerStatus{DNSName: "foo.bar.ts.net."}); err == nil {
+		t.Error("no error for peer without host keys")
+	}
+}
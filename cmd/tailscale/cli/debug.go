@@ -61,6 +61,17 @@
 			Exec:      runDERPMap,
 			ShortHelp: "print DERP map",
 		},
+		{
+			Name:      "ssh-policy",
+			Exec:      runDebugSSHPolicy,
+			ShortHelp: "print the effective Tailscale SSH policy",
+			LongHelp: strings.TrimSpace(`
+Prints the SSH access policy that Tailscale SSH enforces: the tailnet's
+policy merged with the local SSH policy file, if any. The local file is
+ssh-policy.hujson in tailscaled's state directory. Its rules are evaluated
+after the tailnet's unless it sets "precedence" to "local" or "local-only".
+`),
+		},
 		{
 			Name:      "component-logs",
 			Exec:      runDebugComponentLogs,
@@ -360,6 +371,23 @@ func runDERPMap(ctx context.Context, args []string) error {
 	return nil
 }
 
+func runDebugSSHPolicy(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	pol, err := localClient.DebugSSHPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if pol == nil {
+		printf("no SSH policy\n")
+		return nil
+	}
+	enc := json.NewEncoder(Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(pol)
+}
+
 func localAPIAction(action string) func(context.Context, []string) error {
 	return func(ctx context.Context, args []string) error {
 		if len(args) > 0 {
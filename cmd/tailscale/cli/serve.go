@@ -12,6 +12,8 @@
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/textproto"
 	"net/url"
 	"os"
 	"path"
@@ -20,6 +22,7 @@
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"golang.org/x/exp/slices"
@@ -38,7 +41,7 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
 		Name:      "serve",
 		ShortHelp: "[ALPHA] Serve from your Tailscale node",
 		ShortUsage: strings.TrimSpace(`
-  serve [flags] <mount-point> {proxy|path|text} <arg>
+  serve [flags] <mount-point> {proxy|path|text|redirect|status} <arg>
   serve [flags] <sub-command> [sub-flags] <args>`),
 		LongHelp: strings.TrimSpace(`
 *** ALPHA; all of this is subject to change ***
@@ -62,11 +65,40 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
 
   - To serve simple static text:
     $ tailscale serve / text "Hello, world!"
+
+  - To permanently redirect requests to another URL:
+    $ tailscale serve --code=301 /old redirect https://example.com/new
+
+  - To respond with a fixed HTTP status code:
+    $ tailscale serve /private status 403
+
+  - To load balance requests across local web servers, skipping those
+    that fail a health check:
+    $ tailscale serve --lb-policy=least-conn --health-check=/healthz / proxy 3000,3001,3002
+
+  - To proxy requests, telling the backend which tailnet user made them:
+    $ tailscale serve --identity-headers / proxy 3000
+
+  - To only allow some users and tagged nodes to access a mount point:
+    $ tailscale serve --allow-user=alice@example.com --allow-tag=tag:ci /admin proxy 3001
+
+  - To share a local web server for the next hour only:
+    $ tailscale serve --ttl=1h / proxy 3000
 `),
 		Exec: e.runServe,
 		FlagSet: e.newFlags("serve", func(fs *flag.FlagSet) {
 			fs.BoolVar(&e.remove, "remove", false, "remove an existing serve config")
 			fs.UintVar(&e.servePort, "serve-port", 443, "port to serve on (443, 8443 or 10000)")
+			fs.IntVar(&e.statusCode, "code", 0, "HTTP status code for redirect (default 302) or text (default 200) responses")
+			fs.Var(&e.setRequestHeaders, "set-header", `header to set on proxied requests, as "Name: value"; may be repeated`)
+			fs.Var(&e.setResponseHeaders, "set-response-header", `header to set on responses, as "Name: value"; may be repeated`)
+			fs.BoolVar(&e.identityHeaders, "identity-headers", false, "set Tailscale-User-Login and Tailscale-User-Name headers on proxied requests")
+			fs.StringVar(&e.lbPolicy, "lb-policy", "", `load balancing policy for multiple comma-separated proxy targets ("round-robin" or "least-conn")`)
+			fs.StringVar(&e.healthCheckPath, "health-check", "", "URL path to periodically check on multiple proxy targets; failing targets get no requests")
+			fs.Var(&e.allowUsers, "allow-user", "only allow this user's login name to access the mount point; may be repeated")
+			fs.Var(&e.allowTags, "allow-tag", "only allow nodes with this tag to access the mount point; may be repeated")
+			fs.Var(&e.allowCaps, "allow-cap", "only allow peers granted this capability to access the mount point; may be repeated")
+			fs.DurationVar(&e.ttl, "ttl", 0, "remove the mount point after this long (e.g. 30m); 0 to serve until removed")
 		}),
 		UsageFunc: usageFunc,
 		Subcommands: []*ffcli.Command{
@@ -90,9 +122,17 @@ func newServeCommand(e *serveEnv) *ffcli.Command {
 					"",
 					"  - Forward raw, TLS-terminated TCP packets to a local TCP server on port 5432:",
 					"    $ tailscale serve --terminate-tls tcp 5432",
+					"",
+					"  - Tell the local server the tailnet address of each client with a PROXY protocol v2 header:",
+					"    $ tailscale serve --proxy-protocol=2 tcp 5432",
+					"",
+					"  - Forward TCP connections to port 5432 for the next 30 minutes only:",
+					"    $ tailscale serve --ttl=30m tcp 5432",
 				}, "\n"),
 				FlagSet: e.newFlags("serve-tcp", func(fs *flag.FlagSet) {
 					fs.BoolVar(&e.terminateTLS, "terminate-tls", false, "terminate TLS before forwarding TCP connection")
+					fs.IntVar(&e.proxyProtocol, "proxy-protocol", 0, "PROXY protocol version (1 or 2) header to send before forwarding TCP connection; 0 for none")
+					fs.DurationVar(&e.ttl, "ttl", 0, "remove the TCP port forward after this long (e.g. 30m); 0 to forward until removed")
 				}),
 				UsageFunc: usageFunc,
 			},
@@ -133,17 +173,32 @@ func (e *serveEnv) newFlags(name string, setup func(fs *flag.FlagSet)) *flag.Fla
 // It also contains the flags, as registered with newServeCommand.
 type serveEnv struct {
 	// flags
-	servePort    uint // Port to serve on. Defaults to 443.
-	terminateTLS bool
-	remove       bool // remove a serve config
-	json         bool // output JSON (status only for now)
+	servePort     uint // Port to serve on. Defaults to 443.
+	terminateTLS  bool
+	proxyProtocol int           // PROXY protocol version for TCP forwarding, or 0
+	remove        bool          // remove a serve config
+	json          bool          // output JSON (status only for now)
+	ttl           time.Duration // how long until the mapping expires, or 0 for never
+
+	statusCode         int        // HTTP status code for redirect, text and status handlers
+	setRequestHeaders  headerFlag // headers to set on proxied requests
+	setResponseHeaders headerFlag // headers to set on responses
+	identityHeaders    bool       // set identity headers on proxied requests
+	lbPolicy           string     // load balancing policy for multiple proxy targets
+	healthCheckPath    string     // health check path for multiple proxy targets
+
+	allowUsers stringsFlag // login names allowed to access a web handler
+	allowTags  stringsFlag // tags allowed to access a web handler
+	allowCaps  stringsFlag // peer capabilities allowed to access a web handler
 
 	// optional stuff for tests:
-	testFlagOut              io.Writer
-	testGetServeConfig       func(context.Context) (*ipn.ServeConfig, error)
-	testSetServeConfig       func(context.Context, *ipn.ServeConfig) error
-	testGetLocalClientStatus func(context.Context) (*ipnstate.Status, error)
-	testStdout               io.Writer
+	testFlagOut               io.Writer
+	testGetServeConfig        func(context.Context) (*ipn.ServeConfig, error)
+	testSetServeConfig        func(context.Context, *ipn.ServeConfig) error
+	testGetLocalClientStatus  func(context.Context) (*ipnstate.Status, error)
+	testGetServeBackendStatus func(context.Context) ([]ipn.ServeBackendStatus, error)
+	testStdout                io.Writer
+	testNow                   func() time.Time
 }
 
 // getSelfDNSName returns the DNS name of the current node.
@@ -187,6 +242,33 @@ func (e *serveEnv) getServeConfig(ctx context.Context) (*ipn.ServeConfig, error)
 	return localClient.GetServeConfig(ctx)
 }
 
+func (e *serveEnv) getServeBackendStatus(ctx context.Context) ([]ipn.ServeBackendStatus, error) {
+	if e.testGetServeBackendStatus != nil {
+		return e.testGetServeBackendStatus(ctx)
+	}
+	return localClient.ServeBackendStatus(ctx)
+}
+
+func (e *serveEnv) now() time.Time {
+	if e.testNow != nil {
+		return e.testNow()
+	}
+	return time.Now()
+}
+
+// expiry returns the Expires time for a mapping added with the --ttl flag,
+// or nil if the flag wasn't set.
+func (e *serveEnv) expiry() (*time.Time, error) {
+	if e.ttl < 0 {
+		return nil, fmt.Errorf("invalid --ttl %v; must be positive", e.ttl)
+	}
+	if e.ttl == 0 {
+		return nil, nil
+	}
+	t := e.now().Add(e.ttl)
+	return &t, nil
+}
+
 func (e *serveEnv) setServeConfig(ctx context.Context, c *ipn.ServeConfig) error {
 	if e.testSetServeConfig != nil {
 		return e.testSetServeConfig(ctx, c)
@@ -279,20 +361,87 @@ func (e *serveEnv) runServe(ctx context.Context, args []string) error {
 		}
 		h.Path = args[2]
 	case "proxy":
-		t, err := expandProxyTarget(args[2])
-		if err != nil {
-			return err
+		targets := strings.Split(args[2], ",")
+		for _, target := range targets {
+			t, err := expandProxyTarget(target)
+			if err != nil {
+				return err
+			}
+			if len(targets) == 1 {
+				h.Proxy = t
+			} else {
+				h.Backends = append(h.Backends, t)
+			}
 		}
-		h.Proxy = t
 	case "text":
 		if args[2] == "" {
 			return errors.New("unable to serve; text cannot be an empty string")
 		}
 		h.Text = args[2]
+	case "redirect":
+		u, err := url.Parse(args[2])
+		if err != nil || (!u.IsAbs() && !strings.HasPrefix(u.Path, "/")) {
+			return fmt.Errorf("invalid redirect URL %q; must be absolute or start with /", args[2])
+		}
+		if e.statusCode != 0 && !ipn.IsRedirectCode(e.statusCode) {
+			return fmt.Errorf("invalid redirect code %d; must be 301, 302, 303, 307 or 308", e.statusCode)
+		}
+		h.Redirect = args[2]
+	case "status":
+		code, err := strconv.Atoi(args[2])
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid HTTP status code %q", args[2])
+		}
+		h.StatusCode = code
 	default:
 		fmt.Fprintf(os.Stderr, "error: unknown serve type %q\n\n", args[1])
 		return flag.ErrHelp
 	}
+	if e.statusCode != 0 {
+		switch args[1] {
+		case "redirect", "text":
+			if e.statusCode < 100 || e.statusCode > 599 {
+				return fmt.Errorf("invalid HTTP status code %d", e.statusCode)
+			}
+			h.StatusCode = e.statusCode
+		default:
+			return fmt.Errorf("--code is only valid with redirect or text")
+		}
+	}
+	if len(e.setRequestHeaders) > 0 || e.identityHeaders {
+		if h.Proxy == "" && len(h.Backends) == 0 {
+			return errors.New("--set-header and --identity-headers are only valid with proxy")
+		}
+		h.SetRequestHeaders = e.setRequestHeaders
+		h.IdentityHeaders = e.identityHeaders
+	}
+	h.SetResponseHeaders = e.setResponseHeaders
+	if e.lbPolicy != "" || e.healthCheckPath != "" {
+		if len(h.Backends) == 0 {
+			return errors.New("--lb-policy and --health-check are only valid with multiple proxy targets")
+		}
+		switch e.lbPolicy {
+		case "", ipn.LBRoundRobin, ipn.LBLeastConn:
+		default:
+			return fmt.Errorf("invalid --lb-policy %q; must be %q or %q", e.lbPolicy, ipn.LBRoundRobin, ipn.LBLeastConn)
+		}
+		if e.healthCheckPath != "" && !strings.HasPrefix(e.healthCheckPath, "/") {
+			return fmt.Errorf("invalid --health-check %q; must start with /", e.healthCheckPath)
+		}
+		h.LBPolicy = e.lbPolicy
+		h.HealthCheckPath = e.healthCheckPath
+	}
+	for _, tag := range e.allowTags {
+		if err := tailcfg.CheckTag(tag); err != nil {
+			return fmt.Errorf("invalid --allow-tag %q: %w", tag, err)
+		}
+	}
+	h.AllowUsers = e.allowUsers
+	h.AllowTags = e.allowTags
+	h.AllowCaps = e.allowCaps
+	if h.Expires, err = e.expiry(); err != nil {
+		return err
+	}
 
 	cursc, err := e.getServeConfig(ctx)
 	if err != nil {
@@ -480,8 +629,15 @@ func (e *serveEnv) runServeStatus(ctx context.Context, args []string) error {
 		}
 		printf("\n")
 	}
+	var backends []ipn.ServeBackendStatus
+	if sc.IsLoadBalancingAny() {
+		backends, err = e.getServeBackendStatus(ctx)
+		if err != nil {
+			return err
+		}
+	}
 	for hp := range sc.Web {
-		printWebStatusTree(sc, hp)
+		printWebStatusTree(sc, hp, backends)
 		printf("\n")
 	}
 	// warn when funnel on without handlers
@@ -516,10 +672,16 @@ func printTCPStatusTree(ctx context.Context, sc *ipn.ServeConfig, st *ipnstate.S
 		if h.TerminateTLS != "" {
 			tlsStatus = "TLS terminated"
 		}
+		if h.ProxyProtocol != 0 {
+			tlsStatus += fmt.Sprintf(", PROXY v%d", h.ProxyProtocol)
+		}
 		fStatus := "tailnet only"
 		if sc.AllowFunnel[hp] {
 			fStatus = "Funnel on"
 		}
+		if h.Expires != nil {
+			fStatus += ", " + expiresDesc(h.Expires)
+		}
 		printf("|-- tcp://%s (%s, %s)\n", hp, tlsStatus, fStatus)
 		for _, a := range st.TailscaleIPs {
 			ipp := net.JoinHostPort(a.String(), strconv.Itoa(int(p)))
@@ -530,7 +692,9 @@ func printTCPStatusTree(ctx context.Context, sc *ipn.ServeConfig, st *ipnstate.S
 	return nil
 }
 
-func printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort) {
+// printWebStatusTree prints the web handlers for hp, along with the
+// status of their load balanced backends, if any.
+func printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort, backends []ipn.ServeBackendStatus) {
 	if sc == nil {
 		return
 	}
@@ -550,8 +714,22 @@ func printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort) {
 			return "path", h.Path
 		case h.Proxy != "":
 			return "proxy", h.Proxy
+		case len(h.Backends) > 0:
+			policy := h.LBPolicy
+			if policy == "" {
+				policy = ipn.LBRoundRobin
+			}
+			return "proxy", fmt.Sprintf("%d backends, %s", len(h.Backends), policy)
 		case h.Text != "":
 			return "text", "\"" + elipticallyTruncate(h.Text, 20) + "\""
+		case h.Redirect != "":
+			code := h.StatusCode
+			if code == 0 {
+				code = http.StatusFound
+			}
+			return "redirect", fmt.Sprintf("%s (%d)", h.Redirect, code)
+		case h.StatusCode != 0:
+			return "status", strconv.Itoa(h.StatusCode)
 		}
 		return "", ""
 	}
@@ -568,10 +746,86 @@ func printWebStatusTree(sc *ipn.ServeConfig, hp ipn.HostPort) {
 	for _, m := range mounts {
 		h := sc.Web[hp].Handlers[m]
 		t, d := srvTypeAndDesc(h)
+		if h.HasAccessControl() {
+			var allowed []string
+			allowed = append(allowed, h.AllowUsers...)
+			allowed = append(allowed, h.AllowTags...)
+			allowed = append(allowed, h.AllowCaps...)
+			d += " (allow: " + strings.Join(allowed, ", ") + ")"
+		}
+		if h.Expires != nil {
+			d += " (" + expiresDesc(h.Expires) + ")"
+		}
 		printf("%s %s%s %-5s %s\n", "|--", m, strings.Repeat(" ", maxLen-len(m)), t, d)
+		for _, be := range h.Backends {
+			printf("|   |--> %s (%s)\n", be, backendStatusDesc(backends, hp, m, be))
+		}
 	}
 }
 
+// expiresDesc returns a description of the time remaining until expires,
+// for serve status output.
+func expiresDesc(expires *time.Time) string {
+	left := time.Until(*expires).Round(time.Second)
+	if left <= 0 {
+		return "expired"
+	}
+	return fmt.Sprintf("expires in %v", left)
+}
+
+// headerFlag is a flag.Value for repeatable "Name: value" header flags.
+type headerFlag map[string]string
+
+func (v *headerFlag) String() string {
+	var hs []string
+	for k, val := range *v {
+		hs = append(hs, k+": "+val)
+	}
+	sort.Strings(hs)
+	return strings.Join(hs, ", ")
+}
+
+func (v *headerFlag) Set(s string) error {
+	k, val, ok := strings.Cut(s, ":")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" || strings.ContainsAny(k, " \t") {
+		return fmt.Errorf("invalid header %q; want \"Name: value\"", s)
+	}
+	mak.Set((*map[string]string)(v), textproto.CanonicalMIMEHeaderKey(k), strings.TrimSpace(val))
+	return nil
+}
+
+// backendStatusDesc returns a description of the status of the backend be
+// of the handler at mount on hp, as found in backends.
+func backendStatusDesc(backends []ipn.ServeBackendStatus, hp ipn.HostPort, mount, be string) string {
+	for _, st := range backends {
+		if st.HostPort != hp || st.Mount != mount || st.Backend != be {
+			continue
+		}
+		if !st.Healthy {
+			if st.LastError != "" {
+				return "unhealthy: " + st.LastError
+			}
+			return "unhealthy"
+		}
+		return fmt.Sprintf("healthy, %d active", st.ActiveRequests)
+	}
+	return "unknown"
+}
+
+// stringsFlag is a flag.Value for repeatable string flags.
+type stringsFlag []string
+
+func (v *stringsFlag) String() string { return strings.Join(*v, ",") }
+
+func (v *stringsFlag) Set(s string) error {
+	if s == "" {
+		return errors.New("value cannot be empty")
+	}
+	*v = append(*v, s)
+	return nil
+}
+
 func elipticallyTruncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -633,7 +887,11 @@ func (e *serveEnv) runServeTCP(ctx context.Context, args []string) error {
 		return errors.New("error: serve config does not exist")
 	}
 
-	mak.Set(&sc.TCP, srvPort, &ipn.TCPPortHandler{TCPForward: fwdAddr})
+	expires, err := e.expiry()
+	if err != nil {
+		return err
+	}
+	mak.Set(&sc.TCP, srvPort, &ipn.TCPPortHandler{TCPForward: fwdAddr, Expires: expires})
 
 	dnsName, err := e.getSelfDNSName(ctx)
 	if err != nil {
@@ -642,6 +900,13 @@ func (e *serveEnv) runServeTCP(ctx context.Context, args []string) error {
 	if e.terminateTLS {
 		sc.TCP[srvPort].TerminateTLS = dnsName
 	}
+	switch e.proxyProtocol {
+	case 0:
+	case 1, 2:
+		sc.TCP[srvPort].ProxyProtocol = e.proxyProtocol
+	default:
+		return fmt.Errorf("invalid --proxy-protocol %d; must be 1 or 2", e.proxyProtocol)
+	}
 
 	if !reflect.DeepEqual(cursc, sc) {
 		if err := e.setServeConfig(ctx, sc); err != nil {
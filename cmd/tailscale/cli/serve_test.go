@@ -15,6 +15,7 @@
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnstate"
@@ -87,6 +88,11 @@ type step struct {
 		_, _, s.line, _ = runtime.Caller(1)
 		steps = append(steps, s)
 	}
+	now := time.Date(2022, 11, 15, 12, 0, 0, 0, time.UTC)
+	expiresIn := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
 
 	// funnel
 	add(step{reset: true})
@@ -312,6 +318,66 @@ type step struct {
 			},
 		},
 	})
+	add(step{
+		command: cmd("tcp --proxy-protocol=2 8446"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{
+				443: {TCPForward: "127.0.0.1:8446", ProxyProtocol: 2},
+			},
+		},
+	})
+	add(step{
+		command: cmd("tcp --proxy-protocol=3 8446"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("tcp --ttl=30m 8447"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{
+				443: {TCPForward: "127.0.0.1:8447", Expires: expiresIn(30 * time.Minute)},
+			},
+		},
+	})
+	add(step{
+		command: cmd("tcp --ttl=-1m 8447"),
+		wantErr: anyErr(),
+	})
+	add(step{reset: true})
+	add(step{
+		command: cmd("--ttl=1h / text hi"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {Text: "hi", Expires: expiresIn(time.Hour)},
+				}},
+			},
+		},
+	})
+	add(step{ // other mount points don't share the expiry
+		command: cmd("--ttl=10m /foo text bar"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {Text: "hi", Expires: expiresIn(time.Hour)},
+					"/foo": {Text: "bar", Expires: expiresIn(10 * time.Minute)},
+				}},
+			},
+		},
+	})
+	add(step{ // replacing a mount point without --ttl clears its expiry
+		command: cmd("/ text hello"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {Text: "hello"},
+					"/foo": {Text: "bar", Expires: expiresIn(10 * time.Minute)},
+				}},
+			},
+		},
+	})
 	add(step{reset: true})
 	add(step{
 		command: cmd("tcp 123"),
@@ -343,6 +409,151 @@ type step struct {
 			},
 		},
 	})
+	add(step{
+		command: cmd("--code=418 /tea text teapot"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {Text: "hello"},
+					"/tea": {Text: "teapot", StatusCode: 418},
+				}},
+			},
+		},
+	})
+
+	// redirect and status
+	add(step{reset: true})
+	add(step{
+		command: cmd("/old redirect https://example.com/new"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/old": {Redirect: "https://example.com/new"},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("--code=301 /old redirect /new"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/old": {Redirect: "/new", StatusCode: 301},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("--code=200 /old redirect /new"), // not a redirect code
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("/old redirect new"), // relative
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("/gone status 410"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/old":  {Redirect: "/new", StatusCode: 301},
+					"/gone": {StatusCode: 410},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("/gone status 1000"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("--code=404 /gone status 410"), // --code not valid with status
+		wantErr: anyErr(),
+	})
+
+	// headers
+	add(step{reset: true})
+	add(step{
+		command: cmd("--set-header=x-foo:bar --set-header=X-Baz:qux --set-response-header=Cache-Control:no-store --identity-headers / proxy 3000"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {
+						Proxy:              "http://127.0.0.1:3000",
+						SetRequestHeaders:  map[string]string{"X-Foo": "bar", "X-Baz": "qux"},
+						SetResponseHeaders: map[string]string{"Cache-Control": "no-store"},
+						IdentityHeaders:    true,
+					},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("--set-header=X-Foo:bar / text hi"), // request headers need a proxy
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("--set-header=nocolon / proxy 3000"),
+		wantErr: anyErr(),
+	})
+
+	// load balancing
+	add(step{reset: true})
+	add(step{
+		command: cmd("--lb-policy=least-conn --health-check=/healthz / proxy 3000,localhost:3001"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/": {
+						Backends:        []string{"http://127.0.0.1:3000", "http://127.0.0.1:3001"},
+						LBPolicy:        "least-conn",
+						HealthCheckPath: "/healthz",
+					},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("/ proxy 3000,otherhost:3001"), // invalid host
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("--lb-policy=random / proxy 3000,3001"),
+		wantErr: anyErr(),
+	})
+	add(step{
+		command: cmd("--health-check=/healthz / proxy 3000"), // single target
+		wantErr: anyErr(),
+	})
+
+	// access control
+	add(step{reset: true})
+	add(step{
+		command: cmd("--allow-user=alice@example.com --allow-user=bob@example.com --allow-tag=tag:ci --allow-cap=example.com/cap/admin /admin proxy 3001"),
+		want: &ipn.ServeConfig{
+			TCP: map[uint16]*ipn.TCPPortHandler{443: {HTTPS: true}},
+			Web: map[ipn.HostPort]*ipn.WebServerConfig{
+				"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+					"/admin": {
+						Proxy:      "http://127.0.0.1:3001",
+						AllowUsers: []string{"alice@example.com", "bob@example.com"},
+						AllowTags:  []string{"tag:ci"},
+						AllowCaps:  []string{"example.com/cap/admin"},
+					},
+				}},
+			},
+		},
+	})
+	add(step{
+		command: cmd("--allow-tag=ci /admin proxy 3001"), // missing "tag:" prefix
+		wantErr: anyErr(),
+	})
 
 	// path
 	td := t.TempDir()
@@ -624,6 +835,7 @@ type step struct {
 		e := &serveEnv{
 			testFlagOut: &flagOut,
 			testStdout:  &stdout,
+			testNow:     func() time.Time { return now },
 			testGetLocalClientStatus: func(context.Context) (*ipnstate.Status, error) {
 				return &ipnstate.Status{
 					Self: &ipnstate.PeerStatus{
@@ -8,6 +8,7 @@
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/netip"
@@ -16,6 +17,7 @@
 	"path/filepath"
 	"runtime"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"tailscale.com/envknob"
@@ -44,8 +46,89 @@
   system 'ssh' command that connects via a pipe through tailscaled.
 * It automatically checks the destination server's SSH host key against the
   node's SSH host key as advertised via the Tailscale coordination server.
+
+If there's no system 'ssh' command, or if --native is given, 'tailscale ssh'
+uses a built-in SSH client instead, which connects via tailscaled and
+supports interactive sessions, remote commands, agent forwarding (-A) and
+local port forwarding (-L).
+
+The 'sessions' and 'kill' subcommands list and terminate the sessions of
+this machine's Tailscale SSH server.
 `),
 	Exec: runSSH,
+	FlagSet: (func() *flag.FlagSet {
+		fs := newFlagSet("ssh")
+		fs.BoolVar(&sshArgs.native, "native", false, "use the built-in SSH client even if a system 'ssh' command is available")
+		fs.BoolVar(&sshArgs.forwardAgent, "A", false, "forward the local SSH agent connection")
+		fs.Var(&sshArgs.localForwards, "L", "forward a local port to a remote address, as `[bind_address:]port:host:hostport` (repeatable)")
+		fs.BoolVar(&sshArgs.forcePTY, "t", false, "request a terminal even when running a remote command")
+		fs.BoolVar(&sshArgs.noPTY, "T", false, "don't request a terminal")
+		return fs
+	})(),
+	Subcommands: []*ffcli.Command{
+		{
+			Name:       "sessions",
+			ShortUsage: "ssh sessions",
+			ShortHelp:  "List active Tailscale SSH sessions on this machine",
+			Exec:       runSSHSessions,
+		},
+		{
+			Name:       "kill",
+			ShortUsage: "ssh kill <session-or-connection-id>",
+			ShortHelp:  "Terminate a Tailscale SSH session on this machine",
+			LongHelp: strings.TrimSpace(`
+Terminates the Tailscale SSH session with the given ID, as listed by
+'tailscale ssh sessions'. Given a connection ID, it terminates all the
+connection's sessions and closes it.
+`),
+			Exec: runSSHKill,
+		},
+	},
+}
+
+var sshArgs struct {
+	native        bool
+	forwardAgent  bool
+	localForwards stringsFlag
+	forcePTY      bool
+	noPTY         bool
+}
+
+func runSSHSessions(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("unexpected arguments")
+	}
+	sessions, err := localClient.SSHSessions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		printf("No active Tailscale SSH sessions.\n")
+		return nil
+	}
+	tw := tabwriter.NewWriter(Stdout, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tCONNECTION\tPEER\tUSER\tLOCAL USER\tSTARTED\tCOMMAND\tRECORDING\n")
+	for _, s := range sessions {
+		peer := fmt.Sprintf("%s (%s)", strings.TrimSuffix(s.PeerName, "."), s.PeerAddr.Addr())
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.ID, s.ConnID, peer, s.LoginName, s.LocalUser,
+			s.Started.Local().Format("2006-01-02 15:04:05"), dashIfEmpty(s.Command), dashIfEmpty(s.Recording))
+	}
+	return tw.Flush()
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func runSSHKill(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: ssh kill <session-or-connection-id>")
+	}
+	return localClient.KillSSHSession(ctx, args[0])
 }
 
 func runSSH(ctx context.Context, args []string) error {
@@ -75,15 +158,17 @@ func runSSH(ctx context.Context, args []string) error {
 	// connecting to, so we have to maintain fewer entries in the
 	// known_hosts files.
 	hostForSSH := host
-	if v, ok := nodeDNSNameFromArg(st, host); ok {
-		hostForSSH = v
+	ps, isPeer := peerStatusFromArg(st, host)
+	if isPeer {
+		hostForSSH = ps.DNSName
 	}
 
 	ssh, err := findSSH()
-	if err != nil {
-		// TODO(bradfitz): use Go's crypto/ssh client instead
-		// of failing. But for now:
-		return fmt.Errorf("no system 'ssh' command found: %w", err)
+	if sshArgs.native || err != nil {
+		if !isPeer {
+			return fmt.Errorf("unknown host %q; the built-in SSH client only connects to Tailscale peers", host)
+		}
+		return runNativeSSH(ctx, ps, username, argRest)
 	}
 	tailscaleBin, err := os.Executable()
 	if err != nil {
@@ -105,6 +190,18 @@ func runSSH(ctx context.Context, args []string) error {
 		"-o", "UpdateHostKeys no",
 		"-o", "StrictHostKeyChecking yes",
 	)
+	if sshArgs.forwardAgent {
+		argv = append(argv, "-A")
+	}
+	for _, spec := range sshArgs.localForwards {
+		argv = append(argv, "-L", spec)
+	}
+	if sshArgs.forcePTY {
+		argv = append(argv, "-t")
+	}
+	if sshArgs.noPTY {
+		argv = append(argv, "-T")
+	}
 
 	// TODO(bradfitz): nc is currently broken on macOS:
 	// https://github.com/tailscale/tailscale/issues/4529
@@ -178,32 +275,31 @@ func genKnownHosts(st *ipnstate.Status) []byte {
 	return buf.Bytes()
 }
 
-// nodeDNSNameFromArg returns the PeerStatus.DNSName value from a peer
-// in st that matches the input arg which can be a base name, full
-// DNS name, or an IP.
-func nodeDNSNameFromArg(st *ipnstate.Status, arg string) (dnsName string, ok bool) {
+// peerStatusFromArg returns the peer in st that matches the input arg
+// which can be a base name, full DNS name, or an IP.
+func peerStatusFromArg(st *ipnstate.Status, arg string) (_ *ipnstate.PeerStatus, ok bool) {
 	if arg == "" {
-		return
+		return nil, false
 	}
 	argIP, _ := netip.ParseAddr(arg)
 	for _, ps := range st.Peer {
-		dnsName = ps.DNSName
+		dnsName := ps.DNSName
 		if argIP.IsValid() {
 			for _, ip := range ps.TailscaleIPs {
 				if ip == argIP {
-					return dnsName, true
+					return ps, true
 				}
 			}
 			continue
 		}
 		if strings.EqualFold(strings.TrimSuffix(arg, "."), strings.TrimSuffix(dnsName, ".")) {
-			return dnsName, true
+			return ps, true
 		}
 		if base, _, ok := strings.Cut(ps.DNSName, "."); ok && strings.EqualFold(base, arg) {
-			return dnsName, true
+			return ps, true
 		}
 	}
-	return "", false
+	return nil, false
 }
 
 // getSSHClientEnvVar returns the "SSH_CLIENT" environment variable
@@ -0,0 +1,314 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+	"tailscale.com/ipn/ipnstate"
+)
+
+// sshWindowChanges returns a channel that receives a value whenever the
+// local terminal is resized, until ctx is done. It returns nil on
+// platforms where that's not supported.
+var sshWindowChanges = func(ctx context.Context) <-chan struct{} {
+	return nil
+}
+
+// runNativeSSH connects to the peer ps as username using the built-in SSH
+// client, dialing through tailscaled, and runs cmdArgs (or an interactive
+// shell, if empty). It's used when there's no system ssh command or when
+// --native is given.
+//
+// If the remote command exits, runNativeSSH exits the process with the
+// same status.
+func runNativeSSH(ctx context.Context, ps *ipnstate.PeerStatus, username string, cmdArgs []string) error {
+	hostKeyCallback, err := sshHostKeyCallback(ps)
+	if err != nil {
+		return err
+	}
+	host := strings.TrimSuffix(ps.DNSName, ".")
+	c, err := localClient.DialTCP(ctx, host, 22)
+	if err != nil {
+		return fmt.Errorf("Dial(%q, 22): %w", host, err)
+	}
+	defer c.Close()
+
+	// Tailscale SSH usually authenticates the connection by its Tailscale
+	// identity alone, which the client always tries first. Offer the keys
+	// of the local SSH agent, if any, for policies that require a
+	// public key.
+	var (
+		auth       []ssh.AuthMethod
+		localAgent agent.ExtendedAgent
+	)
+	if ag, err := dialLocalSSHAgent(); err == nil {
+		localAgent = ag
+		auth = append(auth, ssh.PublicKeysCallback(ag.Signers))
+	}
+	sc, chans, reqs, err := ssh.NewClientConn(c, host+":22", &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		BannerCallback: func(msg string) error {
+			// Messages from the SSH policy, such as the URL
+			// to visit for check mode.
+			_, err := io.WriteString(Stderr, msg)
+			return err
+		},
+	})
+	if err != nil {
+		return err
+	}
+	client := ssh.NewClient(sc, chans, reqs)
+	defer client.Close()
+
+	for _, spec := range sshArgs.localForwards {
+		if err := sshForwardLocal(ctx, client, spec); err != nil {
+			return err
+		}
+	}
+
+	sess, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	sess.Stdin = os.Stdin
+	sess.Stdout = Stdout
+	sess.Stderr = Stderr
+
+	if sshArgs.forwardAgent {
+		if localAgent == nil {
+			fmt.Fprintf(Stderr, "warning: no SSH agent to forward; is SSH_AUTH_SOCK set?\n")
+		} else if err := sshForwardAgent(client, sess, localAgent); err != nil {
+			return err
+		}
+	}
+
+	restoreTerm := func() {}
+	wantPTY := (len(cmdArgs) == 0 || sshArgs.forcePTY) && !sshArgs.noPTY
+	if wantPTY {
+		restore, err := sshRequestPTY(ctx, sess)
+		if err != nil {
+			return err
+		}
+		restoreTerm = restore
+	}
+	defer restoreTerm()
+
+	if len(cmdArgs) == 0 {
+		err = sess.Shell()
+	} else {
+		err = sess.Start(strings.Join(cmdArgs, " "))
+	}
+	if err != nil {
+		return err
+	}
+	err = sess.Wait()
+	var ee *ssh.ExitError
+	if errors.As(err, &ee) {
+		restoreTerm()
+		client.Close()
+		os.Exit(ee.ExitStatus())
+	}
+	return err
+}
+
+// sshRequestPTY requests a PTY for sess the size of the local terminal, if
+// any, and puts the local terminal in raw mode. It returns a func that
+// restores the local terminal.
+func sshRequestPTY(ctx context.Context, sess *ssh.Session) (restore func(), err error) {
+	restore = func() {}
+	fd := int(os.Stdin.Fd())
+	isTerm := term.IsTerminal(fd)
+	width, height := 80, 24
+	if isTerm {
+		if w, h, err := term.GetSize(fd); err == nil {
+			width, height = w, h
+		}
+	}
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := sess.RequestPty(termType, height, width, modes); err != nil {
+		return nil, fmt.Errorf("requesting PTY: %w", err)
+	}
+	if !isTerm {
+		return restore, nil
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		for range sshWindowChanges(ctx) {
+			if w, h, err := term.GetSize(fd); err == nil {
+				sess.WindowChange(h, w)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		term.Restore(fd, oldState)
+	}, nil
+}
+
+// dialLocalSSHAgent connects to the SSH agent at $SSH_AUTH_SOCK.
+func dialLocalSSHAgent() (agent.ExtendedAgent, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("SSH_AUTH_SOCK not set")
+	}
+	c, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	return agent.NewClient(c), nil
+}
+
+// sshForwardAgent forwards the remote's agent connections on sess to the
+// local agent ag.
+func sshForwardAgent(client *ssh.Client, sess *ssh.Session, ag agent.Agent) error {
+	if err := agent.ForwardToAgent(client, ag); err != nil {
+		return err
+	}
+	if err := agent.RequestAgentForwarding(sess); err != nil {
+		return fmt.Errorf("requesting agent forwarding: %w", err)
+	}
+	return nil
+}
+
+// sshForwardLocal starts forwarding connections to a local port over
+// client, as specified by the OpenSSH-style -L argument spec, until ctx
+// is done.
+func sshForwardLocal(ctx context.Context, client *ssh.Client, spec string) error {
+	listenAddr, remoteAddr, err := parseLocalForward(spec)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("-L %s: %w", spec, err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go func() {
+		defer ln.Close()
+		for {
+			lc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer lc.Close()
+				rc, err := client.Dial("tcp", remoteAddr)
+				if err != nil {
+					fmt.Fprintf(Stderr, "-L %s: %v\r\n", spec, err)
+					return
+				}
+				defer rc.Close()
+				errc := make(chan error, 2)
+				go func() {
+					_, err := io.Copy(rc, lc)
+					errc <- err
+				}()
+				go func() {
+					_, err := io.Copy(lc, rc)
+					errc <- err
+				}()
+				<-errc
+			}()
+		}
+	}()
+	return nil
+}
+
+// parseLocalForward parses an OpenSSH-style -L argument of the form
+// "[bind_address:]port:host:hostport" and returns the local address to
+// listen on and the remote address to connect to. IPv6 addresses must be
+// enclosed in square brackets. The bind address defaults to localhost.
+func parseLocalForward(spec string) (listenAddr, remoteAddr string, err error) {
+	fields, ok := splitForwardSpec(spec)
+	if ok && len(fields) == 3 {
+		fields = append([]string{"localhost"}, fields...)
+	}
+	if !ok || len(fields) != 4 || fields[1] == "" || fields[2] == "" || fields[3] == "" {
+		return "", "", fmt.Errorf("invalid -L %q; want [bind_address:]port:host:hostport", spec)
+	}
+	return net.JoinHostPort(fields[0], fields[1]), net.JoinHostPort(fields[2], fields[3]), nil
+}
+
+// splitForwardSpec splits s on colons, except for those in square
+// brackets. It reports false if the brackets are unbalanced.
+func splitForwardSpec(s string) (fields []string, ok bool) {
+	for {
+		var f string
+		if strings.HasPrefix(s, "[") {
+			end := strings.Index(s, "]")
+			if end == -1 {
+				return nil, false
+			}
+			f, s = s[1:end], s[end+1:]
+			if s != "" && s[0] != ':' {
+				return nil, false
+			}
+		} else {
+			end := strings.IndexByte(s, ':')
+			if end == -1 {
+				end = len(s)
+			}
+			f, s = s[:end], s[end:]
+		}
+		fields = append(fields, f)
+		if s == "" {
+			return fields, true
+		}
+		s = s[1:] // the colon
+	}
+}
+
+// sshHostKeyCallback returns an ssh.HostKeyCallback that only accepts the
+// SSH host keys that ps advertises via the coordination server.
+func sshHostKeyCallback(ps *ipnstate.PeerStatus) (ssh.HostKeyCallback, error) {
+	var keys []ssh.PublicKey
+	for _, hk := range ps.SSH_HostKeys {
+		k, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hk))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no SSH host keys known for %s; is Tailscale SSH enabled on it?", ps.DNSName)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, k := range keys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		return fmt.Errorf("SSH host key %s of %s doesn't match any advertised by Tailscale", ssh.FingerprintSHA256(key), ps.DNSName)
+	}, nil
+}
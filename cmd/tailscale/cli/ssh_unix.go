@@ -8,15 +8,40 @@
 
 import (
 	"bytes"
+	"context"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
 func init() {
+	sshWindowChanges = func(ctx context.Context) <-chan struct{} {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGWINCH)
+		ch := make(chan struct{})
+		go func() {
+			defer close(ch)
+			defer signal.Stop(sigc)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-sigc:
+				}
+				select {
+				case ch <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return ch
+	}
 	getSSHClientEnvVar = func() string {
 		if os.Getenv("SUDO_USER") == "" {
 			// No sudo, just check the env.
@@ -68,6 +68,8 @@ type Direct struct {
 	keepAlive              bool
 	logf                   logger.Logf
 	linkMon                *monitor.Mon // or nil
+	health                 *health.Tracker
+	metrics                *metrics
 	discoPubKey            key.DiscoPublic
 	getMachinePrivKey      func() (key.MachinePrivate, error)
 	debugFlags             []string
@@ -118,6 +120,8 @@ type Options struct {
 	OnClientVersion      func(*tailcfg.ClientVersion) // optional func to inform GUI of client version status
 	Dialer               *tsdial.Dialer               // non-nil
 	C2NHandler           http.Handler                 // or nil
+	HealthTracker        *health.Tracker              // or nil to use health.Global
+	ClientMetrics        *clientmetric.Registry       // or nil to use clientmetric.Global
 
 	// Status is called when there's a change in status.
 	Status func(Status)
@@ -247,7 +251,16 @@ func NewDirect(opts Options) (*Direct, error) {
 		c2nHandler:             opts.C2NHandler,
 		dialer:                 opts.Dialer,
 		dialPlan:               opts.DialPlan,
+		health:                 opts.HealthTracker,
 	}
+	if c.health == nil {
+		c.health = health.Global()
+	}
+	clientMetrics := opts.ClientMetrics
+	if clientMetrics == nil {
+		clientMetrics = clientmetric.Global()
+	}
+	c.metrics = newMetrics(clientMetrics)
 	if opts.Hostinfo == nil {
 		c.SetHostinfo(hostinfo.New())
 	} else {
@@ -782,13 +795,13 @@ func (c *Direct) SendLiteMapUpdate(ctx context.Context) error {
 
 // cb nil means to omit peers.
 func (c *Direct) sendMapRequest(ctx context.Context, maxPolls int, readOnly bool, cb func(*netmap.NetworkMap)) error {
-	metricMapRequests.Add(1)
-	metricMapRequestsActive.Add(1)
-	defer metricMapRequestsActive.Add(-1)
+	c.metrics.mapRequests.Add(1)
+	c.metrics.mapRequestsActive.Add(1)
+	defer c.metrics.mapRequestsActive.Add(-1)
 	if maxPolls == -1 {
-		metricMapRequestsPoll.Add(1)
+		c.metrics.mapRequestsPoll.Add(1)
 	} else {
-		metricMapRequestsLite.Add(1)
+		c.metrics.mapRequestsLite.Add(1)
 	}
 
 	c.mu.Lock()
@@ -860,7 +873,7 @@ func (c *Direct) sendMapRequest(ctx context.Context, maxPolls int, readOnly bool
 		ipForwardingBroken(hi.RoutableIPs, c.linkMon.InterfaceState()) {
 		extraDebugFlags = append(extraDebugFlags, "warn-ip-forwarding-off")
 	}
-	if health.RouterHealth() != nil {
+	if c.health.RouterHealth() != nil {
 		extraDebugFlags = append(extraDebugFlags, "warn-router-unhealthy")
 	}
 	extraDebugFlags = health.AppendWarnableDebugFlags(extraDebugFlags)
@@ -921,7 +934,7 @@ func (c *Direct) sendMapRequest(ctx context.Context, maxPolls int, readOnly bool
 	}
 	defer res.Body.Close()
 
-	health.NoteMapRequestHeard(request)
+	c.health.NoteMapRequestHeard(request)
 
 	if cb == nil {
 		io.Copy(io.Discard, res.Body)
@@ -992,14 +1005,14 @@ func (c *Direct) sendMapRequest(ctx context.Context, maxPolls int, readOnly bool
 			return err
 		}
 
-		metricMapResponseMessages.Add(1)
+		c.metrics.mapResponseMessages.Add(1)
 
 		if allowStream {
-			health.GotStreamedMapResponse()
+			c.health.GotStreamedMapResponse()
 		}
 
 		if pr := resp.PingRequest; pr != nil && c.isUniquePingRequest(pr) {
-			metricMapResponsePings.Add(1)
+			c.metrics.mapResponsePings.Add(1)
 			go c.answerPing(pr)
 		}
 		if u := resp.PopBrowserURL; u != "" && u != sess.lastPopBrowserURL {
@@ -1039,13 +1052,13 @@ func (c *Direct) sendMapRequest(ctx context.Context, maxPolls int, readOnly bool
 			return ctx.Err()
 		}
 		if resp.KeepAlive {
-			metricMapResponseKeepAlives.Add(1)
+			c.metrics.mapResponseKeepAlives.Add(1)
 			continue
 		}
 
-		metricMapResponseMap.Add(1)
+		c.metrics.mapResponseMap.Add(1)
 		if i > 0 {
-			metricMapResponseMapDelta.Add(1)
+			c.metrics.mapResponseMapDelta.Add(1)
 		}
 
 		hasDebug := resp.Debug != nil
@@ -1543,10 +1556,10 @@ func (c *Direct) noiseConfigured() bool {
 // SetDNS sends the SetDNSRequest request to the control plane server,
 // requesting a DNS record be created or updated.
 func (c *Direct) SetDNS(ctx context.Context, req *tailcfg.SetDNSRequest) (err error) {
-	metricSetDNS.Add(1)
+	c.metrics.setDNS.Add(1)
 	defer func() {
 		if err != nil {
-			metricSetDNSError.Add(1)
+			c.metrics.setDNSError.Add(1)
 		}
 	}()
 	if c.noiseConfigured() {
@@ -1708,19 +1721,36 @@ func (c *Direct) ReportHealthChange(sys health.Subsystem, sysErr error) {
 	res.Body.Close()
 }
 
-var (
-	metricMapRequestsActive = clientmetric.NewGauge("controlclient_map_requests_active")
+// metrics are a Direct client's client metrics.
+type metrics struct {
+	mapRequestsActive *clientmetric.Metric
 
-	metricMapRequests     = clientmetric.NewCounter("controlclient_map_requests")
-	metricMapRequestsLite = clientmetric.NewCounter("controlclient_map_requests_lite")
-	metricMapRequestsPoll = clientmetric.NewCounter("controlclient_map_requests_poll")
+	mapRequests     *clientmetric.Metric
+	mapRequestsLite *clientmetric.Metric
+	mapRequestsPoll *clientmetric.Metric
 
-	metricMapResponseMessages   = clientmetric.NewCounter("controlclient_map_response_message") // any message type
-	metricMapResponsePings      = clientmetric.NewCounter("controlclient_map_response_ping")
-	metricMapResponseKeepAlives = clientmetric.NewCounter("controlclient_map_response_keepalive")
-	metricMapResponseMap        = clientmetric.NewCounter("controlclient_map_response_map")       // any non-keepalive map response
-	metricMapResponseMapDelta   = clientmetric.NewCounter("controlclient_map_response_map_delta") // 2nd+ non-keepalive map response
+	mapResponseMessages   *clientmetric.Metric // any message type
+	mapResponsePings      *clientmetric.Metric
+	mapResponseKeepAlives *clientmetric.Metric
+	mapResponseMap        *clientmetric.Metric // any non-keepalive map response
+	mapResponseMapDelta   *clientmetric.Metric // 2nd+ non-keepalive map response
 
-	metricSetDNS      = clientmetric.NewCounter("controlclient_setdns")
-	metricSetDNSError = clientmetric.NewCounter("controlclient_setdns_error")
-)
+	setDNS      *clientmetric.Metric
+	setDNSError *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		mapRequestsActive:     r.Gauge("controlclient_map_requests_active"),
+		mapRequests:           r.Counter("controlclient_map_requests"),
+		mapRequestsLite:       r.Counter("controlclient_map_requests_lite"),
+		mapRequestsPoll:       r.Counter("controlclient_map_requests_poll"),
+		mapResponseMessages:   r.Counter("controlclient_map_response_message"),
+		mapResponsePings:      r.Counter("controlclient_map_response_ping"),
+		mapResponseKeepAlives: r.Counter("controlclient_map_response_keepalive"),
+		mapResponseMap:        r.Counter("controlclient_map_response_map"),
+		mapResponseMapDelta:   r.Counter("controlclient_map_response_map_delta"),
+		setDNS:                r.Counter("controlclient_setdns"),
+		setDNSError:           r.Counter("controlclient_setdns_error"),
+	}
+}
@@ -13,6 +13,7 @@
 	crand "crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"expvar"
@@ -132,6 +133,7 @@ type Server struct {
 	dupClientKeys                expvar.Int // current number of public keys we have 2+ connections for
 	dupClientConns               expvar.Int // current number of connections sharing a public key
 	dupClientConnTotal           expvar.Int // total number of accepted connections when a dup key existed
+	dupClientKeysFighting        expvar.Int // total number of dup keys seen sending from 2+ connections (likely cloned)
 	unknownFrames                expvar.Int
 	homeMovesIn                  expvar.Int // established clients announce home server moves in
 	homeMovesOut                 expvar.Int // established clients announce home server moves out
@@ -145,6 +147,16 @@ type Server struct {
 	// known peer in the network, as specified by a running tailscaled's client's LocalAPI.
 	verifyClients bool
 
+	// verifier, if non-nil, decides which clients may connect, in
+	// addition to verifyClients.
+	verifier ClientVerifier
+
+	// keyRecvLimit and ipRecvLimit, if non-nil, are the token-bucket
+	// limits on the bytes of packets that clients (other than mesh
+	// peers) may send, per client key and per source IP respectively.
+	keyRecvLimit *recvLimit
+	ipRecvLimit  *recvLimit
+
 	mu       sync.Mutex
 	closed   bool
 	netConns map[Conn]chan struct{} // chan is closed when conn closes
@@ -162,8 +174,46 @@ type Server struct {
 	// src.
 	sentTo map[key.NodePublic]map[key.NodePublic]int64 // src => dst => dst's latest sclient.connNum
 
+	// draining is whether Drain has been called, after which drainHint
+	// has been sent to the clients connected at the time.
+	draining  bool
+	drainHint ServerRestartingMessage
+
 	// maps from netip.AddrPort to a client's public key
 	keyOfAddr map[netip.AddrPort]key.NodePublic
+
+	// keyRecvLimiters and ipRecvLimiters are the rate limiters shared
+	// by all the connections of a client key or from a source IP,
+	// when keyRecvLimit or ipRecvLimit are set.
+	keyRecvLimiters map[key.NodePublic]*sharedLimiter
+	ipRecvLimiters  map[netip.Addr]*sharedLimiter
+}
+
+// recvLimit is a token-bucket rate limit on received packet bytes.
+type recvLimit struct {
+	bytesPerSec int
+	burst       int
+}
+
+func newRecvLimit(bytesPerSec, burst int) *recvLimit {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = bytesPerSec // one second's worth
+	}
+	// Each packet must fit in the bucket, or it could never be sent.
+	if burst < MaxPacketSize {
+		burst = MaxPacketSize
+	}
+	return &recvLimit{bytesPerSec: bytesPerSec, burst: burst}
+}
+
+// sharedLimiter is a rate.Limiter shared by several connections,
+// reference counted so it can be deleted once they're all gone.
+type sharedLimiter struct {
+	lim  *rate.Limiter
+	refs int
 }
 
 // clientSet represents 1 or more *sclients.
@@ -181,10 +231,9 @@ type Server struct {
 //
 // All methods should only be called while holding Server.mu.
 //
-// TODO(bradfitz): Issue 2746: in the future we'll send some sort of
-// "health_error" frame to them that'll communicate to the end users
-// that they cloned a device key, and we'll also surface it in the
-// admin panel, etc.
+// When the connections of a dup set are seen sending interleaved with
+// each other, the key was likely cloned, and the server sends each of
+// them a frameHealth explaining so (Issue 2746).
 type clientSet interface {
 	// ActiveClient returns the most recently added client to
 	// the set, as long as it hasn't been disabled, in which
@@ -229,8 +278,20 @@ type dupClientSet struct {
 	// removed. When a member of set is removed, the same
 	// element(s) are removed from sendHistory.
 	sendHistory []*sclient
+
+	// fighting is whether members of set have been seen sending
+	// interleaved with each other, meaning the key is likely in
+	// use by more than one device. All members of a fighting set
+	// are sent dupClientHealthProblem.
+	fighting bool
 }
 
+// dupClientHealthProblem is the frameHealth message sent to the
+// connections of a fighting dupClientSet.
+const dupClientHealthProblem = "this node's key is in use by another device connected to the same DERP server; " +
+	"it was likely cloned, such as by copying Tailscale's state directory or a VM image. " +
+	"Each device needs its own node key; log out and back in on one of them"
+
 func (s *dupClientSet) ActiveClient() *sclient {
 	if s.last != nil && !s.last.isDisabled.Load() {
 		return s.last
@@ -317,6 +378,8 @@ func NewServer(privateKey key.NodePrivate, logf logger.Logf) *Server {
 		avgQueueDuration:     new(uint64),
 		tcpRtt:               metrics.LabelMap{Label: "le"},
 		keyOfAddr:            map[netip.AddrPort]key.NodePublic{},
+		keyRecvLimiters:      map[key.NodePublic]*sharedLimiter{},
+		ipRecvLimiters:       map[netip.Addr]*sharedLimiter{},
 	}
 	s.initMetacert()
 	s.packetsRecvDisco = s.packetsRecvByKind.Get("disco")
@@ -328,6 +391,8 @@ func NewServer(privateKey key.NodePrivate, logf logger.Logf) *Server {
 		s.packetsDroppedReason.Get("queue_head"),
 		s.packetsDroppedReason.Get("queue_tail"),
 		s.packetsDroppedReason.Get("write_error"),
+		s.packetsDroppedReason.Get("dup_client"),
+		s.packetsDroppedReason.Get("rate_limited"),
 	}
 	s.packetsDroppedTypeDisco = s.packetsDroppedType.Get("disco")
 	s.packetsDroppedTypeOther = s.packetsDroppedType.Get("other")
@@ -349,6 +414,61 @@ func (s *Server) SetVerifyClient(v bool) {
 	s.verifyClients = v
 }
 
+// ClientVerifier decides which clients may connect to a Server.
+type ClientVerifier interface {
+	// VerifyClient returns a non-nil error if the client with public
+	// key clientKey, connecting from remoteAddr, must be rejected.
+	// remoteAddr is the zero value if the client's address is unknown.
+	VerifyClient(ctx context.Context, clientKey key.NodePublic, remoteAddr netip.AddrPort) error
+}
+
+// SetVerifier sets the verifier that decides which clients may connect
+// to the server. It applies in addition to SetVerifyClient. Mesh peers,
+// which authenticate with the mesh key, aren't verified.
+//
+// It must be called before serving begins.
+func (s *Server) SetVerifier(v ClientVerifier) {
+	s.verifier = v
+}
+
+// LocalAPIVerifier is a ClientVerifier that only accepts the clients that
+// are the local tailscaled or one of its peers, as reported by its
+// LocalAPI. It's what SetVerifyClient uses.
+type LocalAPIVerifier struct{}
+
+func (LocalAPIVerifier) VerifyClient(ctx context.Context, clientKey key.NodePublic, remoteAddr netip.AddrPort) error {
+	status, err := tailscale.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query local tailscaled status: %w", err)
+	}
+	if clientKey == status.Self.PublicKey {
+		return nil
+	}
+	if _, exists := status.Peer[clientKey]; !exists {
+		return fmt.Errorf("client %v not in set of peers", clientKey)
+	}
+	return nil
+}
+
+// SetPerClientRateLimit limits the rate at which each client key may send
+// packets through the server to bytesPerSec, with bursts of up to burst
+// bytes. Packets over the limit are dropped. A bytesPerSec of zero means
+// no limit. If burst is zero, it defaults to one second's worth. Mesh
+// peers aren't limited.
+//
+// It must be called before serving begins.
+func (s *Server) SetPerClientRateLimit(bytesPerSec, burst int) {
+	s.keyRecvLimit = newRecvLimit(bytesPerSec, burst)
+}
+
+// SetPerIPRateLimit is like SetPerClientRateLimit, but limits the total
+// rate of the clients connecting from each source IP address.
+//
+// It must be called before serving begins.
+func (s *Server) SetPerIPRateLimit(bytesPerSec, burst int) {
+	s.ipRecvLimit = newRecvLimit(bytesPerSec, burst)
+}
+
 // HasMeshKey reports whether the server is configured with a mesh key.
 func (s *Server) HasMeshKey() bool { return s.meshKey != "" }
 
@@ -387,6 +507,71 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Drain prepares the server to be shut down for maintenance. It tells
+// the connected clients that the server is restarting, with the advisory
+// reconnectIn and tryFor durations described in ServerRestartingMessage.
+//
+// The server keeps accepting clients while draining, so clients with
+// nowhere else to go (such as when no load balancer sends their
+// reconnects to another server) stay connected until the server is
+// closed. They aren't told again that it's restarting.
+//
+// It then waits until all clients other than mesh peers have
+// disconnected, or until ctx is done, in which case it returns
+// ctx.Err().
+func (s *Server) Drain(ctx context.Context, reconnectIn, tryFor time.Duration) error {
+	s.mu.Lock()
+	if !s.draining {
+		s.draining = true
+		s.drainHint = ServerRestartingMessage{ReconnectIn: reconnectIn, TryFor: tryFor}
+		for _, cs := range s.clients {
+			cs.ForeachClient(func(c *sclient) {
+				c.requestRestartingLocked()
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for {
+		s.mu.Lock()
+		n := s.numNonMeshClientsLocked()
+		s.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// IsDraining reports whether Drain has been called.
+func (s *Server) IsDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// numNonMeshClientsLocked returns the number of connections from clients
+// other than mesh peers.
+//
+// s.mu must be held.
+func (s *Server) numNonMeshClientsLocked() int {
+	n := 0
+	for _, cs := range s.clients {
+		cs.ForeachClient(func(c *sclient) {
+			if !c.canMesh {
+				n++
+			}
+		})
+	}
+	return n
+}
+
 func (s *Server) isClosed() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -518,16 +703,69 @@ func (s *Server) registerClient(c *sclient) {
 		set.set[c] = true
 		set.last = c
 		set.sendHistory = append(set.sendHistory, c)
+		if set.fighting {
+			c.setHealthProblemLocked(dupClientHealthProblem)
+		}
 	}
 
 	if _, ok := s.clientsMesh[c.key]; !ok {
 		s.clientsMesh[c.key] = nil // just for varz of total users in cluster
 	}
 	s.keyOfAddr[c.remoteIPPort] = c.key
+	s.addRecvLimitersLocked(c)
 	s.curClients.Add(1)
 	s.broadcastPeerStateChangeLocked(c.key, true)
 }
 
+// addRecvLimitersLocked sets c's receive rate limiters, if the server
+// has rate limits, sharing them with the other connections of the same
+// client key and from the same source IP.
+//
+// s.mu must be held.
+func (s *Server) addRecvLimitersLocked(c *sclient) {
+	if c.canMesh {
+		return
+	}
+	if lim := s.keyRecvLimit; lim != nil {
+		c.keyRecvLimiter = acquireLimiterLocked(s.keyRecvLimiters, c.key, lim)
+	}
+	if lim := s.ipRecvLimit; lim != nil && c.remoteIPPort.IsValid() {
+		c.ipRecvLimiter = acquireLimiterLocked(s.ipRecvLimiters, c.remoteIPPort.Addr(), lim)
+	}
+}
+
+// removeRecvLimitersLocked releases the rate limiters set by
+// addRecvLimitersLocked.
+//
+// s.mu must be held.
+func (s *Server) removeRecvLimitersLocked(c *sclient) {
+	if c.keyRecvLimiter != nil {
+		releaseLimiterLocked(s.keyRecvLimiters, c.key)
+	}
+	if c.ipRecvLimiter != nil {
+		releaseLimiterLocked(s.ipRecvLimiters, c.remoteIPPort.Addr())
+	}
+}
+
+func acquireLimiterLocked[K comparable](m map[K]*sharedLimiter, k K, lim *recvLimit) *rate.Limiter {
+	sl, ok := m[k]
+	if !ok {
+		sl = &sharedLimiter{lim: rate.NewLimiter(rate.Limit(lim.bytesPerSec), lim.burst)}
+		m[k] = sl
+	}
+	sl.refs++
+	return sl.lim
+}
+
+func releaseLimiterLocked[K comparable](m map[K]*sharedLimiter, k K) {
+	if sl, ok := m[k]; ok {
+		sl.refs--
+		if sl.refs <= 0 {
+			delete(m, k)
+		}
+	}
+}
+
 // broadcastPeerStateChangeLocked enqueues a message to all watchers
 // (other DERP nodes in the region, or trusted clients) that peer's
 // presence changed.
@@ -575,6 +813,7 @@ func (s *Server) unregisterClient(c *sclient) {
 			}
 			remain.isDisabled.Store(false)
 			remain.isDup.Store(false)
+			remain.setHealthProblemLocked("")
 			s.clients[c.key] = singleClient{remain}
 		}
 	}
@@ -584,6 +823,7 @@ func (s *Server) unregisterClient(c *sclient) {
 	}
 
 	delete(s.keyOfAddr, c.remoteIPPort)
+	s.removeRecvLimitersLocked(c)
 
 	s.curClients.Add(-1)
 	if c.preferred {
@@ -655,7 +895,8 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 	if err != nil {
 		return fmt.Errorf("receive client key: %v", err)
 	}
-	if err := s.verifyClient(clientKey, clientInfo); err != nil {
+	remoteIPPort, _ := netip.ParseAddrPort(remoteAddr)
+	if err := s.verifyClient(ctx, clientKey, clientInfo, remoteIPPort); err != nil {
 		return fmt.Errorf("client %x rejected: %v", clientKey, err)
 	}
 
@@ -665,8 +906,6 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	remoteIPPort, _ := netip.ParseAddrPort(remoteAddr)
-
 	c := &sclient{
 		connNum:        connNum,
 		s:              s,
@@ -683,7 +922,9 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 		discoSendQueue: make(chan pkt, perClientSendQueueDepth),
 		sendPongCh:     make(chan [8]byte, 1),
 		peerGone:       make(chan key.NodePublic),
-		canMesh:        clientInfo.MeshKey != "" && clientInfo.MeshKey == s.meshKey,
+		healthUpdate:   make(chan struct{}, 1),
+		restarting:     make(chan struct{}, 1),
+		canMesh:        s.isMeshPeer(clientInfo),
 	}
 
 	if c.canMesh {
@@ -696,7 +937,7 @@ func (s *Server) accept(ctx context.Context, nc Conn, brw *bufio.ReadWriter, rem
 	s.registerClient(c)
 	defer s.unregisterClient(c)
 
-	err = s.sendServerInfo(c.bw, clientKey)
+	err = s.sendServerInfo(c.bw, clientKey, c.keyRecvLimiter != nil)
 	if err != nil {
 		return fmt.Errorf("send server info: %v", err)
 	}
@@ -911,6 +1152,10 @@ func (c *sclient) handleFrameSendPacket(ft frameType, fl uint32) error {
 	if err != nil {
 		return fmt.Errorf("client %x: recvPacket: %v", c.key, err)
 	}
+	if !c.allowRecv(len(contents)) {
+		s.recordDrop(contents, c.key, dstKey, dropReasonRateLimited)
+		return nil
+	}
 
 	var fwd PacketForwarder
 	var dstLen int
@@ -966,8 +1211,22 @@ func (c *sclient) handleFrameSendPacket(ft frameType, fl uint32) error {
 	dropReasonQueueTail                          // destination queue is full, dropped packet at queue tail
 	dropReasonWriteError                         // OS write() failed
 	dropReasonDupClient                          // the public key is connected 2+ times (active/active, fighting)
+	dropReasonRateLimited                        // the sender exceeded its per-client or per-IP rate limit
 )
 
+// allowRecv reports whether c may send a packet of n bytes under the
+// server's per-client and per-IP rate limits.
+func (c *sclient) allowRecv(n int) bool {
+	now := timeNow()
+	if c.keyRecvLimiter != nil && !c.keyRecvLimiter.AllowN(now, n) {
+		return false
+	}
+	if c.ipRecvLimiter != nil && !c.ipRecvLimiter.AllowN(now, n) {
+		return false
+	}
+	return true
+}
+
 func (s *Server) recordDrop(packetBytes []byte, srcKey, dstKey key.NodePublic, reason dropReason) {
 	s.packetsDropped.Add(1)
 	s.packetsDroppedReasonCounters[reason].Add(1)
@@ -1038,6 +1297,38 @@ func (c *sclient) requestPeerGoneWrite(peer key.NodePublic) {
 	}
 }
 
+// setHealthProblemLocked requests that the client be sent a frameHealth
+// with the given problem, or an empty one to clear a previously sent
+// problem. It's a no-op if that's what was last requested.
+//
+// s.mu must be held.
+func (c *sclient) setHealthProblemLocked(problem string) {
+	if c.healthProblem == problem {
+		return
+	}
+	c.healthProblem = problem
+	select {
+	case c.healthUpdate <- struct{}{}:
+	default:
+		// An update is already pending; it'll send the latest problem.
+	}
+}
+
+// requestRestartingLocked requests that the client be sent a
+// frameRestarting with the server's drain hint. Mesh peers aren't sent
+// one; they can stay connected until the server exits.
+//
+// s.mu must be held.
+func (c *sclient) requestRestartingLocked() {
+	if c.canMesh {
+		return
+	}
+	select {
+	case c.restarting <- struct{}{}:
+	default:
+	}
+}
+
 func (c *sclient) requestMeshUpdate() {
 	if !c.canMesh {
 		panic("unexpected requestMeshUpdate")
@@ -1048,21 +1339,36 @@ func (c *sclient) requestMeshUpdate() {
 	}
 }
 
-func (s *Server) verifyClient(clientKey key.NodePublic, info *clientInfo) error {
-	if !s.verifyClients {
+// isMeshPeer reports whether the client with the given info presented the
+// server's mesh key.
+func (s *Server) isMeshPeer(info *clientInfo) bool {
+	return info.MeshKey != "" && info.MeshKey == s.meshKey
+}
+
+// verifyClientTimeout is how long verifyClient waits for the verifiers
+// to decide. It matches the deadline for the client's handshake.
+const verifyClientTimeout = 10 * time.Second
+
+func (s *Server) verifyClient(ctx context.Context, clientKey key.NodePublic, info *clientInfo, remoteAddr netip.AddrPort) error {
+	if s.isMeshPeer(info) {
+		// Mesh peers are trusted by their key.
 		return nil
 	}
-	status, err := tailscale.Status(context.TODO())
-	if err != nil {
-		return fmt.Errorf("failed to query local tailscaled status: %w", err)
-	}
-	if clientKey == status.Self.PublicKey {
+	if !s.verifyClients && s.verifier == nil {
 		return nil
 	}
-	if _, exists := status.Peer[clientKey]; !exists {
-		return fmt.Errorf("client %v not in set of peers", clientKey)
+	ctx, cancel := context.WithTimeout(ctx, verifyClientTimeout)
+	defer cancel()
+	if s.verifyClients {
+		if err := (LocalAPIVerifier{}).VerifyClient(ctx, clientKey, remoteAddr); err != nil {
+			return err
+		}
+	}
+	if s.verifier != nil {
+		if err := s.verifier.VerifyClient(ctx, clientKey, remoteAddr); err != nil {
+			return err
+		}
 	}
-	// TODO(bradfitz): add policy for configurable bandwidth rate per client?
 	return nil
 }
 
@@ -1110,15 +1416,22 @@ func (s *Server) noteClientActivity(c *sclient) {
 	}
 
 	// If we saw this connection send previously, then consider
-	// the group fighting and disable them all.
-	if s.dupPolicy == disableFighters {
-		for _, prior := range ds.sendHistory {
-			if prior == c {
-				ds.ForeachClient(func(c *sclient) {
-					c.isDisabled.Store(true)
-				})
-				break
+	// the group fighting: tell them all and, depending on the
+	// policy, disable them all.
+	for _, prior := range ds.sendHistory {
+		if prior == c {
+			if !ds.fighting {
+				ds.fighting = true
+				s.dupClientKeysFighting.Add(1)
+				c.logf("key is in use by %d fighting connections; likely cloned", ds.Len())
 			}
+			ds.ForeachClient(func(c *sclient) {
+				c.setHealthProblemLocked(dupClientHealthProblem)
+				if s.dupPolicy == disableFighters {
+					c.isDisabled.Store(true)
+				}
+			})
+			break
 		}
 	}
 
@@ -1133,8 +1446,16 @@ type serverInfo struct {
 	TokenBucketBytesBurst     int `json:",omitempty"`
 }
 
-func (s *Server) sendServerInfo(bw *lazyBufioWriter, clientKey key.NodePublic) error {
-	msg, err := json.Marshal(serverInfo{Version: ProtocolVersion})
+// sendServerInfo sends the frameServerInfo frame to the client. If
+// rateLimited, it includes the per-client rate limit, so the client can
+// pace its sends rather than have packets dropped.
+func (s *Server) sendServerInfo(bw *lazyBufioWriter, clientKey key.NodePublic, rateLimited bool) error {
+	si := serverInfo{Version: ProtocolVersion}
+	if lim := s.keyRecvLimit; rateLimited && lim != nil {
+		si.TokenBucketBytesPerSecond = lim.bytesPerSec
+		si.TokenBucketBytesBurst = lim.burst
+	}
+	msg, err := json.Marshal(si)
 	if err != nil {
 		return err
 	}
@@ -1255,6 +1576,8 @@ type sclient struct {
 	sendPongCh     chan [8]byte        // pong replies to send to the client; never closed
 	peerGone       chan key.NodePublic // write request that a previous sender has disconnected (not used by mesh peers)
 	meshUpdate     chan struct{}       // write request to write peerStateChange
+	healthUpdate   chan struct{}       // write request to write healthProblem; buffered
+	restarting     chan struct{}       // write request to write frameRestarting; buffered
 	canMesh        bool                // clientInfo had correct mesh token for inter-region routing
 	isDup          atomic.Bool         // whether more than 1 sclient for key is connected
 	isDisabled     atomic.Bool         // whether sends to this peer are disabled due to active/active dups
@@ -1264,6 +1587,13 @@ type sclient struct {
 	// taking over ownership of a key.
 	replaceLimiter *rate.Limiter
 
+	// keyRecvLimiter and ipRecvLimiter, if non-nil, limit the rate
+	// of packets this client may send. They're shared with the other
+	// connections of the same key and from the same IP, respectively.
+	// They're set at registration and not modified after.
+	keyRecvLimiter *rate.Limiter
+	ipRecvLimiter  *rate.Limiter
+
 	// Owned by run, not thread-safe.
 	br          *bufio.Reader
 	connectedAt time.Time
@@ -1279,6 +1609,11 @@ type sclient struct {
 	// the client for them to update their map of who's connected
 	// to this node.
 	peerStateChange []peerConnState
+
+	// healthProblem is the problem most recently requested to be
+	// sent to the client in a frameHealth, or empty if the
+	// connection is healthy. Guarded by s.mu.
+	healthProblem string
 }
 
 // peerConnState represents whether a peer is connected to the server
@@ -1385,6 +1720,12 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 		case <-c.meshUpdate:
 			werr = c.sendMeshUpdates()
 			continue
+		case <-c.healthUpdate:
+			werr = c.sendHealth()
+			continue
+		case <-c.restarting:
+			werr = c.sendRestarting()
+			continue
 		case msg := <-c.sendQueue:
 			werr = c.sendPacket(msg.src, msg.bs)
 			c.recordQueueTime(msg.enqueuedAt)
@@ -1416,6 +1757,10 @@ func (c *sclient) sendLoop(ctx context.Context) error {
 		case <-c.meshUpdate:
 			werr = c.sendMeshUpdates()
 			continue
+		case <-c.healthUpdate:
+			werr = c.sendHealth()
+		case <-c.restarting:
+			werr = c.sendRestarting()
 		case msg := <-c.sendQueue:
 			werr = c.sendPacket(msg.src, msg.bs)
 			c.recordQueueTime(msg.enqueuedAt)
@@ -1463,6 +1808,37 @@ func (c *sclient) sendPeerGone(peer key.NodePublic) error {
 	return err
 }
 
+// sendHealth sends a frameHealth with the client's current health
+// problem, without flushing.
+func (c *sclient) sendHealth() error {
+	c.s.mu.Lock()
+	problem := c.healthProblem
+	c.s.mu.Unlock()
+	c.setWriteDeadline()
+	if err := writeFrameHeader(c.bw.bw(), frameHealth, uint32(len(problem))); err != nil {
+		return err
+	}
+	_, err := c.bw.Write([]byte(problem))
+	return err
+}
+
+// sendRestarting sends a frameRestarting with the server's drain hint,
+// without flushing.
+func (c *sclient) sendRestarting() error {
+	c.s.mu.Lock()
+	hint := c.s.drainHint
+	c.s.mu.Unlock()
+	c.setWriteDeadline()
+	if err := writeFrameHeader(c.bw.bw(), frameRestarting, 8); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[0:4], uint32(hint.ReconnectIn.Milliseconds()))
+	binary.BigEndian.PutUint32(b[4:8], uint32(hint.TryFor.Milliseconds()))
+	_, err := c.bw.Write(b[:])
+	return err
+}
+
 // sendPeerPresent sends a peerPresent frame, without flushing.
 func (c *sclient) sendPeerPresent(peer key.NodePublic) error {
 	c.setWriteDeadline()
@@ -1712,6 +2088,7 @@ func (s *Server) ExpVar() expvar.Var {
 	m.Set("gauge_current_dup_client_keys", &s.dupClientKeys)
 	m.Set("gauge_current_dup_client_conns", &s.dupClientConns)
 	m.Set("counter_total_dup_client_conns", &s.dupClientConnTotal)
+	m.Set("counter_total_dup_client_keys_fighting", &s.dupClientKeysFighting)
 	m.Set("accepts", &s.accepts)
 	m.Set("bytes_received", &s.bytesRecv)
 	m.Set("bytes_sent", &s.bytesSent)
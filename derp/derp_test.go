@@ -17,6 +17,7 @@
 	"io"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"reflect"
 	"strconv"
@@ -1079,6 +1080,12 @@ func TestServerDupClients(t *testing.T) {
 			t.Errorf("client %q isDisabled = %v; want %v", clientName[c], got, want)
 		}
 	}
+	checkHealth := func(t *testing.T, c *sclient, want string) {
+		t.Helper()
+		if got := c.healthProblem; got != want {
+			t.Errorf("client %q healthProblem = %q; want %q", clientName[c], got, want)
+		}
+	}
 	wantDupConns := func(t *testing.T, want int) {
 		t.Helper()
 		if got := s.dupClientConns.Value(); got != int64(want) {
@@ -1154,14 +1161,18 @@ func TestServerDupClients(t *testing.T) {
 		s.noteClientActivity(c2)
 		checkDisabled(t, c1, false)
 		checkDisabled(t, c2, false)
+		checkHealth(t, c1, "")
 		s.noteClientActivity(c1)
 		checkDisabled(t, c1, true)
 		checkDisabled(t, c2, true)
+		checkHealth(t, c1, dupClientHealthProblem)
+		checkHealth(t, c2, dupClientHealthProblem)
 		wantActive(t, nil)
 
 		s.registerClient(c3)
 		wantActive(t, c3)
 		checkDisabled(t, c3, false)
+		checkHealth(t, c3, dupClientHealthProblem)
 		wantDupKeys(t, 1)
 		wantDupConns(t, 3)
 
@@ -1172,10 +1183,34 @@ func TestServerDupClients(t *testing.T) {
 
 		s.unregisterClient(c2)
 		wantSingleClient(t, c1)
+		checkHealth(t, c1, "")
 		wantDupKeys(t, 0)
 		wantDupConns(t, 0)
 	})
 
+	// Key cloning is reported to the clients even when the policy
+	// keeps them enabled.
+	run("concurrent_dups_get_health", lastWriterIsActive, func(t *testing.T) {
+		s.registerClient(c1)
+		s.registerClient(c2)
+		s.noteClientActivity(c2)
+		checkHealth(t, c1, "")
+		checkHealth(t, c2, "")
+		s.noteClientActivity(c1)
+		checkDisabled(t, c1, false)
+		checkDisabled(t, c2, false)
+		checkHealth(t, c1, dupClientHealthProblem)
+		checkHealth(t, c2, dupClientHealthProblem)
+		wantActive(t, c1)
+		if got := s.dupClientKeysFighting.Value(); got != 1 {
+			t.Errorf("dupClientKeysFighting = %v; want 1", got)
+		}
+
+		s.unregisterClient(c1)
+		wantSingleClient(t, c2)
+		checkHealth(t, c2, "")
+	})
+
 	// Key cloning with an A->B->C->A series instead.
 	run("concurrent_dups_three_parties", disableFighters, func(t *testing.T) {
 		wantNoClient(t)
@@ -1231,6 +1266,156 @@ func TestServerDupClients(t *testing.T) {
 	})
 }
 
+func TestServerRecvRateLimit(t *testing.T) {
+	now := time.Unix(1670000000, 0)
+	defer func(old func() time.Time) { timeNow = old }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	s := NewServer(key.NewNode(), t.Logf)
+	defer s.Close()
+	s.SetPerClientRateLimit(1000, 0) // burst defaults to MaxPacketSize
+	s.SetPerIPRateLimit(1000, 2*MaxPacketSize)
+
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	newClient := func(k key.NodePublic, ipPort string) *sclient {
+		c := &sclient{key: k, logf: t.Logf, remoteIPPort: netip.MustParseAddrPort(ipPort)}
+		s.registerClient(c)
+		return c
+	}
+	c1 := newClient(k1, "1.2.3.4:1000")
+	c1dup := newClient(k1, "1.2.3.4:1001") // same key and IP
+	c2 := newClient(k2, "1.2.3.4:1002")    // same IP only
+	if c1.keyRecvLimiter != c1dup.keyRecvLimiter || c1.keyRecvLimiter == c2.keyRecvLimiter {
+		t.Fatal("key limiters not shared by key")
+	}
+	if c1.ipRecvLimiter != c2.ipRecvLimiter {
+		t.Fatal("IP limiters not shared by IP")
+	}
+
+	if !c1.allowRecv(MaxPacketSize) {
+		t.Fatal("first packet not allowed")
+	}
+	if c1dup.allowRecv(1) {
+		t.Fatal("c1dup allowed past its key's limit")
+	}
+	if !c2.allowRecv(MaxPacketSize) {
+		t.Fatal("c2 not allowed")
+	}
+	if c2.allowRecv(MaxPacketSize) {
+		t.Fatal("c2 allowed past its key's limit")
+	}
+	now = now.Add(time.Second)
+	if !c1.allowRecv(1000) {
+		t.Fatal("not allowed after refill")
+	}
+
+	s.recordDrop(nil, k1, k2, dropReasonRateLimited)
+	if got := s.packetsDroppedReason.Get("rate_limited").Value(); got != 1 {
+		t.Errorf("rate_limited drops = %v; want 1", got)
+	}
+
+	for _, c := range []*sclient{c1, c1dup, c2} {
+		s.unregisterClient(c)
+	}
+	if len(s.keyRecvLimiters) != 0 || len(s.ipRecvLimiters) != 0 {
+		t.Errorf("limiters leaked: %d by key, %d by IP", len(s.keyRecvLimiters), len(s.ipRecvLimiters))
+	}
+
+	mesh := &sclient{key: key.NewNode().Public(), logf: t.Logf, canMesh: true}
+	s.registerClient(mesh)
+	if mesh.keyRecvLimiter != nil || mesh.ipRecvLimiter != nil {
+		t.Error("mesh peer is rate limited")
+	}
+}
+
+type verifierFunc func(key.NodePublic, netip.AddrPort) error
+
+func (f verifierFunc) VerifyClient(_ context.Context, k key.NodePublic, addr netip.AddrPort) error {
+	return f(k, addr)
+}
+
+func TestServerVerifier(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(key.NewNode(), t.Logf)
+	defer s.Close()
+	s.SetMeshKey("mesh-key")
+
+	allowed := key.NewNode().Public()
+	src := netip.MustParseAddrPort("1.2.3.4:567")
+	s.SetVerifier(verifierFunc(func(k key.NodePublic, addr netip.AddrPort) error {
+		if addr != src {
+			t.Errorf("verifier got addr %v; want %v", addr, src)
+		}
+		if k != allowed {
+			return errors.New("denied")
+		}
+		return nil
+	}))
+
+	if err := s.verifyClient(ctx, allowed, &clientInfo{}, src); err != nil {
+		t.Errorf("allowed client rejected: %v", err)
+	}
+	other := key.NewNode().Public()
+	if err := s.verifyClient(ctx, other, &clientInfo{}, src); err == nil {
+		t.Error("denied client accepted")
+	}
+	if err := s.verifyClient(ctx, other, &clientInfo{MeshKey: "mesh-key"}, src); err != nil {
+		t.Errorf("mesh peer rejected: %v", err)
+	}
+}
+
+func TestServerDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := newTestServer(t, ctx)
+	defer ts.close(t)
+
+	c1 := newRegularClient(t, ts, "c1")
+	w := newTestWatcher(t, ts, "w")
+	w.wantPresent(t, c1.pub, w.pub)
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- ts.s.Drain(ctx, 5*time.Second, 2*time.Second)
+	}()
+
+	m, err := c1.c.recvTimeout(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ServerRestartingMessage{ReconnectIn: 5 * time.Second, TryFor: 2 * time.Second}
+	if m != want {
+		t.Fatalf("got %#v; want %#v", m, want)
+	}
+
+	// Reconnects are still accepted while draining, and not told
+	// again that the server is restarting.
+	c2 := newRegularClient(t, ts, "c2")
+	w.wantPresent(t, c2.pub)
+	if m, err := c2.c.recvTimeout(200 * time.Millisecond); err == nil {
+		t.Fatalf("client connected while draining got %#v", m)
+	}
+	c2.close(t)
+
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned %v with a client connected", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	c1.close(t)
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("Drain: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain didn't return after the client left")
+	}
+	if !ts.s.IsDraining() {
+		t.Error("IsDraining = false after Drain")
+	}
+}
+
 func TestLimiter(t *testing.T) {
 	rl := rate.NewLimiter(rate.Every(time.Minute), 100)
 	for i := 0; i < 200; i++ {
@@ -36,6 +36,7 @@
 	"tailscale.com/net/tshttpproxy"
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
+	"tailscale.com/tstime"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/util/strs"
@@ -80,6 +81,10 @@ type Client struct {
 	serverPubKey key.NodePublic
 	tlsState     *tls.ConnectionState
 	pingOut      map[derp.PingMessage]chan<- bool // chan to send to on pong
+
+	// retryUntil, if non-zero, is until when Recv hides errors and
+	// reconnects after the server said it was restarting.
+	retryUntil time.Time
 }
 
 // NewRegionClient returns a new DERP-over-HTTP client. It connects lazily.
@@ -953,7 +958,27 @@ func (c *Client) Recv() (derp.ReceivedMessage, error) {
 
 // RecvDetail is like Recv, but additional returns the connection generation on each message.
 // The connGen value is incremented every time the derphttp.Client reconnects to the server.
+//
+// After the server says it's restarting, RecvDetail reconnects without
+// returning errors for as long as the server advised.
 func (c *Client) RecvDetail() (m derp.ReceivedMessage, connGen int, err error) {
+	for {
+		m, connGen, err = c.recvDetail()
+		if err == nil || err == ErrClientClosed || !c.retryingAfterRestart() {
+			return m, connGen, err
+		}
+		c.logf("derphttp.Client.Recv: reconnecting after server restart: %v", err)
+		t := time.NewTimer(tstime.RandomDurationBetween(250*time.Millisecond, time.Second))
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			t.Stop()
+			return nil, 0, ErrClientClosed
+		}
+	}
+}
+
+func (c *Client) recvDetail() (m derp.ReceivedMessage, connGen int, err error) {
 	client, connGen, err := c.connect(context.TODO(), "derphttp.Client.Recv")
 	if err != nil {
 		return nil, 0, err
@@ -965,6 +990,12 @@ func (c *Client) RecvDetail() (m derp.ReceivedMessage, connGen int, err error) {
 			if c.handledPong(m) {
 				continue
 			}
+		case derp.ServerInfoMessage:
+			c.mu.Lock()
+			c.retryUntil = time.Time{} // reconnected
+			c.mu.Unlock()
+		case derp.ServerRestartingMessage:
+			c.noteServerRestarting(client, m)
 		}
 		if err != nil {
 			c.closeForReconnect(client)
@@ -976,6 +1007,39 @@ func (c *Client) RecvDetail() (m derp.ReceivedMessage, connGen int, err error) {
 	}
 }
 
+// noteServerRestarting handles the server's notice that it's restarting,
+// sent on client. After a random fraction of the server's advised
+// ReconnectIn delay, so that its clients don't all reconnect at once, it
+// closes the connection so that Recv reconnects, retrying for up to
+// TryFor.
+func (c *Client) noteServerRestarting(client *derp.Client, m derp.ServerRestartingMessage) {
+	delay := tstime.RandomDurationBetween(0, m.ReconnectIn)
+	c.logf("derphttp.Client: server restarting; reconnecting in %v", delay.Round(time.Millisecond))
+	time.AfterFunc(delay, func() {
+		c.mu.Lock()
+		if c.client == client {
+			c.retryUntil = time.Now().Add(m.TryFor)
+		}
+		c.mu.Unlock()
+		c.closeForReconnect(client)
+	})
+}
+
+// retryingAfterRestart reports whether Recv should keep reconnecting
+// after the server said it was restarting.
+func (c *Client) retryingAfterRestart() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.retryUntil.IsZero() {
+		return false
+	}
+	if time.Now().After(c.retryUntil) {
+		c.retryUntil = time.Time{}
+		return false
+	}
+	return true
+}
+
 func (c *Client) isClosed() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
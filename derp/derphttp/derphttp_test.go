@@ -206,3 +206,60 @@ func TestPing(t *testing.T) {
 		t.Fatalf("Ping: %v", err)
 	}
 }
+
+func TestServerRestartingReconnect(t *testing.T) {
+	s := derp.NewServer(key.NewNode(), t.Logf)
+	defer s.Close()
+
+	httpsrv := &http.Server{
+		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+		Handler:      Handler(s),
+	}
+	ln, err := net.Listen("tcp4", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpsrv.Close()
+	go httpsrv.Serve(ln)
+
+	c, err := NewClient(key.NewNode(), "http://"+ln.Addr().String(), t.Logf)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("client Connect: %v", err)
+	}
+	waitConnect(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const tryFor = 500 * time.Millisecond
+	drained := make(chan error, 1)
+	go func() {
+		drained <- s.Drain(ctx, 100*time.Millisecond, tryFor)
+	}()
+
+	m, err := c.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(derp.ServerRestartingMessage); !ok {
+		t.Fatalf("got %T; want ServerRestartingMessage", m)
+	}
+	// The client disconnects on its own, within the advised delay.
+	if err := <-drained; err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	// The server goes away, and the client keeps trying to reconnect
+	// for tryFor before Recv gives up.
+	httpsrv.Close()
+	start := time.Now()
+	if _, err := c.Recv(); err == nil {
+		t.Fatal("reconnected to closed server")
+	}
+	if d := time.Since(start); d < tryFor-100*time.Millisecond {
+		t.Errorf("gave up reconnecting after %v; want about %v", d, tryFor)
+	}
+}
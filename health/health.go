@@ -26,30 +26,84 @@
 	// mu guards everything in this var block.
 	mu sync.Mutex
 
-	sysErr    = map[Subsystem]error{}                   // error key => err (or nil for no error)
-	watchers  = set.HandleSet[func(Subsystem, error)]{} // opt func to run if error state changes
-	warnables = map[*Warnable]struct{}{}                // set of warnables
-	timer     *time.Timer
-
 	debugHandler = map[string]http.Handler{}
+)
+
+// warnables is the set of warnables. It's copied on write (under mu) so
+// that Trackers can read it while holding their own mu without taking
+// the package-level mu.
+var warnables atomic.Pointer[[]*Warnable]
+
+// global is the process-wide Tracker used by the package-level
+// functions.
+var global = NewTracker()
+
+// Global returns the process-wide Tracker used by the package-level
+// functions.
+func Global() *Tracker { return global }
+
+// Tracker tracks the health of a single Tailscale node.
+//
+// Most programs run a single node per process and use the package-level
+// functions, which operate on the Tracker returned by Global. Programs
+// running several nodes in one process (such as tsnet) create a Tracker
+// per node with NewTracker.
+//
+// Warnables and debug handlers are process-wide and are reported by every
+// Tracker.
+type Tracker struct {
+	// ReceiveIPv4, ReceiveIPv6 and ReceiveDERP track the calls made to
+	// this node's wireguard-go receive funcs.
+	ReceiveIPv4 ReceiveFuncStats
+	ReceiveIPv6 ReceiveFuncStats
+	ReceiveDERP ReceiveFuncStats
+
+	// mu guards everything below.
+	mu sync.Mutex
+
+	sysErr       map[Subsystem]error                   // error key => err (or nil for no error)
+	watchers     set.HandleSet[func(Subsystem, error)] // opt func to run if error state changes
+	timer        *time.Timer
+	receiveFuncs []*ReceiveFuncStats
 
 	inMapPoll               bool
 	inMapPollSince          time.Time
 	lastMapPollEndedAt      time.Time
 	lastStreamedMapResponse time.Time
 	derpHomeRegion          int
-	derpRegionConnected     = map[int]bool{}
-	derpRegionHealthProblem = map[int]string{}
-	derpRegionLastFrame     = map[int]time.Time{}
+	derpRegionConnected     map[int]bool
+	derpRegionHealthProblem map[int]string
+	derpRegionLastFrame     map[int]time.Time
 	lastMapRequestHeard     time.Time // time we got a 200 from control for a MapRequest
 	ipnState                string
 	ipnWantRunning          bool
-	anyInterfaceUp          = true // until told otherwise
+	anyInterfaceUp          bool
 	udp4Unbound             bool
 	controlHealth           []string
 	lastLoginErr            error
 	localLogConfigErr       error
-)
+}
+
+// NewTracker returns a new Tracker with no recorded state.
+func NewTracker() *Tracker {
+	t := &Tracker{
+		ReceiveIPv4: ReceiveFuncStats{name: "ReceiveIPv4"},
+		ReceiveIPv6: ReceiveFuncStats{name: "ReceiveIPv6"},
+		ReceiveDERP: ReceiveFuncStats{name: "ReceiveDERP"},
+
+		sysErr:                  map[Subsystem]error{},
+		watchers:                set.HandleSet[func(Subsystem, error)]{},
+		derpRegionConnected:     map[int]bool{},
+		derpRegionHealthProblem: map[int]string{},
+		derpRegionLastFrame:     map[int]time.Time{},
+		anyInterfaceUp:          true, // until told otherwise
+	}
+	t.receiveFuncs = []*ReceiveFuncStats{&t.ReceiveIPv4, &t.ReceiveIPv6, &t.ReceiveDERP}
+	if runtime.GOOS == "js" {
+		t.receiveFuncs = t.receiveFuncs[2:] // ignore IPv4 and IPv6
+	}
+	return t
+}
 
 // Subsystem is the name of a subsystem whose health can be monitored.
 type Subsystem string
@@ -81,10 +135,24 @@ func NewWarnable(opts ...WarnableOpt) *Warnable {
 	}
 	mu.Lock()
 	defer mu.Unlock()
-	warnables[w] = struct{}{}
+	var ws []*Warnable
+	if old := warnables.Load(); old != nil {
+		ws = append(ws, *old...)
+	}
+	ws = append(ws, w)
+	warnables.Store(&ws)
 	return w
 }
 
+// allWarnables returns the set of warnables created by NewWarnable.
+// The returned slice must not be modified.
+func allWarnables() []*Warnable {
+	if ws := warnables.Load(); ws != nil {
+		return *ws
+	}
+	return nil
+}
+
 // WarnableOpt is an option passed to NewWarnable.
 type WarnableOpt interface {
 	mod(*Warnable)
@@ -136,9 +204,7 @@ func (w *Warnable) get() error {
 func AppendWarnableDebugFlags(base []string) []string {
 	ret := base
 
-	mu.Lock()
-	defer mu.Unlock()
-	for w := range warnables {
+	for _, w := range allWarnables() {
 		if w.debugFlag == "" {
 			continue
 		}
@@ -155,50 +221,80 @@ func AppendWarnableDebugFlags(base []string) []string {
 // not called on transition from unknown to healthy. It must be non-nil
 // and is run in its own goroutine. The returned func unregisters it.
 func RegisterWatcher(cb func(key Subsystem, err error)) (unregister func()) {
-	mu.Lock()
-	defer mu.Unlock()
-	handle := watchers.Add(cb)
-	if timer == nil {
-		timer = time.AfterFunc(time.Minute, timerSelfCheck)
+	return global.RegisterWatcher(cb)
+}
+
+// RegisterWatcher is like the package-level RegisterWatcher, but for t.
+func (t *Tracker) RegisterWatcher(cb func(key Subsystem, err error)) (unregister func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	handle := t.watchers.Add(cb)
+	if t.timer == nil {
+		t.timer = time.AfterFunc(time.Minute, t.timerSelfCheck)
 	}
 	return func() {
-		mu.Lock()
-		defer mu.Unlock()
-		delete(watchers, handle)
-		if len(watchers) == 0 && timer != nil {
-			timer.Stop()
-			timer = nil
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.watchers, handle)
+		if len(t.watchers) == 0 && t.timer != nil {
+			t.timer.Stop()
+			t.timer = nil
 		}
 	}
 }
 
 // SetRouterHealth sets the state of the wgengine/router.Router.
-func SetRouterHealth(err error) { setErr(SysRouter, err) }
+func SetRouterHealth(err error) { global.SetRouterHealth(err) }
+
+// SetRouterHealth sets the state of the wgengine/router.Router.
+func (t *Tracker) SetRouterHealth(err error) { t.setErr(SysRouter, err) }
 
 // RouterHealth returns the wgengine/router.Router error state.
-func RouterHealth() error { return get(SysRouter) }
+func RouterHealth() error { return global.RouterHealth() }
+
+// RouterHealth returns the wgengine/router.Router error state.
+func (t *Tracker) RouterHealth() error { return t.get(SysRouter) }
+
+// SetDNSHealth sets the state of the net/dns.Manager
+func SetDNSHealth(err error) { global.SetDNSHealth(err) }
 
 // SetDNSHealth sets the state of the net/dns.Manager
-func SetDNSHealth(err error) { setErr(SysDNS, err) }
+func (t *Tracker) SetDNSHealth(err error) { t.setErr(SysDNS, err) }
 
 // DNSHealth returns the net/dns.Manager error state.
-func DNSHealth() error { return get(SysDNS) }
+func DNSHealth() error { return global.DNSHealth() }
+
+// DNSHealth returns the net/dns.Manager error state.
+func (t *Tracker) DNSHealth() error { return t.get(SysDNS) }
+
+// SetDNSOSHealth sets the state of the net/dns.OSConfigurator
+func SetDNSOSHealth(err error) { global.SetDNSOSHealth(err) }
 
 // SetDNSOSHealth sets the state of the net/dns.OSConfigurator
-func SetDNSOSHealth(err error) { setErr(SysDNSOS, err) }
+func (t *Tracker) SetDNSOSHealth(err error) { t.setErr(SysDNSOS, err) }
 
 // SetDNSManagerHealth sets the state of the Linux net/dns manager's
 // discovery of the /etc/resolv.conf situation.
-func SetDNSManagerHealth(err error) { setErr(SysDNSManager, err) }
+func SetDNSManagerHealth(err error) { global.SetDNSManagerHealth(err) }
+
+// SetDNSManagerHealth sets the state of the Linux net/dns manager's
+// discovery of the /etc/resolv.conf situation.
+func (t *Tracker) SetDNSManagerHealth(err error) { t.setErr(SysDNSManager, err) }
 
 // DNSOSHealth returns the net/dns.OSConfigurator error state.
-func DNSOSHealth() error { return get(SysDNSOS) }
+func DNSOSHealth() error { return global.DNSOSHealth() }
+
+// DNSOSHealth returns the net/dns.OSConfigurator error state.
+func (t *Tracker) DNSOSHealth() error { return t.get(SysDNSOS) }
 
 // SetLocalLogConfigHealth sets the error state of this client's local log configuration.
-func SetLocalLogConfigHealth(err error) {
-	mu.Lock()
-	defer mu.Unlock()
-	localLogConfigErr = err
+func SetLocalLogConfigHealth(err error) { global.SetLocalLogConfigHealth(err) }
+
+// SetLocalLogConfigHealth sets the error state of this client's local log configuration.
+func (t *Tracker) SetLocalLogConfigHealth(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.localLogConfigErr = err
 }
 
 func RegisterDebugHandler(typ string, h http.Handler) {
@@ -213,24 +309,24 @@ func DebugHandler(typ string) http.Handler {
 	return debugHandler[typ]
 }
 
-func get(key Subsystem) error {
-	mu.Lock()
-	defer mu.Unlock()
-	return sysErr[key]
+func (t *Tracker) get(key Subsystem) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sysErr[key]
 }
 
-func setErr(key Subsystem, err error) {
-	mu.Lock()
-	defer mu.Unlock()
-	setLocked(key, err)
+func (t *Tracker) setErr(key Subsystem, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setLocked(key, err)
 }
 
-func setLocked(key Subsystem, err error) {
-	old, ok := sysErr[key]
+func (t *Tracker) setLocked(key Subsystem, err error) {
+	old, ok := t.sysErr[key]
 	if !ok && err == nil {
 		// Initial happy path.
-		sysErr[key] = nil
-		selfCheckLocked()
+		t.sysErr[key] = nil
+		t.selfCheckLocked()
 		return
 	}
 	if ok && (old == nil) == (err == nil) {
@@ -238,231 +334,288 @@ func setLocked(key Subsystem, err error) {
 		// don't run callbacks, but exact error might've
 		// changed, so note it.
 		if err != nil {
-			sysErr[key] = err
+			t.sysErr[key] = err
 		}
 		return
 	}
-	sysErr[key] = err
-	selfCheckLocked()
-	for _, cb := range watchers {
+	t.sysErr[key] = err
+	t.selfCheckLocked()
+	for _, cb := range t.watchers {
 		go cb(key, err)
 	}
 }
 
-func SetControlHealth(problems []string) {
-	mu.Lock()
-	defer mu.Unlock()
-	controlHealth = problems
-	selfCheckLocked()
+func SetControlHealth(problems []string) { global.SetControlHealth(problems) }
+
+// SetControlHealth sets the health problems reported by the control plane.
+func (t *Tracker) SetControlHealth(problems []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.controlHealth = problems
+	t.selfCheckLocked()
 }
 
 // GotStreamedMapResponse notes that we got a tailcfg.MapResponse
 // message in streaming mode, even if it's just a keep-alive message.
-func GotStreamedMapResponse() {
-	mu.Lock()
-	defer mu.Unlock()
-	lastStreamedMapResponse = time.Now()
-	selfCheckLocked()
+func GotStreamedMapResponse() { global.GotStreamedMapResponse() }
+
+// GotStreamedMapResponse notes that we got a tailcfg.MapResponse
+// message in streaming mode, even if it's just a keep-alive message.
+func (t *Tracker) GotStreamedMapResponse() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastStreamedMapResponse = time.Now()
+	t.selfCheckLocked()
 }
 
 // SetInPollNetMap records whether the client has an open
 // HTTP long poll open to the control plane.
-func SetInPollNetMap(v bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	if v == inMapPoll {
+func SetInPollNetMap(v bool) { global.SetInPollNetMap(v) }
+
+// SetInPollNetMap records whether the client has an open
+// HTTP long poll open to the control plane.
+func (t *Tracker) SetInPollNetMap(v bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v == t.inMapPoll {
 		return
 	}
-	inMapPoll = v
+	t.inMapPoll = v
 	if v {
-		inMapPollSince = time.Now()
+		t.inMapPollSince = time.Now()
 	} else {
-		lastMapPollEndedAt = time.Now()
+		t.lastMapPollEndedAt = time.Now()
 	}
 }
 
 // GetInPollNetMap reports whether the client has an open
 // HTTP long poll open to the control plane.
-func GetInPollNetMap() bool {
-	mu.Lock()
-	defer mu.Unlock()
-	return inMapPoll
+func GetInPollNetMap() bool { return global.GetInPollNetMap() }
+
+// GetInPollNetMap reports whether the client has an open
+// HTTP long poll open to the control plane.
+func (t *Tracker) GetInPollNetMap() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inMapPoll
 }
 
 // SetMagicSockDERPHome notes what magicsock's view of its home DERP is.
-func SetMagicSockDERPHome(region int) {
-	mu.Lock()
-	defer mu.Unlock()
-	derpHomeRegion = region
-	selfCheckLocked()
+func SetMagicSockDERPHome(region int) { global.SetMagicSockDERPHome(region) }
+
+// SetMagicSockDERPHome notes what magicsock's view of its home DERP is.
+func (t *Tracker) SetMagicSockDERPHome(region int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.derpHomeRegion = region
+	t.selfCheckLocked()
 }
 
 // NoteMapRequestHeard notes whenever we successfully sent a map request
 // to control for which we received a 200 response.
-func NoteMapRequestHeard(mr *tailcfg.MapRequest) {
-	mu.Lock()
-	defer mu.Unlock()
+func NoteMapRequestHeard(mr *tailcfg.MapRequest) { global.NoteMapRequestHeard(mr) }
+
+// NoteMapRequestHeard notes whenever we successfully sent a map request
+// to control for which we received a 200 response.
+func (t *Tracker) NoteMapRequestHeard(mr *tailcfg.MapRequest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	// TODO: extract mr.HostInfo.NetInfo.PreferredDERP, compare
 	// against SetMagicSockDERPHome and
 	// SetDERPRegionConnectedState
 
-	lastMapRequestHeard = time.Now()
-	selfCheckLocked()
+	t.lastMapRequestHeard = time.Now()
+	t.selfCheckLocked()
 }
 
 func SetDERPRegionConnectedState(region int, connected bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	derpRegionConnected[region] = connected
-	selfCheckLocked()
+	global.SetDERPRegionConnectedState(region, connected)
+}
+
+// SetDERPRegionConnectedState notes whether magicsock is connected
+// to the provided DERP region.
+func (t *Tracker) SetDERPRegionConnectedState(region int, connected bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.derpRegionConnected[region] = connected
+	t.selfCheckLocked()
 }
 
 // SetDERPRegionHealth sets or clears any problem associated with the
 // provided DERP region.
-func SetDERPRegionHealth(region int, problem string) {
-	mu.Lock()
-	defer mu.Unlock()
+func SetDERPRegionHealth(region int, problem string) { global.SetDERPRegionHealth(region, problem) }
+
+// SetDERPRegionHealth sets or clears any problem associated with the
+// provided DERP region.
+func (t *Tracker) SetDERPRegionHealth(region int, problem string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	if problem == "" {
-		delete(derpRegionHealthProblem, region)
+		delete(t.derpRegionHealthProblem, region)
 	} else {
-		derpRegionHealthProblem[region] = problem
+		t.derpRegionHealthProblem[region] = problem
 	}
-	selfCheckLocked()
+	t.selfCheckLocked()
 }
 
-func NoteDERPRegionReceivedFrame(region int) {
-	mu.Lock()
-	defer mu.Unlock()
-	derpRegionLastFrame[region] = time.Now()
-	selfCheckLocked()
+func NoteDERPRegionReceivedFrame(region int) { global.NoteDERPRegionReceivedFrame(region) }
+
+// NoteDERPRegionReceivedFrame notes that a frame was received from
+// the provided DERP region.
+func (t *Tracker) NoteDERPRegionReceivedFrame(region int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.derpRegionLastFrame[region] = time.Now()
+	t.selfCheckLocked()
 }
 
 // state is an ipn.State.String() value: "Running", "Stopped", "NeedsLogin", etc.
-func SetIPNState(state string, wantRunning bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	ipnState = state
-	ipnWantRunning = wantRunning
-	selfCheckLocked()
+func SetIPNState(state string, wantRunning bool) { global.SetIPNState(state, wantRunning) }
+
+// SetIPNState records the node's ipn.State.String() value and whether
+// it wants to be running.
+func (t *Tracker) SetIPNState(state string, wantRunning bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ipnState = state
+	t.ipnWantRunning = wantRunning
+	t.selfCheckLocked()
 }
 
 // SetAnyInterfaceUp sets whether any network interface is up.
-func SetAnyInterfaceUp(up bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	anyInterfaceUp = up
-	selfCheckLocked()
+func SetAnyInterfaceUp(up bool) { global.SetAnyInterfaceUp(up) }
+
+// SetAnyInterfaceUp sets whether any network interface is up.
+func (t *Tracker) SetAnyInterfaceUp(up bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.anyInterfaceUp = up
+	t.selfCheckLocked()
 }
 
 // SetUDP4Unbound sets whether the udp4 bind failed completely.
-func SetUDP4Unbound(unbound bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	udp4Unbound = unbound
-	selfCheckLocked()
+func SetUDP4Unbound(unbound bool) { global.SetUDP4Unbound(unbound) }
+
+// SetUDP4Unbound sets whether the udp4 bind failed completely.
+func (t *Tracker) SetUDP4Unbound(unbound bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.udp4Unbound = unbound
+	t.selfCheckLocked()
 }
 
 // SetAuthRoutineInError records the latest error encountered as a result of a
 // login attempt. Providing a nil error indicates successful login, or that
 // being logged in w/coordination is not currently desired.
-func SetAuthRoutineInError(err error) {
-	mu.Lock()
-	defer mu.Unlock()
-	lastLoginErr = err
+func SetAuthRoutineInError(err error) { global.SetAuthRoutineInError(err) }
+
+// SetAuthRoutineInError records the latest error encountered as a result of a
+// login attempt. Providing a nil error indicates successful login, or that
+// being logged in w/coordination is not currently desired.
+func (t *Tracker) SetAuthRoutineInError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastLoginErr = err
 }
 
-func timerSelfCheck() {
-	mu.Lock()
-	defer mu.Unlock()
-	checkReceiveFuncs()
-	selfCheckLocked()
-	if timer != nil {
-		timer.Reset(time.Minute)
+func (t *Tracker) timerSelfCheck() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checkReceiveFuncsLocked()
+	t.selfCheckLocked()
+	if t.timer != nil {
+		t.timer.Reset(time.Minute)
 	}
 }
 
-func selfCheckLocked() {
-	if ipnState == "" {
+func (t *Tracker) selfCheckLocked() {
+	if t.ipnState == "" {
 		// Don't check yet.
 		return
 	}
-	setLocked(SysOverall, overallErrorLocked())
+	t.setLocked(SysOverall, t.overallErrorLocked())
 }
 
 // OverallError returns a summary of the health state.
 //
 // If there are multiple problems, the error will be of type
 // multierr.Error.
-func OverallError() error {
-	mu.Lock()
-	defer mu.Unlock()
-	return overallErrorLocked()
+func OverallError() error { return global.OverallError() }
+
+// OverallError returns a summary of the health state of t.
+//
+// If there are multiple problems, the error will be of type
+// multierr.Error.
+func (t *Tracker) OverallError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.overallErrorLocked()
 }
 
 var fakeErrForTesting = envknob.RegisterString("TS_DEBUG_FAKE_HEALTH_ERROR")
 
-func overallErrorLocked() error {
-	if !anyInterfaceUp {
+func (t *Tracker) overallErrorLocked() error {
+	if !t.anyInterfaceUp {
 		return errors.New("network down")
 	}
-	if localLogConfigErr != nil {
-		return localLogConfigErr
+	if t.localLogConfigErr != nil {
+		return t.localLogConfigErr
 	}
-	if !ipnWantRunning {
-		return fmt.Errorf("state=%v, wantRunning=%v", ipnState, ipnWantRunning)
+	if !t.ipnWantRunning {
+		return fmt.Errorf("state=%v, wantRunning=%v", t.ipnState, t.ipnWantRunning)
 	}
-	if lastLoginErr != nil {
-		return fmt.Errorf("not logged in, last login error=%v", lastLoginErr)
+	if t.lastLoginErr != nil {
+		return fmt.Errorf("not logged in, last login error=%v", t.lastLoginErr)
 	}
 	now := time.Now()
-	if !inMapPoll && (lastMapPollEndedAt.IsZero() || now.Sub(lastMapPollEndedAt) > 10*time.Second) {
+	if !t.inMapPoll && (t.lastMapPollEndedAt.IsZero() || now.Sub(t.lastMapPollEndedAt) > 10*time.Second) {
 		return errors.New("not in map poll")
 	}
 	const tooIdle = 2*time.Minute + 5*time.Second
-	if d := now.Sub(lastStreamedMapResponse).Round(time.Second); d > tooIdle {
+	if d := now.Sub(t.lastStreamedMapResponse).Round(time.Second); d > tooIdle {
 		return fmt.Errorf("no map response in %v", d)
 	}
-	rid := derpHomeRegion
+	rid := t.derpHomeRegion
 	if rid == 0 {
 		return errors.New("no DERP home")
 	}
-	if !derpRegionConnected[rid] {
+	if !t.derpRegionConnected[rid] {
 		return fmt.Errorf("not connected to home DERP region %v", rid)
 	}
-	if d := now.Sub(derpRegionLastFrame[rid]).Round(time.Second); d > tooIdle {
+	if d := now.Sub(t.derpRegionLastFrame[rid]).Round(time.Second); d > tooIdle {
 		return fmt.Errorf("haven't heard from home DERP region %v in %v", rid, d)
 	}
-	if udp4Unbound {
+	if t.udp4Unbound {
 		return errors.New("no udp4 bind")
 	}
 
 	// TODO: use
-	_ = inMapPollSince
-	_ = lastMapPollEndedAt
-	_ = lastStreamedMapResponse
-	_ = lastMapRequestHeard
+	_ = t.inMapPollSince
+	_ = t.lastMapPollEndedAt
+	_ = t.lastStreamedMapResponse
+	_ = t.lastMapRequestHeard
 
 	var errs []error
-	for _, recv := range receiveFuncs {
+	for _, recv := range t.receiveFuncs {
 		if recv.missing {
 			errs = append(errs, fmt.Errorf("%s is not running", recv.name))
 		}
 	}
-	for sys, err := range sysErr {
+	for sys, err := range t.sysErr {
 		if err == nil || sys == SysOverall {
 			continue
 		}
 		errs = append(errs, fmt.Errorf("%v: %w", sys, err))
 	}
-	for w := range warnables {
+	for _, w := range allWarnables() {
 		if err := w.get(); err != nil {
 			errs = append(errs, err)
 		}
 	}
-	for regionID, problem := range derpRegionHealthProblem {
+	for regionID, problem := range t.derpRegionHealthProblem {
 		errs = append(errs, fmt.Errorf("derp%d: %v", regionID, problem))
 	}
-	for _, s := range controlHealth {
+	for _, s := range t.controlHealth {
 		errs = append(errs, errors.New(s))
 	}
 	if err := envknob.ApplyDiskConfigError(); err != nil {
@@ -478,20 +631,14 @@ func overallErrorLocked() error {
 	return multierr.New(errs...)
 }
 
+// ReceiveIPv4, ReceiveIPv6 and ReceiveDERP track the receive funcs of the
+// process-wide Tracker.
 var (
-	ReceiveIPv4 = ReceiveFuncStats{name: "ReceiveIPv4"}
-	ReceiveIPv6 = ReceiveFuncStats{name: "ReceiveIPv6"}
-	ReceiveDERP = ReceiveFuncStats{name: "ReceiveDERP"}
-
-	receiveFuncs = []*ReceiveFuncStats{&ReceiveIPv4, &ReceiveIPv6, &ReceiveDERP}
+	ReceiveIPv4 = &global.ReceiveIPv4
+	ReceiveIPv6 = &global.ReceiveIPv6
+	ReceiveDERP = &global.ReceiveDERP
 )
 
-func init() {
-	if runtime.GOOS == "js" {
-		receiveFuncs = receiveFuncs[2:] // ignore IPv4 and IPv6
-	}
-}
-
 // ReceiveFuncStats tracks the calls made to a wireguard-go receive func.
 type ReceiveFuncStats struct {
 	// name is the name of the receive func.
@@ -519,8 +666,8 @@ func (s *ReceiveFuncStats) Exit() {
 	atomic.StoreUint32(&s.inCall, 0)
 }
 
-func checkReceiveFuncs() {
-	for _, recv := range receiveFuncs {
+func (t *Tracker) checkReceiveFuncsLocked() {
+	for _, recv := range t.receiveFuncs {
 		recv.missing = false
 		prev := recv.prevNumCalls
 		numCalls := atomic.LoadUint64(&recv.numCalls)
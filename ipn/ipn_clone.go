@@ -8,6 +8,7 @@
 
 import (
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/persist"
@@ -98,14 +99,20 @@ func (src *TCPPortHandler) Clone() *TCPPortHandler {
 	}
 	dst := new(TCPPortHandler)
 	*dst = *src
+	if dst.Expires != nil {
+		dst.Expires = new(time.Time)
+		*dst.Expires = *src.Expires
+	}
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _TCPPortHandlerCloneNeedsRegeneration = TCPPortHandler(struct {
-	HTTPS        bool
-	TCPForward   string
-	TerminateTLS string
+	HTTPS         bool
+	TCPForward    string
+	TerminateTLS  string
+	ProxyProtocol int
+	Expires       *time.Time
 }{})
 
 // Clone makes a deep copy of HTTPHandler.
@@ -116,14 +123,46 @@ func (src *HTTPHandler) Clone() *HTTPHandler {
 	}
 	dst := new(HTTPHandler)
 	*dst = *src
+	dst.Backends = append(src.Backends[:0:0], src.Backends...)
+	if dst.SetRequestHeaders != nil {
+		dst.SetRequestHeaders = map[string]string{}
+		for k, v := range src.SetRequestHeaders {
+			dst.SetRequestHeaders[k] = v
+		}
+	}
+	if dst.SetResponseHeaders != nil {
+		dst.SetResponseHeaders = map[string]string{}
+		for k, v := range src.SetResponseHeaders {
+			dst.SetResponseHeaders[k] = v
+		}
+	}
+	dst.AllowUsers = append(src.AllowUsers[:0:0], src.AllowUsers...)
+	dst.AllowTags = append(src.AllowTags[:0:0], src.AllowTags...)
+	dst.AllowCaps = append(src.AllowCaps[:0:0], src.AllowCaps...)
+	if dst.Expires != nil {
+		dst.Expires = new(time.Time)
+		*dst.Expires = *src.Expires
+	}
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HTTPHandlerCloneNeedsRegeneration = HTTPHandler(struct {
-	Path  string
-	Proxy string
-	Text  string
+	Path               string
+	Proxy              string
+	Text               string
+	Redirect           string
+	Backends           []string
+	StatusCode         int
+	LBPolicy           string
+	HealthCheckPath    string
+	SetRequestHeaders  map[string]string
+	SetResponseHeaders map[string]string
+	IdentityHeaders    bool
+	AllowUsers         []string
+	AllowTags          []string
+	AllowCaps          []string
+	Expires            *time.Time
 }{})
 
 // Clone makes a deep copy of WebServerConfig.
@@ -10,6 +10,7 @@
 	"encoding/json"
 	"errors"
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/persist"
@@ -231,12 +232,22 @@ func (v *TCPPortHandlerView) UnmarshalJSON(b []byte) error {
 func (v TCPPortHandlerView) HTTPS() bool          { return v.ж.HTTPS }
 func (v TCPPortHandlerView) TCPForward() string   { return v.ж.TCPForward }
 func (v TCPPortHandlerView) TerminateTLS() string { return v.ж.TerminateTLS }
+func (v TCPPortHandlerView) ProxyProtocol() int   { return v.ж.ProxyProtocol }
+func (v TCPPortHandlerView) Expires() *time.Time {
+	if v.ж.Expires == nil {
+		return nil
+	}
+	x := *v.ж.Expires
+	return &x
+}
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _TCPPortHandlerViewNeedsRegeneration = TCPPortHandler(struct {
-	HTTPS        bool
-	TCPForward   string
-	TerminateTLS string
+	HTTPS         bool
+	TCPForward    string
+	TerminateTLS  string
+	ProxyProtocol int
+	Expires       *time.Time
 }{})
 
 // View returns a readonly view of HTTPHandler.
@@ -284,15 +295,51 @@ func (v *HTTPHandlerView) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (v HTTPHandlerView) Path() string  { return v.ж.Path }
-func (v HTTPHandlerView) Proxy() string { return v.ж.Proxy }
-func (v HTTPHandlerView) Text() string  { return v.ж.Text }
+func (v HTTPHandlerView) Path() string                  { return v.ж.Path }
+func (v HTTPHandlerView) Proxy() string                 { return v.ж.Proxy }
+func (v HTTPHandlerView) Text() string                  { return v.ж.Text }
+func (v HTTPHandlerView) Redirect() string              { return v.ж.Redirect }
+func (v HTTPHandlerView) Backends() views.Slice[string] { return views.SliceOf(v.ж.Backends) }
+func (v HTTPHandlerView) StatusCode() int               { return v.ж.StatusCode }
+func (v HTTPHandlerView) LBPolicy() string              { return v.ж.LBPolicy }
+func (v HTTPHandlerView) HealthCheckPath() string       { return v.ж.HealthCheckPath }
+
+func (v HTTPHandlerView) SetRequestHeaders() views.Map[string, string] {
+	return views.MapOf(v.ж.SetRequestHeaders)
+}
+
+func (v HTTPHandlerView) SetResponseHeaders() views.Map[string, string] {
+	return views.MapOf(v.ж.SetResponseHeaders)
+}
+func (v HTTPHandlerView) IdentityHeaders() bool           { return v.ж.IdentityHeaders }
+func (v HTTPHandlerView) AllowUsers() views.Slice[string] { return views.SliceOf(v.ж.AllowUsers) }
+func (v HTTPHandlerView) AllowTags() views.Slice[string]  { return views.SliceOf(v.ж.AllowTags) }
+func (v HTTPHandlerView) AllowCaps() views.Slice[string]  { return views.SliceOf(v.ж.AllowCaps) }
+func (v HTTPHandlerView) Expires() *time.Time {
+	if v.ж.Expires == nil {
+		return nil
+	}
+	x := *v.ж.Expires
+	return &x
+}
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _HTTPHandlerViewNeedsRegeneration = HTTPHandler(struct {
-	Path  string
-	Proxy string
-	Text  string
+	Path               string
+	Proxy              string
+	Text               string
+	Redirect           string
+	Backends           []string
+	StatusCode         int
+	LBPolicy           string
+	HealthCheckPath    string
+	SetRequestHeaders  map[string]string
+	SetResponseHeaders map[string]string
+	IdentityHeaders    bool
+	AllowUsers         []string
+	AllowTags          []string
+	AllowCaps          []string
+	Expires            *time.Time
 }{})
 
 // View returns a readonly view of WebServerConfig.
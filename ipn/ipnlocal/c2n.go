@@ -12,7 +12,6 @@
 	"time"
 
 	"tailscale.com/tailcfg"
-	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/goroutines"
 )
 
@@ -33,7 +32,7 @@ func (b *LocalBackend) handleC2N(w http.ResponseWriter, r *http.Request) {
 		writeJSON(b.Prefs())
 	case "/debug/metrics":
 		w.Header().Set("Content-Type", "text/plain")
-		clientmetric.WritePrometheusExpositionFormat(w)
+		b.ClientMetrics().WritePrometheusExpositionFormat(w)
 	case "/debug/component-logging":
 		component := r.FormValue("component")
 		secs, _ := strconv.Atoi(r.FormValue("secs"))
@@ -62,6 +62,7 @@
 	"tailscale.com/types/preftype"
 	"tailscale.com/types/ptr"
 	"tailscale.com/types/views"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/deephash"
 	"tailscale.com/util/dnsname"
 	"tailscale.com/util/mak"
@@ -98,6 +99,19 @@ type SSHServer interface {
 	// and closed if they'd no longer be accepted.
 	OnPolicyChange()
 
+	// SSHPolicy returns the effective SSH access policy: the tailnet's
+	// policy merged with the local SSH policy file, if any.
+	// It returns nil if there's no policy.
+	SSHPolicy() (*tailcfg.SSHPolicy, error)
+
+	// Sessions returns the active SSH sessions.
+	Sessions() []*ipnstate.SSHSession
+
+	// KillSession terminates the session with the given ID, or all the
+	// sessions on the connection if id is a connection ID. It reports
+	// whether there was such a session or connection.
+	KillSession(id string) bool
+
 	// Shutdown is called when tailscaled is shutting down.
 	Shutdown()
 }
@@ -131,7 +145,11 @@ type LocalBackend struct {
 	e                     wgengine.Engine
 	pm                    *profileManager
 	store                 ipn.StateStore
-	dialer                *tsdial.Dialer // non-nil
+	dialer                *tsdial.Dialer         // non-nil
+	health                *health.Tracker        // from the engine; non-nil
+	clientMetrics         *clientmetric.Registry // from the engine; nil means clientmetric.Global
+	metricsOnce           sync.Once
+	metricsv              *metrics // from clientMetrics; use LocalBackend.metrics
 	backendLogID          string
 	unregisterLinkMon     func()
 	unregisterHealthWatch func()
@@ -206,9 +224,10 @@ type LocalBackend struct {
 	// ServeConfig fields. (also guarded by mu)
 	lastServeConfJSON mem.RO              // last JSON that was parsed into serveConfig
 	serveConfig       ipn.ServeConfigView // or !Valid if none
+	serveExpiryTimer  *time.Timer         // if non-nil, fires when the next serve mapping expires
 
 	serveListeners     map[netip.AddrPort]*serveListener // addrPort => serveListener
-	serveProxyHandlers sync.Map                          // string (HTTPHandler.Proxy) => *httputil.ReverseProxy
+	serveProxyHandlers sync.Map                          // string (HTTPHandler.Proxy) => *httputil.ReverseProxy, or lbKey => *loadBalancer
 
 	// statusLock must be held before calling statusChanged.Wait() or
 	// statusChanged.Broadcast().
@@ -241,7 +260,7 @@ func NewLocalBackend(logf logger.Logf, logid string, store ipn.StateStore, state
 		panic("ipn.NewLocalBackend: engine must not be nil")
 	}
 
-	pm, err := newProfileManager(store, logf, stateKey)
+	pm, err := newProfileManager(store, logf, stateKey, e.GetClientMetrics())
 	if err != nil {
 		return nil, err
 	}
@@ -271,6 +290,8 @@ func NewLocalBackend(logf logger.Logf, logid string, store ipn.StateStore, state
 		pm:             pm,
 		store:          pm.Store(),
 		dialer:         dialer,
+		health:         e.GetHealthTracker(),
+		clientMetrics:  e.GetClientMetrics(),
 		backendLogID:   logid,
 		state:          ipn.NoState,
 		portpoll:       portpoll,
@@ -293,7 +314,7 @@ func NewLocalBackend(logf logger.Logf, logid string, store ipn.StateStore, state
 	b.linkChange(false, linkMon.InterfaceState())
 	b.unregisterLinkMon = linkMon.RegisterChangeCallback(b.linkChange)
 
-	b.unregisterHealthWatch = health.RegisterWatcher(b.onHealthChange)
+	b.unregisterHealthWatch = b.health.RegisterWatcher(b.onHealthChange)
 
 	wiredPeerAPIPort := false
 	if ig, ok := e.(wgengine.InternalsGetter); ok {
@@ -411,6 +432,28 @@ func (b *LocalBackend) Dialer() *tsdial.Dialer {
 	return b.dialer
 }
 
+// HealthTracker returns the health tracker for the backend's node.
+func (b *LocalBackend) HealthTracker() *health.Tracker {
+	return b.health
+}
+
+// ClientMetrics returns the registry of the backend's node's client
+// metrics.
+func (b *LocalBackend) ClientMetrics() *clientmetric.Registry {
+	if b.clientMetrics == nil {
+		return clientmetric.Global()
+	}
+	return b.clientMetrics
+}
+
+// metrics returns b's client metrics, creating them on first use.
+func (b *LocalBackend) metrics() *metrics {
+	b.metricsOnce.Do(func() {
+		b.metricsv = newMetrics(b.ClientMetrics())
+	})
+	return b.metricsv
+}
+
 // SetDirectFileRoot sets the directory to download files to directly,
 // without buffering them through an intermediate daemon-owned
 // tailcfg.UserID-specific directory.
@@ -580,7 +623,7 @@ func (b *LocalBackend) updateStatus(sb *ipnstate.StatusBuilder, extraLocked func
 		s.Version = version.Long
 		s.BackendState = b.state.String()
 		s.AuthURL = b.authURLSticky
-		if err := health.OverallError(); err != nil {
+		if err := b.health.OverallError(); err != nil {
 			switch e := err.(type) {
 			case multierr.Error:
 				for _, err := range e.Errors() {
@@ -626,7 +669,7 @@ func (b *LocalBackend) updateStatus(sb *ipnstate.StatusBuilder, extraLocked func
 		}
 	})
 	sb.MutateSelfStatus(func(ss *ipnstate.PeerStatus) {
-		ss.Online = health.GetInPollNetMap()
+		ss.Online = b.health.GetInPollNetMap()
 		if b.netMap != nil {
 			ss.InNetworkMap = true
 			ss.HostName = b.netMap.Hostinfo.Hostname
@@ -933,7 +976,7 @@ func (b *LocalBackend) setClientStatus(st controlclient.Status) {
 	if st.NetMap != nil {
 		if envknob.NoLogsNoSupport() && hasCapability(st.NetMap, tailcfg.CapabilityDataPlaneAuditLogs) {
 			msg := "tailnet requires logging to be enabled. Remove --no-logs-no-support from tailscaled command line."
-			health.SetLocalLogConfigHealth(errors.New(msg))
+			b.health.SetLocalLogConfigHealth(errors.New(msg))
 			// Connecting to this tailnet without logging is forbidden; boot us outta here.
 			b.mu.Lock()
 			prefs.WantRunning = false
@@ -1312,6 +1355,8 @@ func (b *LocalBackend) Start(opts ipn.Options) error {
 		Status:               b.setClientStatus,
 		C2NHandler:           http.HandlerFunc(b.handleC2N),
 		DialPlan:             &b.dialPlan, // pointer because it can't be copied
+		HealthTracker:        b.health,
+		ClientMetrics:        b.clientMetrics,
 
 		// Don't warn about broken Linux IP forwarding when
 		// netstack is being used.
@@ -3354,7 +3399,7 @@ func (b *LocalBackend) enterStateLockedOnEntry(newState ipn.State) {
 
 	// prefs may change irrespective of state; WantRunning should be explicitly
 	// set before potential early return even if the state is unchanged.
-	health.SetIPNState(newState.String(), prefs.Valid() && prefs.WantRunning())
+	b.health.SetIPNState(newState.String(), prefs.Valid() && prefs.WantRunning())
 	if oldState == newState {
 		return
 	}
@@ -3677,9 +3722,9 @@ func (b *LocalBackend) setNetMapLocked(nm *netmap.NetworkMap) {
 	b.maybePauseControlClientLocked()
 
 	if nm != nil {
-		health.SetControlHealth(nm.ControlHealth)
+		b.health.SetControlHealth(nm.ControlHealth)
 	} else {
-		health.SetControlHealth(nil)
+		b.health.SetControlHealth(nil)
 	}
 
 	// Determine if file sharing is enabled
@@ -3766,6 +3811,7 @@ func (b *LocalBackend) setTCPPortsInterceptedFromNetmapAndPrefsLocked(prefs ipn.
 	}
 
 	b.reloadServeConfigLocked(prefs)
+	b.updateServeExpiryTimerLocked()
 	if b.serveConfig.Valid() {
 		servePorts := make([]uint16, 0, 3)
 		b.serveConfig.TCP().Range(func(port uint16, _ ipn.TCPPortHandlerView) bool {
@@ -3803,6 +3849,21 @@ func (b *LocalBackend) setServeProxyHandlersLocked() {
 	var backends map[string]bool
 	b.serveConfig.Web().Range(func(_ ipn.HostPort, conf ipn.WebServerConfigView) (cont bool) {
 		conf.Handlers().Range(func(_ string, h ipn.HTTPHandlerView) (cont bool) {
+			if h.Backends().Len() > 0 {
+				key := lbKey(h)
+				mak.Set(&backends, key, true)
+				if _, ok := b.serveProxyHandlers.Load(key); ok {
+					return true
+				}
+				b.logf("serve: creating a new load balancer for %s", key)
+				lb, err := newLoadBalancer(h, b.proxyHandlerForBackend, b.logf)
+				if err != nil {
+					b.logf("[unexpected] could not create load balancer for %v: %s", key, err)
+					return true
+				}
+				b.serveProxyHandlers.Store(key, lb)
+				return true
+			}
 			backend := h.Proxy()
 			mak.Set(&backends, backend, true)
 			if _, ok := b.serveProxyHandlers.Load(backend); ok {
@@ -3829,7 +3890,12 @@ func (b *LocalBackend) setServeProxyHandlersLocked() {
 		backend := key.(string)
 		if !backends[backend] {
 			b.logf("serve: closing idle connections to %s", backend)
-			value.(*httputil.ReverseProxy).Transport.(*http.Transport).CloseIdleConnections()
+			switch p := value.(type) {
+			case *httputil.ReverseProxy:
+				p.Transport.(*http.Transport).CloseIdleConnections()
+			case *loadBalancer:
+				p.Close()
+			}
 			b.serveProxyHandlers.Delete(backend)
 		}
 		return true
@@ -4368,6 +4434,40 @@ func (b *LocalBackend) sshServerOrInit() (_ SSHServer, err error) {
 	return b.sshServer, nil
 }
 
+// EffectiveSSHPolicy returns the SSH access policy that Tailscale SSH
+// enforces, or nil if there's none.
+func (b *LocalBackend) EffectiveSSHPolicy() (*tailcfg.SSHPolicy, error) {
+	s, err := b.sshServerOrInit()
+	if err != nil {
+		return nil, err
+	}
+	return s.SSHPolicy()
+}
+
+// SSHSessions returns the active Tailscale SSH sessions.
+func (b *LocalBackend) SSHSessions() []*ipnstate.SSHSession {
+	b.mu.Lock()
+	s := b.sshServer
+	b.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	return s.Sessions()
+}
+
+// KillSSHSession terminates the Tailscale SSH session with the given ID,
+// or all the sessions on the connection if id is a connection ID. It
+// reports whether there was such a session or connection.
+func (b *LocalBackend) KillSSHSession(id string) bool {
+	b.mu.Lock()
+	s := b.sshServer
+	b.mu.Unlock()
+	if s == nil {
+		return false
+	}
+	return s.KillSession(id)
+}
+
 func (b *LocalBackend) HandleSSHConn(c net.Conn) (err error) {
 	s, err := b.sshServerOrInit()
 	if err != nil {
@@ -4540,7 +4640,7 @@ func (b *LocalBackend) resetForProfileChangeLockedOnEntry() error {
 	b.lastServeConfJSON = mem.B(nil)
 	b.serveConfig = ipn.ServeConfigView{}
 	b.enterStateLockedOnEntry(ipn.NoState) // Reset state.
-	health.SetLocalLogConfigHealth(nil)
+	b.health.SetLocalLogConfigHealth(nil)
 	return b.Start(ipn.Options{})
 }
 
@@ -4583,3 +4683,37 @@ func (b *LocalBackend) ListProfiles() []ipn.LoginProfile {
 	defer b.mu.Unlock()
 	return b.pm.Profiles()
 }
+
+// metrics are a LocalBackend's client metrics.
+type metrics struct {
+	newProfile       *clientmetric.Metric
+	switchProfile    *clientmetric.Metric
+	deleteProfile    *clientmetric.Metric
+	migration        *clientmetric.Metric
+	migrationError   *clientmetric.Metric
+	migrationSuccess *clientmetric.Metric
+
+	peerAPIInvalidRequests *clientmetric.Metric
+
+	// Non-debug PeerAPI endpoints.
+	peerAPIPutCalls       *clientmetric.Metric
+	peerAPIDNSCalls       *clientmetric.Metric
+	peerAPIWakeOnLANCalls *clientmetric.Metric
+	peerAPIIngressCalls   *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		newProfile:             r.Counter("profiles_new"),
+		switchProfile:          r.Counter("profiles_switch"),
+		deleteProfile:          r.Counter("profiles_delete"),
+		migration:              r.Counter("profiles_migration"),
+		migrationError:         r.Counter("profiles_migration_error"),
+		migrationSuccess:       r.Counter("profiles_migration_success"),
+		peerAPIInvalidRequests: r.Counter("peerapi_invalid_requests"),
+		peerAPIPutCalls:        r.Counter("peerapi_put"),
+		peerAPIDNSCalls:        r.Counter("peerapi_dns"),
+		peerAPIWakeOnLANCalls:  r.Counter("peerapi_wol"),
+		peerAPIIngressCalls:    r.Counter("peerapi_ingress"),
+	}
+}
@@ -25,8 +25,9 @@
 // profileManager is a wrapper around a StateStore that manages
 // multiple profiles and the current profile.
 type profileManager struct {
-	store ipn.StateStore
-	logf  logger.Logf
+	store   ipn.StateStore
+	logf    logger.Logf
+	metrics *metrics
 
 	currentUserID  ipn.WindowsUserID
 	knownProfiles  map[ipn.ProfileID]*ipn.LoginProfile
@@ -291,7 +292,7 @@ func (pm *profileManager) Profiles() []ipn.LoginProfile {
 // SwitchProfile switches to the profile with the given id.
 // If the profile is not known, it returns an errProfileNotFound.
 func (pm *profileManager) SwitchProfile(id ipn.ProfileID) error {
-	metricSwitchProfile.Add(1)
+	pm.metrics.switchProfile.Add(1)
 
 	kp, ok := pm.knownProfiles[id]
 	if !ok {
@@ -360,7 +361,7 @@ func (pm *profileManager) CurrentProfile() ipn.LoginProfile {
 // useful for deleting the last profile. In other cases, it is
 // recommended to call SwitchProfile() first.
 func (pm *profileManager) DeleteProfile(id ipn.ProfileID) error {
-	metricDeleteProfile.Add(1)
+	pm.metrics.deleteProfile.Add(1)
 
 	if id == "" && pm.isNewProfile {
 		// Deleting the in-memory only new profile, just create a new one.
@@ -392,7 +393,7 @@ func (pm *profileManager) writeKnownProfiles() error {
 // NewProfile creates and switches to a new unnamed profile. The new profile is
 // not persisted until SetPrefs is called with a logged-in user.
 func (pm *profileManager) NewProfile() {
-	metricNewProfile.Add(1)
+	pm.metrics.newProfile.Add(1)
 
 	pm.prefs = emptyPrefs
 	pm.isNewProfile = true
@@ -419,7 +420,7 @@ func (pm *profileManager) CurrentPrefs() ipn.PrefsView {
 
 // ReadStartupPrefsForTest reads the startup prefs from disk. It is only used for testing.
 func ReadStartupPrefsForTest(logf logger.Logf, store ipn.StateStore) (ipn.PrefsView, error) {
-	pm, err := newProfileManager(store, logf, "")
+	pm, err := newProfileManager(store, logf, "", nil)
 	if err != nil {
 		return ipn.PrefsView{}, err
 	}
@@ -429,8 +430,9 @@ func ReadStartupPrefsForTest(logf logger.Logf, store ipn.StateStore) (ipn.PrefsV
 // newProfileManager creates a new ProfileManager using the provided StateStore.
 // It also loads the list of known profiles from the StateStore.
 // If a state key is provided, it will be used to load the current profile.
-func newProfileManager(store ipn.StateStore, logf logger.Logf, stateKey ipn.StateKey) (*profileManager, error) {
-	return newProfileManagerWithGOOS(store, logf, stateKey, envknob.GOOS())
+// Client metrics are recorded in clientMetrics, or clientmetric.Global if nil.
+func newProfileManager(store ipn.StateStore, logf logger.Logf, stateKey ipn.StateKey, clientMetrics *clientmetric.Registry) (*profileManager, error) {
+	return newProfileManagerWithGOOS(store, logf, stateKey, envknob.GOOS(), clientMetrics)
 }
 
 func readAutoStartKey(store ipn.StateStore, goos string) (ipn.StateKey, error) {
@@ -463,8 +465,11 @@ func readKnownProfiles(store ipn.StateStore) (map[ipn.ProfileID]*ipn.LoginProfil
 	return knownProfiles, nil
 }
 
-func newProfileManagerWithGOOS(store ipn.StateStore, logf logger.Logf, stateKey ipn.StateKey, goos string) (*profileManager, error) {
+func newProfileManagerWithGOOS(store ipn.StateStore, logf logger.Logf, stateKey ipn.StateKey, goos string, clientMetrics *clientmetric.Registry) (*profileManager, error) {
 	logf = logger.WithPrefix(logf, "pm: ")
+	if clientMetrics == nil {
+		clientMetrics = clientmetric.Global()
+	}
 	if stateKey == "" {
 		var err error
 		stateKey, err = readAutoStartKey(store, goos)
@@ -482,6 +487,7 @@ func newProfileManagerWithGOOS(store ipn.StateStore, logf logger.Logf, stateKey
 		store:         store,
 		knownProfiles: knownProfiles,
 		logf:          logf,
+		metrics:       newMetrics(clientMetrics),
 	}
 
 	if stateKey != "" {
@@ -518,7 +524,7 @@ func newProfileManagerWithGOOS(store ipn.StateStore, logf logger.Logf, stateKey
 }
 
 func (pm *profileManager) migrateFromLegacyPrefs() error {
-	metricMigration.Add(1)
+	pm.metrics.migration.Add(1)
 	pm.NewProfile()
 	k := ipn.LegacyGlobalDaemonStateKey
 	switch {
@@ -531,26 +537,16 @@ func (pm *profileManager) migrateFromLegacyPrefs() error {
 	}
 	prefs, err := pm.loadSavedPrefs(k)
 	if err != nil {
-		metricMigrationError.Add(1)
+		pm.metrics.migrationError.Add(1)
 		return fmt.Errorf("calling ReadState on state store: %w", err)
 	}
 	pm.logf("migrating %q profile to new format", k)
 	if err := pm.SetPrefs(prefs); err != nil {
-		metricMigrationError.Add(1)
+		pm.metrics.migrationError.Add(1)
 		return fmt.Errorf("migrating _daemon profile: %w", err)
 	}
 	// Do not delete the old state key, as we may be downgraded to an
 	// older version that still relies on it.
-	metricMigrationSuccess.Add(1)
+	pm.metrics.migrationSuccess.Add(1)
 	return nil
 }
-
-var (
-	metricNewProfile    = clientmetric.NewCounter("profiles_new")
-	metricSwitchProfile = clientmetric.NewCounter("profiles_switch")
-	metricDeleteProfile = clientmetric.NewCounter("profiles_delete")
-
-	metricMigration        = clientmetric.NewCounter("profiles_migration")
-	metricMigrationError   = clientmetric.NewCounter("profiles_migration_error")
-	metricMigrationSuccess = clientmetric.NewCounter("profiles_migration_success")
-)
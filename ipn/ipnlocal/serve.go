@@ -5,6 +5,7 @@
 package ipnlocal
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -28,9 +29,11 @@
 	"tailscale.com/ipn"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/netutil"
+	"tailscale.com/net/proxyproto"
 	"tailscale.com/syncs"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/logger"
+	"tailscale.com/types/views"
 	"tailscale.com/util/mak"
 	"tailscale.com/util/strs"
 )
@@ -187,7 +190,13 @@ func (b *LocalBackend) updateServeTCPPortNetMapAddrListenersLocked(ports []uint1
 func (b *LocalBackend) SetServeConfig(config *ipn.ServeConfig) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	return b.setServeConfigLocked(config)
+}
 
+// setServeConfigLocked is the implementation of SetServeConfig.
+//
+// b.mu must be held.
+func (b *LocalBackend) setServeConfigLocked(config *ipn.ServeConfig) error {
 	nm := b.netMap
 	if nm == nil {
 		return errors.New("netMap is nil")
@@ -214,6 +223,83 @@ func (b *LocalBackend) SetServeConfig(config *ipn.ServeConfig) error {
 	return nil
 }
 
+// serveExpiryCheckInterval is the longest the serve expiry timer waits
+// before checking for expired mappings again. Timers don't run while the
+// machine is suspended, so a mapping can expire (by the wall clock) long
+// before its timer fires.
+const serveExpiryCheckInterval = time.Minute
+
+// serveExpired reports whether a serve mapping with the given Expires time
+// has expired. Mappings are checked when they're used, as well as removed
+// by expireServeConfig, which may run late.
+func serveExpired(expires *time.Time) bool {
+	return expires != nil && !time.Now().Before(*expires)
+}
+
+// updateServeExpiryTimerLocked arranges for expireServeConfig to be called
+// when the next mapping in b.serveConfig expires, if any do, or after
+// serveExpiryCheckInterval, whichever is sooner.
+//
+// b.mu must be held.
+func (b *LocalBackend) updateServeExpiryTimerLocked() {
+	if !b.serveConfig.Valid() {
+		b.setServeExpiryTimerLocked(0)
+		return
+	}
+	exp, ok := b.serveConfig.AsStruct().NextExpiry()
+	if !ok {
+		b.setServeExpiryTimerLocked(0)
+		return
+	}
+	d := time.Until(exp)
+	if d > serveExpiryCheckInterval {
+		d = serveExpiryCheckInterval
+	}
+	if d <= 0 {
+		d = 1 // fire now, but never leave the timer unset
+	}
+	b.setServeExpiryTimerLocked(d)
+}
+
+// setServeExpiryTimerLocked arranges for expireServeConfig to be called
+// after d, replacing any previous timer. If d is zero, it only stops the
+// previous timer.
+//
+// b.mu must be held.
+func (b *LocalBackend) setServeExpiryTimerLocked(d time.Duration) {
+	if b.serveExpiryTimer != nil {
+		b.serveExpiryTimer.Stop()
+		b.serveExpiryTimer = nil
+	}
+	if d != 0 {
+		b.serveExpiryTimer = time.AfterFunc(d, b.expireServeConfig)
+	}
+}
+
+// expireServeConfig removes the expired mappings from the serve config
+// and persists the result. It re-arms the expiry timer either way.
+func (b *LocalBackend) expireServeConfig() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shutdownCalled || !b.serveConfig.Valid() {
+		return
+	}
+	sc := b.serveConfig.AsStruct()
+	if !sc.RemoveExpired(time.Now()) {
+		// Nothing has expired yet, either because the config changed
+		// since the timer was set or because this is a periodic check.
+		b.updateServeExpiryTimerLocked()
+		return
+	}
+	b.logf("serve: removing expired mappings")
+	if err := b.setServeConfigLocked(sc); err != nil {
+		// The expired mappings are still rejected when used.
+		b.logf("serve: removing expired mappings: %v; retrying in %v", err, serveExpiryCheckInterval)
+		b.setServeExpiryTimerLocked(serveExpiryCheckInterval)
+	}
+	// Otherwise, setServeConfigLocked re-armed the timer.
+}
+
 // ServeConfig provides a view of the current serve mappings.
 // If serving is not configured, the returned view is not Valid.
 func (b *LocalBackend) ServeConfig() ipn.ServeConfigView {
@@ -273,6 +359,11 @@ func (b *LocalBackend) HandleInterceptedTCPConn(dport uint16, srcAddr netip.Addr
 		sendRST()
 		return
 	}
+	if serveExpired(tcph.Expires()) {
+		b.logf("localbackend: got TCP conn for expired TCP config for port %v; from %v", dport, srcAddr)
+		sendRST()
+		return
+	}
 
 	if tcph.HTTPS() {
 		conn, ok := getConn()
@@ -314,6 +405,19 @@ func (b *LocalBackend) HandleInterceptedTCPConn(dport uint16, srcAddr netip.Addr
 		defer conn.Close()
 		defer backConn.Close()
 
+		if v := tcph.ProxyProtocol(); v != 0 {
+			dstAddr, _ := netip.ParseAddrPort(conn.LocalAddr().String())
+			hdr, err := proxyproto.AppendHeader(nil, v, srcAddr, dstAddr)
+			if err != nil {
+				b.logf("localbackend: TCP proxy port %v (from %v): %v", dport, srcAddr, err)
+				return
+			}
+			if _, err := backConn.Write(hdr); err != nil {
+				b.logf("localbackend: failed to write PROXY header to %s: %v", backDst, err)
+				return
+			}
+		}
+
 		if sni := tcph.TerminateTLS(); sni != "" {
 			conn = tls.Server(conn, &tls.Config{
 				GetCertificate: func(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -369,16 +473,22 @@ func (b *LocalBackend) getServeHandler(r *http.Request) (_ ipn.HTTPHandlerView,
 		return z, "", false
 	}
 
-	if h, ok := wsc.Handlers().GetOk(r.URL.Path); ok {
+	// getHandler returns the handler for mount, unless it's expired, in
+	// which case it's treated as already removed.
+	getHandler := func(mount string) (ipn.HTTPHandlerView, bool) {
+		h, ok := wsc.Handlers().GetOk(mount)
+		return h, ok && !serveExpired(h.Expires())
+	}
+	if h, ok := getHandler(r.URL.Path); ok {
 		return h, r.URL.Path, true
 	}
 	path := path.Clean(r.URL.Path)
 	for {
 		withSlash := path + "/"
-		if h, ok := wsc.Handlers().GetOk(withSlash); ok {
+		if h, ok := getHandler(withSlash); ok {
 			return h, withSlash, true
 		}
-		if h, ok := wsc.Handlers().GetOk(path); ok {
+		if h, ok := getHandler(path); ok {
 			return h, path, true
 		}
 		if path == "/" {
@@ -412,14 +522,33 @@ func (b *LocalBackend) proxyHandlerForBackend(backend string) (*httputil.Reverse
 	return rp, nil
 }
 
+// Headers set on proxied requests by HTTPHandler.IdentityHeaders.
+const (
+	identityHeaderLogin = "Tailscale-User-Login"
+	identityHeaderName  = "Tailscale-User-Name"
+)
+
 func (b *LocalBackend) serveWebHandler(w http.ResponseWriter, r *http.Request) {
 	h, mountPoint, ok := b.getServeHandler(r)
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
+	if !b.serveAccessAllowed(r, h) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if hs := h.SetResponseHeaders(); hs.Len() > 0 {
+		w = &setHeadersResponseWriter{
+			ResponseWriter: w,
+			headers:        hs,
+		}
+	}
 	if s := h.Text(); s != "" {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if code := h.StatusCode(); code != 0 {
+			w.WriteHeader(code)
+		}
 		io.WriteString(w, s)
 		return
 	}
@@ -433,13 +562,151 @@ func (b *LocalBackend) serveWebHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "unknown proxy destination", http.StatusInternalServerError)
 			return
 		}
+		b.setProxyRequestHeaders(r, h)
+		p.(http.Handler).ServeHTTP(w, r)
+		return
+	}
+	if h.Backends().Len() > 0 {
+		p, ok := b.serveProxyHandlers.Load(lbKey(h))
+		if !ok {
+			http.Error(w, "unknown proxy destination", http.StatusInternalServerError)
+			return
+		}
+		b.setProxyRequestHeaders(r, h)
 		p.(http.Handler).ServeHTTP(w, r)
 		return
 	}
+	if v := h.Redirect(); v != "" {
+		code := h.StatusCode()
+		if code == 0 {
+			code = http.StatusFound
+		}
+		if !ipn.IsRedirectCode(code) {
+			http.Error(w, "invalid redirect status code", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, v, code)
+		return
+	}
+	if code := h.StatusCode(); code != 0 {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
 
 	http.Error(w, "empty handler", 500)
 }
 
+// serveAccessAllowed reports whether the caller of r may use h, according
+// to its AllowUsers, AllowTags and AllowCaps.
+func (b *LocalBackend) serveAccessAllowed(r *http.Request, h ipn.HTTPHandlerView) bool {
+	if h.AllowUsers().Len() == 0 && h.AllowTags().Len() == 0 && h.AllowCaps().Len() == 0 {
+		return true
+	}
+	sctx, ok := r.Context().Value(serveHTTPContextKey{}).(*serveHTTPContext)
+	if !ok {
+		return false
+	}
+	n, up, ok := b.WhoIs(sctx.SrcAddr)
+	if !ok {
+		return false
+	}
+	if len(n.Tags) == 0 {
+		if h.AllowUsers().ContainsFunc(func(u string) bool { return strings.EqualFold(u, up.LoginName) }) {
+			return true
+		}
+	}
+	for _, tag := range n.Tags {
+		if views.SliceContains(h.AllowTags(), tag) {
+			return true
+		}
+	}
+	if h.AllowCaps().Len() > 0 {
+		for _, c := range b.PeerCaps(sctx.SrcAddr.Addr()) {
+			if views.SliceContains(h.AllowCaps(), c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setProxyRequestHeaders sets the headers configured by h on r before
+// it's forwarded to h's proxy backend.
+func (b *LocalBackend) setProxyRequestHeaders(r *http.Request, h ipn.HTTPHandlerView) {
+	// Never let clients spoof the identity headers, whether or not
+	// this handler adds them.
+	r.Header.Del(identityHeaderLogin)
+	r.Header.Del(identityHeaderName)
+
+	h.SetRequestHeaders().Range(func(k, v string) bool {
+		r.Header.Set(k, v)
+		return true
+	})
+	if !h.IdentityHeaders() {
+		return
+	}
+	sctx, ok := r.Context().Value(serveHTTPContextKey{}).(*serveHTTPContext)
+	if !ok {
+		return
+	}
+	n, up, ok := b.WhoIs(sctx.SrcAddr)
+	if !ok || len(n.Tags) > 0 {
+		// Unknown peers and tagged nodes have no user identity.
+		return
+	}
+	r.Header.Set(identityHeaderLogin, up.LoginName)
+	r.Header.Set(identityHeaderName, up.DisplayName)
+}
+
+// setHeadersResponseWriter is an http.ResponseWriter wrapper that, upon
+// flushing HTTP headers, sets the configured response headers, replacing
+// any set by the handler.
+type setHeadersResponseWriter struct {
+	http.ResponseWriter
+	headers views.Map[string, string]
+	setOnce sync.Once // guards call to set
+}
+
+func (w *setHeadersResponseWriter) set() {
+	h := w.ResponseWriter.Header()
+	w.headers.Range(func(k, v string) bool {
+		h.Set(k, v)
+		return true
+	})
+}
+
+func (w *setHeadersResponseWriter) WriteHeader(code int) {
+	w.setOnce.Do(w.set)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *setHeadersResponseWriter) Write(p []byte) (int, error) {
+	w.setOnce.Do(w.set)
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, so that streaming responses from proxy
+// backends aren't buffered.
+func (w *setHeadersResponseWriter) Flush() {
+	w.setOnce.Do(w.set)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, so that protocol upgrades such as
+// WebSockets can be proxied. httputil.ReverseProxy writes the upgrade
+// response from Header after hijacking, so the configured headers are set
+// first.
+func (w *setHeadersResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", w.ResponseWriter)
+	}
+	w.setOnce.Do(w.set)
+	return hj.Hijack()
+}
+
 func (b *LocalBackend) serveFileOrDirectory(w http.ResponseWriter, r *http.Request, fileOrDir, mountPoint string) {
 	fi, err := os.Stat(fileOrDir)
 	if err != nil {
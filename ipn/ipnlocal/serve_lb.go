@@ -0,0 +1,281 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipnlocal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/types/logger"
+)
+
+const (
+	// lbMaxFails is the number of consecutive failed requests after which
+	// a load balancer backend is ejected from rotation.
+	lbMaxFails = 3
+
+	// lbEjectDuration is how long an ejected backend stays out of
+	// rotation before being retried.
+	lbEjectDuration = 30 * time.Second
+
+	// lbHealthCheckInterval is how often backends are health checked,
+	// if HTTPHandler.HealthCheckPath is set.
+	lbHealthCheckInterval = 10 * time.Second
+)
+
+// lbKey returns the serveProxyHandlers key for the load balancer of h,
+// which must have Backends.
+func lbKey(h ipn.HTTPHandlerView) string {
+	return fmt.Sprintf("lb:%s:%s:%s", h.LBPolicy(), h.HealthCheckPath(), strings.Join(h.Backends().AsSlice(), ","))
+}
+
+// loadBalancer is an http.Handler that proxies each request to one of a
+// set of backends, skipping backends that are failing.
+type loadBalancer struct {
+	logf       logger.Logf
+	policy     string // ipn.LBRoundRobin or ipn.LBLeastConn
+	healthPath string // or empty for no active health checks
+	backends   []*lbBackend
+	next       atomic.Uint32 // round-robin position
+
+	ctx    context.Context // canceled when the load balancer is closed
+	cancel context.CancelFunc
+}
+
+// lbBackend is the state of one of a loadBalancer's backends.
+type lbBackend struct {
+	target string // as in HTTPHandler.Backends
+	proxy  *httputil.ReverseProxy
+	active atomic.Int32 // requests in flight
+
+	mu           sync.Mutex
+	fails        int       // consecutive failed requests
+	ejectedUntil time.Time // zero if not ejected
+	checkFailed  bool      // whether the last health check failed
+	lastErr      string
+}
+
+// newLoadBalancer returns a new load balancer for h, which must have
+// Backends, using newProxy to create the reverse proxy for each backend.
+// If h has a HealthCheckPath, the returned load balancer health checks
+// its backends until it's closed.
+func newLoadBalancer(h ipn.HTTPHandlerView, newProxy func(backend string) (*httputil.ReverseProxy, error), logf logger.Logf) (*loadBalancer, error) {
+	lb := &loadBalancer{
+		logf:       logf,
+		policy:     h.LBPolicy(),
+		healthPath: h.HealthCheckPath(),
+	}
+	switch lb.policy {
+	case "":
+		lb.policy = ipn.LBRoundRobin
+	case ipn.LBRoundRobin, ipn.LBLeastConn:
+	default:
+		return nil, fmt.Errorf("unknown load balancing policy %q", lb.policy)
+	}
+	for i := 0; i < h.Backends().Len(); i++ {
+		target := h.Backends().At(i)
+		rp, err := newProxy(target)
+		if err != nil {
+			return nil, err
+		}
+		be := &lbBackend{target: target, proxy: rp}
+		rp.ModifyResponse = func(res *http.Response) error {
+			// A 5xx (commonly 502, 503 or 504 from a backend that's
+			// itself a proxy or overloaded) counts as a failure, but
+			// is still passed on to the client.
+			if res.StatusCode >= 500 {
+				be.noteFailure(fmt.Errorf("status %v", res.Status))
+				return nil
+			}
+			be.noteSuccess()
+			return nil
+		}
+		rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			if r.Context().Err() == nil {
+				// Only count failures that aren't the client going away.
+				lb.logf("serve: backend %s failed: %v", be.target, err)
+				be.noteFailure(err)
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		lb.backends = append(lb.backends, be)
+	}
+	lb.ctx, lb.cancel = context.WithCancel(context.Background())
+	if lb.healthPath != "" {
+		go lb.healthCheckLoop()
+	}
+	return lb, nil
+}
+
+// Close stops health checking and closes idle backend connections.
+func (lb *loadBalancer) Close() {
+	lb.cancel()
+	for _, be := range lb.backends {
+		if t, ok := be.proxy.Transport.(*http.Transport); ok {
+			t.CloseIdleConnections()
+		}
+	}
+}
+
+func (lb *loadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	be := lb.pick(time.Now())
+	if be == nil {
+		http.Error(w, "no healthy backends", http.StatusServiceUnavailable)
+		return
+	}
+	be.active.Add(1)
+	defer be.active.Add(-1)
+	be.proxy.ServeHTTP(w, r)
+}
+
+// pick returns the backend to send the next request to, or nil if all
+// backends are unhealthy.
+func (lb *loadBalancer) pick(now time.Time) *lbBackend {
+	n := len(lb.backends)
+	start := int(lb.next.Add(1)-1) % n
+	var best *lbBackend
+	bestActive := int32(math.MaxInt32)
+	for i := 0; i < n; i++ {
+		be := lb.backends[(start+i)%n]
+		if !be.healthy(now) {
+			continue
+		}
+		if lb.policy == ipn.LBRoundRobin {
+			return be
+		}
+		if a := be.active.Load(); a < bestActive {
+			best, bestActive = be, a
+		}
+	}
+	return best
+}
+
+func (lb *loadBalancer) healthCheckLoop() {
+	c := &http.Client{
+		Timeout: 5 * time.Second,
+	}
+	t := time.NewTicker(lbHealthCheckInterval)
+	defer t.Stop()
+	for {
+		for _, be := range lb.backends {
+			c.Transport = be.proxy.Transport
+			be.noteHealthCheck(lb.checkHealth(c, be))
+		}
+		select {
+		case <-lb.ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// checkHealth requests the health check path from be, returning an error
+// if it doesn't respond with a 2xx or 3xx status.
+func (lb *loadBalancer) checkHealth(c *http.Client, be *lbBackend) error {
+	targetURL, _ := expandProxyArg(be.target)
+	req, err := http.NewRequestWithContext(lb.ctx, "GET", strings.TrimSuffix(targetURL, "/")+lb.healthPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("health check: %v", res.Status)
+	}
+	return nil
+}
+
+// status returns the status of lb's backends, for the handler at mount
+// on hp.
+func (lb *loadBalancer) status(hp ipn.HostPort, mount string, now time.Time) []ipn.ServeBackendStatus {
+	var ret []ipn.ServeBackendStatus
+	for _, be := range lb.backends {
+		be.mu.Lock()
+		lastErr := be.lastErr
+		be.mu.Unlock()
+		ret = append(ret, ipn.ServeBackendStatus{
+			HostPort:       hp,
+			Mount:          mount,
+			Backend:        be.target,
+			Healthy:        be.healthy(now),
+			ActiveRequests: int(be.active.Load()),
+			LastError:      lastErr,
+		})
+	}
+	return ret
+}
+
+// healthy reports whether be is in rotation at time now.
+func (be *lbBackend) healthy(now time.Time) bool {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	return !be.checkFailed && !now.Before(be.ejectedUntil)
+}
+
+func (be *lbBackend) noteSuccess() {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	be.fails = 0
+}
+
+func (be *lbBackend) noteFailure(err error) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	be.lastErr = err.Error()
+	be.fails++
+	if be.fails >= lbMaxFails {
+		be.fails = 0
+		be.ejectedUntil = time.Now().Add(lbEjectDuration)
+	}
+}
+
+func (be *lbBackend) noteHealthCheck(err error) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	be.checkFailed = err != nil
+	if err != nil {
+		be.lastErr = err.Error()
+	}
+}
+
+// ServeBackendStatus returns the status of the backends of all load
+// balanced serve handlers.
+func (b *LocalBackend) ServeBackendStatus() []ipn.ServeBackendStatus {
+	b.mu.Lock()
+	sc := b.serveConfig
+	b.mu.Unlock()
+
+	var ret []ipn.ServeBackendStatus
+	if !sc.Valid() {
+		return ret
+	}
+	now := time.Now()
+	sc.Web().Range(func(hp ipn.HostPort, conf ipn.WebServerConfigView) bool {
+		conf.Handlers().Range(func(mount string, h ipn.HTTPHandlerView) bool {
+			if h.Backends().Len() == 0 {
+				return true
+			}
+			if v, ok := b.serveProxyHandlers.Load(lbKey(h)); ok {
+				ret = append(ret, v.(*loadBalancer).status(hp, mount, now)...)
+			}
+			return true
+		})
+		return true
+	})
+	return ret
+}
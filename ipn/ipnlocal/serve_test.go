@@ -5,18 +5,33 @@
 package ipnlocal
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/netmap"
+	"tailscale.com/types/persist"
+	"tailscale.com/util/must"
+	"tailscale.com/wgengine/filter"
 )
 
 func TestExpandProxyArg(t *testing.T) {
@@ -60,6 +75,17 @@ func TestGetServeHandler(t *testing.T) {
 			},
 		},
 	}
+	past := time.Now().Add(-time.Minute)
+	expired := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			serverName + ":443": {
+				Handlers: map[string]*ipn.HTTPHandler{
+					"/":    {},
+					"/bar": {Expires: &past},
+				},
+			},
+		},
+	}
 
 	tests := []struct {
 		name string
@@ -128,6 +154,12 @@ func TestGetServeHandler(t *testing.T) {
 			path: "/foo/../../../../../../../../etc/passwd",
 			want: "/",
 		},
+		{
+			name: "expired-not-yet-removed",
+			conf: expired,
+			path: "/bar",
+			want: "/",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -252,3 +284,471 @@ func TestServeFileOrDirectory(t *testing.T) {
 		}
 	}
 }
+
+func TestServeWebHandler(t *testing.T) {
+	// backend echoes the request headers it cares about.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "yes")
+		w.Header().Set("X-Overridden", "backend")
+		fmt.Fprintf(w, "login=%q name=%q foo=%q",
+			r.Header.Get("Tailscale-User-Login"),
+			r.Header.Get("Tailscale-User-Name"),
+			r.Header.Get("X-Foo"))
+	}))
+	defer backend.Close()
+
+	const serverName = "example.ts.net"
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			serverName + ":443": {
+				Handlers: map[string]*ipn.HTTPHandler{
+					"/text":      {Text: "hello"},
+					"/teapot":    {Text: "short and stout", StatusCode: http.StatusTeapot},
+					"/gone":      {StatusCode: http.StatusGone},
+					"/moved":     {Redirect: "https://example.com/new", StatusCode: http.StatusMovedPermanently},
+					"/found":     {Redirect: "/elsewhere"},
+					"/bad-redir": {Redirect: "/elsewhere", StatusCode: http.StatusOK},
+					"/proxy": {
+						Proxy:              backend.URL,
+						SetRequestHeaders:  map[string]string{"X-Foo": "bar"},
+						SetResponseHeaders: map[string]string{"X-Overridden": "serve"},
+					},
+					"/proxy-id": {
+						Proxy:           backend.URL,
+						IdentityHeaders: true,
+					},
+					"/users": {Text: "users", AllowUsers: []string{"Alice@example.com"}},
+					"/tags":  {Text: "tags", AllowTags: []string{"tag:prod"}},
+					"/caps":  {Text: "caps", AllowCaps: []string{"example.com/cap/serve"}},
+				},
+			},
+		},
+	}
+	var (
+		selfIP   = netip.MustParseAddr("100.64.0.1")
+		peerIP   = netip.MustParseAddr("100.64.1.2") // alice's node
+		taggedIP = netip.MustParseAddr("100.64.1.3")
+		otherIP  = netip.MustParseAddr("100.64.1.4") // not in netmap
+	)
+	b := &LocalBackend{
+		serveConfig: conf.View(),
+		logf:        t.Logf,
+		nodeByAddr: map[netip.Addr]*tailcfg.Node{
+			peerIP:   {ID: 1, User: 5},
+			taggedIP: {ID: 2, User: 6, Tags: []string{"tag:prod"}},
+		},
+		netMap: &netmap.NetworkMap{
+			Addresses: []netip.Prefix{netip.PrefixFrom(selfIP, 32)},
+			UserProfiles: map[tailcfg.UserID]tailcfg.UserProfile{
+				5: {ID: 5, LoginName: "alice@example.com", DisplayName: "Alice"},
+				6: {ID: 6, LoginName: "tagged-devices", DisplayName: "tagged devices"},
+			},
+		},
+	}
+	b.filterAtomic.Store(filter.New([]filter.Match{{
+		Srcs: []netip.Prefix{netip.PrefixFrom(peerIP, 32)},
+		Caps: []filter.CapMatch{{Dst: netip.PrefixFrom(selfIP, 32), Cap: "example.com/cap/serve"}},
+	}}, nil, nil, nil, t.Logf))
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.serveProxyHandlers.Store(backend.URL, httputil.NewSingleHostReverseProxy(backendURL))
+
+	tests := []struct {
+		path       string
+		src        netip.Addr // or peerIP if zero
+		header     http.Header
+		wantCode   int
+		wantBody   string // substring
+		wantHeader http.Header
+	}{
+		{path: "/text", wantCode: 200, wantBody: "hello"},
+		{path: "/teapot", wantCode: http.StatusTeapot, wantBody: "short and stout"},
+		{path: "/gone", wantCode: http.StatusGone, wantBody: "Gone"},
+		{path: "/moved", wantCode: http.StatusMovedPermanently, wantHeader: http.Header{"Location": {"https://example.com/new"}}},
+		{path: "/found", wantCode: http.StatusFound, wantHeader: http.Header{"Location": {"/elsewhere"}}},
+		{path: "/bad-redir", wantCode: http.StatusInternalServerError},
+		{
+			path:       "/proxy",
+			header:     http.Header{"Tailscale-User-Login": {"mallory@example.com"}},
+			wantCode:   200,
+			wantBody:   `login="" name="" foo="bar"`,
+			wantHeader: http.Header{"X-Backend": {"yes"}, "X-Overridden": {"serve"}},
+		},
+		{
+			path:     "/proxy-id",
+			header:   http.Header{"Tailscale-User-Login": {"mallory@example.com"}},
+			wantCode: 200,
+			wantBody: `login="alice@example.com" name="Alice" foo=""`,
+		},
+		{path: "/proxy-id", src: taggedIP, wantCode: 200, wantBody: `login="" name="" foo=""`},
+		{path: "/users", wantCode: 200, wantBody: "users"},
+		{path: "/users", src: taggedIP, wantCode: http.StatusForbidden},
+		{path: "/users", src: otherIP, wantCode: http.StatusForbidden},
+		{path: "/tags", src: taggedIP, wantCode: 200, wantBody: "tags"},
+		{path: "/tags", wantCode: http.StatusForbidden},
+		{path: "/caps", wantCode: 200, wantBody: "caps"},
+		{path: "/caps", src: taggedIP, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		src := tt.src
+		if !src.IsValid() {
+			src = peerIP
+		}
+		t.Run(tt.path+"-from-"+src.String(), func(t *testing.T) {
+			req := httptest.NewRequest("GET", "https://"+serverName+tt.path, nil)
+			req.TLS = &tls.ConnectionState{ServerName: serverName}
+			for k, vv := range tt.header {
+				req.Header[k] = vv
+			}
+			req = req.WithContext(context.WithValue(req.Context(), serveHTTPContextKey{}, &serveHTTPContext{
+				// Port 0 so WhoIs doesn't consult the (nil) engine
+				// for netstack-proxied connections.
+				SrcAddr:  netip.AddrPortFrom(src, 0),
+				DestPort: 443,
+			}))
+			rec := httptest.NewRecorder()
+			b.serveWebHandler(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Body.String(); !strings.Contains(got, tt.wantBody) {
+				t.Errorf("body = %q; want substring %q", got, tt.wantBody)
+			}
+			for k, vv := range tt.wantHeader {
+				if got := rec.Header().Values(k); !reflect.DeepEqual(got, vv) {
+					t.Errorf("header %q = %q; want %q", k, got, vv)
+				}
+			}
+		})
+	}
+}
+
+func TestServeWebSocketProxy(t *testing.T) {
+	// backend accepts an upgrade to a protocol that echoes lines back.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "not an upgrade", http.StatusBadRequest)
+			return
+		}
+		c, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("backend Hijack: %v", err)
+			return
+		}
+		defer c.Close()
+		io.WriteString(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		io.WriteString(brw, "echo: "+line)
+		brw.Flush()
+	}))
+	defer backend.Close()
+
+	const serverName = "example.ts.net"
+	conf := &ipn.ServeConfig{
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			serverName + ":443": {
+				Handlers: map[string]*ipn.HTTPHandler{
+					"/ws": {
+						Proxy:              backend.URL,
+						SetResponseHeaders: map[string]string{"X-Served-By": "serve"},
+					},
+				},
+			},
+		},
+	}
+	b := &LocalBackend{
+		serveConfig: conf.View(),
+		logf:        t.Logf,
+	}
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.serveProxyHandlers.Store(backend.URL, httputil.NewSingleHostReverseProxy(backendURL))
+
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.TLS = &tls.ConnectionState{ServerName: serverName}
+		r = r.WithContext(context.WithValue(r.Context(), serveHTTPContextKey{}, &serveHTTPContext{
+			SrcAddr:  netip.MustParseAddrPort("100.64.1.2:0"),
+			DestPort: 443,
+		}))
+		b.serveWebHandler(w, r)
+	}))
+	defer front.Close()
+
+	c, err := net.Dial("tcp", front.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(c, "GET /ws HTTP/1.1\r\nHost: "+serverName+"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(res.Body)
+		t.Fatalf("status = %v; want 101; body: %q", res.Status, body)
+	}
+	if got := res.Header.Get("X-Served-By"); got != "serve" {
+		t.Errorf("X-Served-By = %q; want %q", got, "serve")
+	}
+	io.WriteString(c, "hello\n")
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "echo: hello\n"; line != want {
+		t.Errorf("got %q; want %q", line, want)
+	}
+}
+
+func TestServeConfigExpiryTimer(t *testing.T) {
+	pm := must.Get(newProfileManager(new(mem.Store), t.Logf, "", nil))
+	pm.NewProfile()
+	if err := pm.SetPrefs((&ipn.Prefs{
+		Persist: &persist.Persist{
+			NodeID:         "node1",
+			LoginName:      "alice@example.com",
+			PrivateNodeKey: key.NewNode(),
+		},
+	}).View()); err != nil {
+		t.Fatal(err)
+	}
+	b := &LocalBackend{
+		logf:   t.Logf,
+		pm:     pm,
+		store:  pm.Store(),
+		netMap: &netmap.NetworkMap{SelfNode: &tailcfg.Node{ID: 1}},
+	}
+	defer func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.serveExpiryTimer != nil {
+			b.serveExpiryTimer.Stop()
+		}
+	}()
+
+	soon := time.Now().Add(50 * time.Millisecond)
+	later := time.Now().Add(time.Hour)
+	if err := b.SetServeConfig(&ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{
+			443:  {HTTPS: true},
+			5432: {TCPForward: "localhost:5432", Expires: &later},
+		},
+		Web: map[ipn.HostPort]*ipn.WebServerConfig{
+			"foo.test.ts.net:443": {Handlers: map[string]*ipn.HTTPHandler{
+				"/":    {Text: "hi"},
+				"/tmp": {Text: "tmp", Expires: &soon},
+			}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	hasTimer := func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.serveExpiryTimer != nil
+	}
+	if !hasTimer() {
+		t.Fatal("no expiry timer for config with expiring mappings")
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		wsc, ok := b.ServeConfig().Web().GetOk("foo.test.ts.net:443")
+		if !ok {
+			t.Fatal("web server removed along with its expired mount point")
+		}
+		if !wsc.Handlers().Has("/tmp") {
+			if !wsc.Handlers().Has("/") {
+				t.Error("unexpired mount point removed")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired mount point not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !b.ServeConfig().TCP().Has(5432) {
+		t.Error("unexpired TCP forward removed")
+	}
+	if !hasTimer() {
+		t.Error("no expiry timer for remaining TCP forward")
+	}
+
+	// A check that finds nothing expired re-arms the timer.
+	b.expireServeConfig()
+	if !hasTimer() {
+		t.Error("expiry timer not re-armed after finding nothing expired")
+	}
+
+	// Connections to an expired mapping are rejected even if the timer
+	// hasn't removed it yet, such as after the machine was suspended.
+	past := time.Now().Add(-time.Minute)
+	b.mu.Lock()
+	b.serveConfig = (&ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{5432: {TCPForward: "localhost:5432", Expires: &past}},
+	}).View()
+	b.mu.Unlock()
+	var gotRST bool
+	b.HandleInterceptedTCPConn(5432, netip.MustParseAddrPort("100.64.1.2:1234"), func() (net.Conn, bool) {
+		t.Error("getConn called for expired TCP forward")
+		return nil, false
+	}, func() { gotRST = true })
+	if !gotRST {
+		t.Error("conn to expired TCP forward not reset")
+	}
+
+	// A config with nothing left to expire stops the timer.
+	if err := b.SetServeConfig(&ipn.ServeConfig{
+		TCP: map[uint16]*ipn.TCPPortHandler{5432: {TCPForward: "localhost:5432"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if hasTimer() {
+		t.Error("expiry timer still set for config without expiring mappings")
+	}
+}
+
+func TestLoadBalancer(t *testing.T) {
+	newBackend := func(name string, healthy bool) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" && !healthy {
+				http.Error(w, "sick", http.StatusInternalServerError)
+				return
+			}
+			io.WriteString(w, name)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	s1 := newBackend("s1", true)
+	s2 := newBackend("s2", false)
+	dead := newBackend("dead", true)
+	dead.Close()
+
+	newProxy := func(target string) (*httputil.ReverseProxy, error) {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		return httputil.NewSingleHostReverseProxy(u), nil
+	}
+	newLB := func(policy string) *loadBalancer {
+		h := &ipn.HTTPHandler{
+			Backends: []string{s1.URL, s2.URL, dead.URL},
+			LBPolicy: policy,
+		}
+		lb, err := newLoadBalancer(h.View(), newProxy, t.Logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(lb.Close)
+		return lb
+	}
+	get := func(lb *loadBalancer) (code int, body string) {
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("round-robin-passive-ejection", func(t *testing.T) {
+		lb := newLB("")
+		got := map[string]int{}
+		var fails int
+		for i := 0; i < 30; i++ {
+			code, body := get(lb)
+			if code == http.StatusBadGateway {
+				fails++
+				continue
+			}
+			got[body]++
+		}
+		if fails != lbMaxFails {
+			t.Errorf("got %d failed requests; want %d before ejection", fails, lbMaxFails)
+		}
+		if got["s1"] == 0 || got["s2"] == 0 {
+			t.Errorf("requests not spread across healthy backends: %v", got)
+		}
+		st := lb.status("foo.ts.net:443", "/", time.Now())
+		if len(st) != 3 {
+			t.Fatalf("got %d statuses; want 3", len(st))
+		}
+		if !st[0].Healthy || !st[1].Healthy {
+			t.Errorf("healthy backends reported unhealthy: %+v", st)
+		}
+		if st[2].Healthy || st[2].LastError == "" {
+			t.Errorf("dead backend status = %+v; want unhealthy with error", st[2])
+		}
+		if !lb.backends[2].healthy(time.Now().Add(lbEjectDuration)) {
+			t.Error("dead backend not retried after ejection period")
+		}
+	})
+
+	t.Run("5xx-passive-ejection", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		}))
+		defer unavailable.Close()
+		h := &ipn.HTTPHandler{Backends: []string{s1.URL, unavailable.URL}}
+		lb, err := newLoadBalancer(h.View(), newProxy, t.Logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lb.Close()
+		var fails int
+		for i := 0; i < 20; i++ {
+			code, body := get(lb)
+			if code == http.StatusServiceUnavailable {
+				fails++
+				continue
+			}
+			if code != 200 || body != "s1" {
+				t.Errorf("got %v %q; want 200 from s1", code, body)
+			}
+		}
+		if fails != lbMaxFails {
+			t.Errorf("got %d 503 responses; want %d before ejection", fails, lbMaxFails)
+		}
+		if st := lb.status("foo.ts.net:443", "/", time.Now()); st[1].Healthy || !strings.Contains(st[1].LastError, "503") {
+			t.Errorf("503 backend status = %+v; want unhealthy with error", st[1])
+		}
+	})
+
+	t.Run("health-check", func(t *testing.T) {
+		lb := newLB("")
+		lb.healthPath = "/healthz"
+		for _, be := range lb.backends {
+			be.noteHealthCheck(lb.checkHealth(http.DefaultClient, be))
+		}
+		for i := 0; i < 5; i++ {
+			if code, body := get(lb); code != 200 || body != "s1" {
+				t.Errorf("got %v %q; want 200 from s1, the only healthy backend", code, body)
+			}
+		}
+	})
+
+	t.Run("least-conn", func(t *testing.T) {
+		lb := newLB(ipn.LBLeastConn)
+		lb.backends[0].active.Store(5)
+		lb.backends[2].active.Store(1)
+		for i := 0; i < 5; i++ {
+			if be := lb.pick(time.Now()); be != lb.backends[1] {
+				t.Errorf("picked %s; want least loaded %s", be.target, lb.backends[1].target)
+			}
+		}
+	})
+
+	t.Run("bad-policy", func(t *testing.T) {
+		h := &ipn.HTTPHandler{Backends: []string{s1.URL}, LBPolicy: "random"}
+		if _, err := newLoadBalancer(h.View(), newProxy, t.Logf); err == nil {
+			t.Error("newLoadBalancer with unknown policy succeeded")
+		}
+	})
+}
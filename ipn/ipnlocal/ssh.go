@@ -149,6 +149,16 @@ func (b *LocalBackend) getTailscaleSSH_HostKeys(existing map[string]ssh.Signer)
 	return keys, nil
 }
 
+// SSHPolicyFilePath returns the path of the local SSH policy file, which
+// Tailscale SSH merges with the tailnet's SSH policy if it exists.
+// It returns the empty string if there's no state directory to keep it in.
+func (b *LocalBackend) SSHPolicyFilePath() string {
+	if dir := b.TailscaleVarRoot(); dir != "" {
+		return filepath.Join(dir, "ssh-policy.hujson")
+	}
+	return ""
+}
+
 var keyGenMu sync.Mutex
 
 func (b *LocalBackend) hostKeyFileOrCreate(keyDir, typ string) ([]byte, error) {
@@ -645,3 +645,29 @@ type DebugDERPRegionReport struct {
 	Warnings []string
 	Errors   []string
 }
+
+// SSHSession is an active Tailscale SSH session on this node, as listed
+// by "tailscale ssh sessions".
+type SSHSession struct {
+	ID     string // session ID, as logged and shared with control
+	ConnID string // ID of the SSH connection the session is on
+
+	PeerAddr  netip.AddrPort       // Tailscale IP and port the connection is from
+	PeerNode  tailcfg.StableNodeID // the peer's node
+	PeerName  string               // the peer node's name
+	LoginName string               // login name of the peer node's user
+
+	SSHUser   string // the SSH username requested
+	LocalUser string // the local user the session runs as
+
+	Started time.Time
+
+	// Command is the command the session runs, "subsystem:NAME" for
+	// subsystems like SFTP, or empty for shells.
+	Command string `json:",omitempty"`
+
+	// Recording is the path of the session's local recording file,
+	// "remote" if the recording is streamed to a recorder, or empty if
+	// the session isn't recorded.
+	Recording string `json:",omitempty"`
+}
@@ -29,7 +29,6 @@
 	"golang.org/x/exp/slices"
 	"tailscale.com/client/tailscale/apitype"
 	"tailscale.com/envknob"
-	"tailscale.com/health"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
@@ -67,6 +66,7 @@
 	"component-debug-logging": (*Handler).serveComponentDebugLogging,
 	"debug":                   (*Handler).serveDebug,
 	"debug-derp-region":       (*Handler).serveDebugDERPRegion,
+	"debug-ssh-policy":        (*Handler).serveDebugSSHPolicy,
 	"derpmap":                 (*Handler).serveDERPMap,
 	"dev-set-state-store":     (*Handler).serveDevSetStateStore,
 	"dial":                    (*Handler).serveDial,
@@ -79,9 +79,12 @@
 	"ping":                    (*Handler).servePing,
 	"prefs":                   (*Handler).servePrefs,
 	"pprof":                   (*Handler).servePprof,
+	"serve-backends":          (*Handler).serveServeBackends,
 	"serve-config":            (*Handler).serveServeConfig,
 	"set-dns":                 (*Handler).serveSetDNS,
 	"set-expiry-sooner":       (*Handler).serveSetExpirySooner,
+	"ssh-kill-session":        (*Handler).serveSSHKillSession,
+	"ssh-sessions":            (*Handler).serveSSHSessions,
 	"start":                   (*Handler).serveStart,
 	"status":                  (*Handler).serveStatus,
 	"tka/init":                (*Handler).serveTKAInit,
@@ -109,9 +112,16 @@ func randHex(n int) string {
 	// be globals because we end up creating many Handler instances for the
 	// lifetime of a client.
 	metricsMu sync.Mutex
-	metrics   = map[string]*clientmetric.Metric{}
+	metrics   = map[uploadedMetricKey]*clientmetric.Metric{}
 )
 
+// uploadedMetricKey identifies a metric uploaded by a local client to the
+// node whose client metrics are in reg.
+type uploadedMetricKey struct {
+	reg  *clientmetric.Registry
+	name string
+}
+
 func NewHandler(b *ipnlocal.LocalBackend, logf logger.Logf, logID string) *Handler {
 	return &Handler{b: b, logf: logf, backendLogID: logID}
 }
@@ -146,7 +156,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Referer() != "" || r.Header.Get("Origin") != "" || !validHost(r.Host) {
-		metricInvalidRequests.Add(1)
+		h.metricInvalidRequests().Add(1)
 		http.Error(w, "invalid localapi request", http.StatusForbidden)
 		return
 	}
@@ -157,12 +167,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.RequiredPassword != "" {
 		_, pass, ok := r.BasicAuth()
 		if !ok {
-			metricInvalidRequests.Add(1)
+			h.metricInvalidRequests().Add(1)
 			http.Error(w, "auth required", http.StatusUnauthorized)
 			return
 		}
 		if pass != h.RequiredPassword {
-			metricInvalidRequests.Add(1)
+			h.metricInvalidRequests().Add(1)
 			http.Error(w, "bad password", http.StatusForbidden)
 			return
 		}
@@ -305,7 +315,7 @@ func (h *Handler) serveBugReport(w http.ResponseWriter, r *http.Request) {
 	}
 	hi, _ := json.Marshal(hostinfo.New())
 	h.logf("user bugreport hostinfo: %s", hi)
-	if err := health.OverallError(); err != nil {
+	if err := h.b.HealthTracker().OverallError(); err != nil {
 		h.logf("user bugreport health: %s", err.Error())
 	} else {
 		h.logf("user bugreport health: ok")
@@ -426,7 +436,7 @@ func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/plain")
-	clientmetric.WritePrometheusExpositionFormat(w)
+	h.b.ClientMetrics().WritePrometheusExpositionFormat(w)
 }
 
 func (h *Handler) serveDebug(w http.ResponseWriter, r *http.Request) {
@@ -572,6 +582,19 @@ func (h *Handler) serveServeConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) serveServeBackends(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "serve backends access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.b.ServeBackendStatus())
+}
+
 func (h *Handler) serveCheckIPForwarding(w http.ResponseWriter, r *http.Request) {
 	if !h.PermitRead {
 		http.Error(w, "IP forwarding check access denied", http.StatusForbidden)
@@ -898,7 +921,7 @@ func (h *Handler) serveFileTargets(w http.ResponseWriter, r *http.Request) {
 //
 //   - PUT /localapi/v0/file-put/:stableID/:escaped-filename
 func (h *Handler) serveFilePut(w http.ResponseWriter, r *http.Request) {
-	metricFilePutCalls.Add(1)
+	h.metricFilePutCalls().Add(1)
 
 	if !h.PermitWrite {
 		http.Error(w, "file access denied", http.StatusForbidden)
@@ -984,6 +1007,68 @@ func (h *Handler) serveDERPMap(w http.ResponseWriter, r *http.Request) {
 	e.Encode(h.b.DERPMap())
 }
 
+// serveDebugSSHPolicy returns the effective Tailscale SSH access policy.
+func (h *Handler) serveDebugSSHPolicy(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "debug access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	pol, err := h.b.EffectiveSSHPolicy()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	e.Encode(pol)
+}
+
+// serveSSHSessions returns the active Tailscale SSH sessions.
+func (h *Handler) serveSSHSessions(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitRead {
+		http.Error(w, "ssh-sessions access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "want GET", http.StatusMethodNotAllowed)
+		return
+	}
+	sessions := h.b.SSHSessions()
+	if sessions == nil {
+		sessions = []*ipnstate.SSHSession{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// serveSSHKillSession terminates the Tailscale SSH session, or all the
+// sessions on the connection, with the ID in the "id" parameter.
+func (h *Handler) serveSSHKillSession(w http.ResponseWriter, r *http.Request) {
+	if !h.PermitWrite {
+		http.Error(w, "ssh-kill-session access denied", http.StatusForbidden)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.FormValue("id")
+	if id == "" {
+		http.Error(w, "missing 'id' parameter", http.StatusBadRequest)
+		return
+	}
+	if !h.b.KillSSHSession(id) {
+		http.Error(w, "no such SSH session or connection", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 // serveSetExpirySooner sets the expiry date on the current machine, specified
 // by an `expiry` unix timestamp as POST or query param.
 func (h *Handler) serveSetExpirySooner(w http.ResponseWriter, r *http.Request) {
@@ -1118,28 +1203,30 @@ type clientMetricJSON struct {
 		return
 	}
 
+	reg := h.b.ClientMetrics()
 	metricsMu.Lock()
 	defer metricsMu.Unlock()
 
 	for _, m := range clientMetrics {
-		if metric, ok := metrics[m.Name]; ok {
+		key := uploadedMetricKey{reg, m.Name}
+		if metric, ok := metrics[key]; ok {
 			metric.Add(int64(m.Value))
 		} else {
-			if clientmetric.HasPublished(m.Name) {
+			if reg.HasPublished(m.Name) {
 				http.Error(w, "Already have a metric named "+m.Name, 400)
 				return
 			}
 			var metric *clientmetric.Metric
 			switch m.Type {
 			case "counter":
-				metric = clientmetric.NewCounter(m.Name)
+				metric = reg.Counter(m.Name)
 			case "gauge":
-				metric = clientmetric.NewGauge(m.Name)
+				metric = reg.Gauge(m.Name)
 			default:
 				http.Error(w, "Unknown metric type "+m.Type, 400)
 				return
 			}
-			metrics[m.Name] = metric
+			metrics[key] = metric
 			metric.Add(int64(m.Value))
 		}
 	}
@@ -1431,9 +1518,13 @@ func defBool(a string, def bool) bool {
 	return v
 }
 
-var (
-	metricInvalidRequests = clientmetric.NewCounter("localapi_invalid_requests")
+// metricInvalidRequests counts invalid LocalAPI requests to h's node.
+func (h *Handler) metricInvalidRequests() *clientmetric.Metric {
+	return h.b.ClientMetrics().Counter("localapi_invalid_requests")
+}
 
-	// User-visible LocalAPI endpoints.
-	metricFilePutCalls = clientmetric.NewCounter("localapi_file_put")
-)
+// metricFilePutCalls counts calls to h's node's user-visible file put
+// endpoint.
+func (h *Handler) metricFilePutCalls() *clientmetric.Metric {
+	return h.b.ClientMetrics().Counter("localapi_file_put")
+}
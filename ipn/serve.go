@@ -4,6 +4,13 @@
 
 package ipn
 
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
 // ServeConfigKey returns a StateKey that stores the
 // JSON-encoded ServeConfig for a config profile.
 func ServeConfigKey(profileID ProfileID) StateKey {
@@ -56,9 +63,21 @@ type TCPPortHandler struct {
 	// SNI name with this value. It is only used if TCPForward is non-empty.
 	// (the HTTPS mode uses ServeConfig.Web)
 	TerminateTLS string `json:",omitempty"`
+
+	// ProxyProtocol, if non-zero, is the version (1 or 2) of the HAProxy
+	// PROXY protocol header to send to TCPForward before any connection
+	// data, telling the backend the tailnet source and destination of the
+	// connection. It is only used if TCPForward is non-empty.
+	ProxyProtocol int `json:",omitempty"`
+
+	// Expires, if non-nil, is when this handler is removed from the
+	// ServeConfig. If HTTPS is set, the web servers on the port are
+	// removed with it.
+	Expires *time.Time `json:",omitempty"`
 }
 
-// HTTPHandler is either a path or a proxy to serve.
+// HTTPHandler is either a path, a proxy, a redirect or a fixed response to
+// serve.
 type HTTPHandler struct {
 	// Exactly one of the following may be set.
 
@@ -67,8 +86,111 @@ type HTTPHandler struct {
 
 	Text string `json:",omitempty"` // plaintext to serve (primarily for testing)
 
-	// TODO(bradfitz): bool to not enumerate directories? TTL on mapping for
-	// temporary ones? Error codes? Redirects?
+	Redirect string `json:",omitempty"` // URL to redirect to, with StatusCode
+
+	// Backends are proxy backends, in the same forms as Proxy, across
+	// which requests are load balanced according to LBPolicy.
+	Backends []string `json:",omitempty"`
+
+	// StatusCode is the HTTP status code to respond with.
+	//
+	// With Redirect, it must be a 3xx redirect code, and defaults to
+	// 302 Found. With Text, it defaults to 200 OK. If set without any
+	// of the fields above, the handler responds with StatusCode and its
+	// standard status text.
+	StatusCode int `json:",omitempty"`
+
+	// LBPolicy is how requests are spread across Backends: "round-robin"
+	// (the default) or "least-conn", which picks the backend with the
+	// fewest requests in flight.
+	//
+	// Backends that fail to respond to, or respond with a 5xx status to,
+	// several requests in a row are taken out of rotation for a while.
+	LBPolicy string `json:",omitempty"`
+
+	// HealthCheckPath, if non-empty, is a URL path that tailscaled
+	// periodically requests from each of Backends. Backends that don't
+	// respond with a 2xx or 3xx status are taken out of rotation until
+	// they do.
+	HealthCheckPath string `json:",omitempty"`
+
+	// SetRequestHeaders are headers to set on requests before they're
+	// forwarded to Proxy or Backends, replacing any values sent by the
+	// client.
+	SetRequestHeaders map[string]string `json:",omitempty"`
+
+	// SetResponseHeaders are headers to set on every response from
+	// this handler.
+	SetResponseHeaders map[string]string `json:",omitempty"`
+
+	// IdentityHeaders, if true, means that requests forwarded to Proxy
+	// or Backends have the Tailscale-User-Login and Tailscale-User-Name headers set
+	// to the identity of the tailnet user making the request. Those
+	// headers are always removed from client requests, so backends can
+	// trust them.
+	IdentityHeaders bool `json:",omitempty"`
+
+	// AllowUsers, AllowTags and AllowCaps restrict access to this handler.
+	// If any of them is non-empty, only callers matching at least one
+	// entry of any of them may use the handler; everyone else, including
+	// Funnel traffic from the internet, gets 403 Forbidden.
+	//
+	// AllowUsers are login names ("alice@example.com") of users whose
+	// (untagged) nodes may connect. AllowTags are ACL tags ("tag:prod")
+	// of tagged nodes that may connect. AllowCaps are peer capabilities
+	// that the packet filter grants the caller to this node.
+	AllowUsers []string `json:",omitempty"`
+	AllowTags  []string `json:",omitempty"`
+	AllowCaps  []string `json:",omitempty"`
+
+	// Expires, if non-nil, is when this handler's mount point is removed
+	// from the ServeConfig. A web server is removed along with its last
+	// mount point, and an HTTPS TCP port handler along with the last web
+	// server on its port.
+	Expires *time.Time `json:",omitempty"`
+
+	// TODO(bradfitz): bool to not enumerate directories?
+}
+
+// HasAccessControl reports whether h restricts which callers may use it.
+func (h *HTTPHandler) HasAccessControl() bool {
+	return len(h.AllowUsers) > 0 || len(h.AllowTags) > 0 || len(h.AllowCaps) > 0
+}
+
+// Load balancing policies for HTTPHandler.LBPolicy.
+const (
+	LBRoundRobin = "round-robin"
+	LBLeastConn  = "least-conn"
+)
+
+// ServeBackendStatus is the state of one of an HTTPHandler's load
+// balanced Backends.
+type ServeBackendStatus struct {
+	HostPort HostPort // web server of the handler
+	Mount    string   // mount point of the handler
+	Backend  string   // backend, as in HTTPHandler.Backends
+
+	// Healthy is whether the backend is in rotation. It's false if
+	// the backend is failing its health checks or has been ejected
+	// after failing to respond to requests.
+	Healthy bool
+
+	// ActiveRequests is the number of requests in flight to the backend.
+	ActiveRequests int
+
+	// LastError is the most recent error from the backend, if any.
+	LastError string `json:",omitempty"`
+}
+
+// IsRedirectCode reports whether code is an HTTP status code valid for
+// HTTPHandler.Redirect.
+func IsRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
 // WebHandlerExists checks if the ServeConfig Web handler exists for
@@ -121,6 +243,22 @@ func (sc *ServeConfig) IsTCPForwardingOnPort(port uint16) bool {
 	return !sc.TCP[port].HTTPS
 }
 
+// IsLoadBalancingAny reports whether any Web handler of sc load balances
+// across Backends.
+func (sc *ServeConfig) IsLoadBalancingAny() bool {
+	if sc == nil {
+		return false
+	}
+	for _, wsc := range sc.Web {
+		for _, h := range wsc.Handlers {
+			if len(h.Backends) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // IsServingWeb checks if ServeConfig is currently serving
 // Web/HTTPS on the given port.
 // This is exclusive of TCPForwarding.
@@ -144,3 +282,100 @@ func (sc *ServeConfig) IsFunnelOn() bool {
 	}
 	return false
 }
+
+// NextExpiry returns the earliest Expires time of sc's TCP port handlers
+// and HTTP handlers, reporting false if none of them expire.
+func (sc *ServeConfig) NextExpiry() (t time.Time, ok bool) {
+	if sc == nil {
+		return t, false
+	}
+	note := func(e *time.Time) {
+		if e != nil && (!ok || e.Before(t)) {
+			t, ok = *e, true
+		}
+	}
+	for _, h := range sc.TCP {
+		note(h.Expires)
+	}
+	for _, wsc := range sc.Web {
+		for _, h := range wsc.Handlers {
+			note(h.Expires)
+		}
+	}
+	return t, ok
+}
+
+// RemoveExpired removes the TCP port handlers and HTTP handlers of sc that
+// expired at or before now, reporting whether any were removed.
+//
+// Removing an HTTPS TCP port handler also removes the web servers on that
+// port. Removing the last mount point of a web server removes the web
+// server, and removing the last web server on a port also removes its TCP
+// port handler.
+func (sc *ServeConfig) RemoveExpired(now time.Time) bool {
+	if sc == nil {
+		return false
+	}
+	expired := func(e *time.Time) bool {
+		return e != nil && !now.Before(*e)
+	}
+	changed := false
+	for port, h := range sc.TCP {
+		if !expired(h.Expires) {
+			continue
+		}
+		delete(sc.TCP, port)
+		changed = true
+		if h.HTTPS {
+			for hp := range sc.Web {
+				if hostPortPort(hp) == port {
+					delete(sc.Web, hp)
+					delete(sc.AllowFunnel, hp)
+				}
+			}
+		}
+	}
+	for hp, wsc := range sc.Web {
+		removed := false
+		for mount, h := range wsc.Handlers {
+			if expired(h.Expires) {
+				delete(wsc.Handlers, mount)
+				removed = true
+			}
+		}
+		if !removed {
+			continue
+		}
+		changed = true
+		if len(wsc.Handlers) > 0 {
+			continue
+		}
+		delete(sc.Web, hp)
+		delete(sc.AllowFunnel, hp)
+		port := hostPortPort(hp)
+		if !sc.IsServingWeb(port) {
+			continue
+		}
+		inUse := false
+		for hp := range sc.Web {
+			if hostPortPort(hp) == port {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			delete(sc.TCP, port)
+		}
+	}
+	return changed
+}
+
+// hostPortPort returns the port number of hp, or 0 if it's invalid.
+func hostPortPort(hp HostPort) uint16 {
+	_, portStr, err := net.SplitHostPort(string(hp))
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.ParseUint(portStr, 10, 16)
+	return uint16(port)
+}
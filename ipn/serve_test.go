@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipn
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServeConfigExpiry(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	past := now.Add(-time.Minute)
+	soon := now.Add(time.Minute)
+	later := now.Add(time.Hour)
+
+	handlers := func(expires *time.Time) map[string]*HTTPHandler {
+		return map[string]*HTTPHandler{"/": {Text: "hi", Expires: expires}}
+	}
+	sc := &ServeConfig{
+		TCP: map[uint16]*TCPPortHandler{
+			443:   {HTTPS: true},
+			8443:  {HTTPS: true, Expires: &past},
+			10000: {HTTPS: true},
+			5432:  {TCPForward: "localhost:5432", Expires: &past},
+			5433:  {TCPForward: "localhost:5433", Expires: &later},
+		},
+		Web: map[HostPort]*WebServerConfig{
+			"foo.test.ts.net:443":   {Handlers: handlers(&past)},
+			"bar.test.ts.net:443":   {Handlers: handlers(&soon)},
+			"foo.test.ts.net:8443":  {Handlers: handlers(nil)},
+			"foo.test.ts.net:10000": {Handlers: handlers(&past)},
+			"baz.test.ts.net:443": {Handlers: map[string]*HTTPHandler{
+				"/":    {Text: "hi"},
+				"/tmp": {Text: "tmp", Expires: &past},
+			}},
+		},
+		AllowFunnel: map[HostPort]bool{
+			"foo.test.ts.net:443": true,
+		},
+	}
+
+	if got, ok := sc.NextExpiry(); !ok || !got.Equal(past) {
+		t.Errorf("NextExpiry = %v, %v; want %v, true", got, ok, past)
+	}
+	if !sc.RemoveExpired(now) {
+		t.Fatal("RemoveExpired = false; want true")
+	}
+	want := &ServeConfig{
+		TCP: map[uint16]*TCPPortHandler{
+			443:  {HTTPS: true},
+			5433: {TCPForward: "localhost:5433", Expires: &later},
+		},
+		Web: map[HostPort]*WebServerConfig{
+			"bar.test.ts.net:443": {Handlers: handlers(&soon)},
+			"baz.test.ts.net:443": {Handlers: map[string]*HTTPHandler{
+				"/": {Text: "hi"},
+			}},
+		},
+		AllowFunnel: map[HostPort]bool{},
+	}
+	if !reflect.DeepEqual(sc, want) {
+		t.Errorf("after RemoveExpired:\n got: %+v\nwant: %+v", sc, want)
+	}
+	if got, ok := sc.NextExpiry(); !ok || !got.Equal(soon) {
+		t.Errorf("NextExpiry = %v, %v; want %v, true", got, ok, soon)
+	}
+	if sc.RemoveExpired(now) {
+		t.Error("second RemoveExpired = true; want false")
+	}
+
+	if _, ok := (&ServeConfig{TCP: map[uint16]*TCPPortHandler{443: {HTTPS: true}}}).NextExpiry(); ok {
+		t.Error("NextExpiry of config without expiry = true; want false")
+	}
+}
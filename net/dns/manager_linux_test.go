@@ -11,6 +11,7 @@
 	"strings"
 	"testing"
 
+	"tailscale.com/health"
 	"tailscale.com/tstest"
 	"tailscale.com/util/cmpver"
 )
@@ -245,7 +246,7 @@ func TestLinuxDNSMode(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var logBuf tstest.MemLogger
-			got, err := dnsMode(logBuf.Logf, tt.env)
+			got, err := dnsMode(logBuf.Logf, health.NewTracker(), tt.env)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -9,6 +9,7 @@
 	"fmt"
 	"os"
 
+	"tailscale.com/health"
 	"tailscale.com/types/logger"
 )
 
@@ -20,7 +21,7 @@ func (kv kv) String() string {
 	return fmt.Sprintf("%s=%s", kv.k, kv.v)
 }
 
-func NewOSConfigurator(logf logger.Logf, interfaceName string) (OSConfigurator, error) {
+func NewOSConfigurator(logf logger.Logf, _ *health.Tracker, interfaceName string) (OSConfigurator, error) {
 	return newOSConfigurator(logf, interfaceName,
 		newOSConfigEnv{
 			rcIsResolvd: rcIsResolvd,
@@ -182,6 +182,7 @@ type forwarder struct {
 	linkMon *monitor.Mon
 	linkSel ForwardLinkSelector // TODO(bradfitz): remove this when tsdial.Dialer absorbs it
 	dialer  *tsdial.Dialer
+	metrics *metrics // the Resolver's
 	dohSem  chan struct{}
 
 	ctx       context.Context    // good until Close
@@ -233,12 +234,13 @@ func maxDoHInFlight(goos string) int {
 	return 1000
 }
 
-func newForwarder(logf logger.Logf, linkMon *monitor.Mon, linkSel ForwardLinkSelector, dialer *tsdial.Dialer) *forwarder {
+func newForwarder(logf logger.Logf, linkMon *monitor.Mon, linkSel ForwardLinkSelector, dialer *tsdial.Dialer, m *metrics) *forwarder {
 	f := &forwarder{
 		logf:    logger.WithPrefix(logf, "forward: "),
 		linkMon: linkMon,
 		linkSel: linkSel,
 		dialer:  dialer,
+		metrics: m,
 		dohSem:  make(chan struct{}, maxDoHInFlight(runtime.GOOS)),
 	}
 	f.ctx, f.ctxCancel = context.WithCancel(context.Background())
@@ -450,7 +452,7 @@ func (f *forwarder) sendDoH(ctx context.Context, urlBase string, c *http.Client,
 	}
 	defer f.releaseDoHSem()
 
-	metricDNSFwdDoH.Add(1)
+	f.metrics.fwdDoH.Add(1)
 	req, err := http.NewRequestWithContext(ctx, "POST", urlBase, bytes.NewReader(packet))
 	if err != nil {
 		return nil, err
@@ -461,24 +463,24 @@ func (f *forwarder) sendDoH(ctx context.Context, urlBase string, c *http.Client,
 
 	hres, err := c.Do(req)
 	if err != nil {
-		metricDNSFwdDoHErrorTransport.Add(1)
+		f.metrics.fwdDoHErrorTransport.Add(1)
 		return nil, err
 	}
 	defer hres.Body.Close()
 	if hres.StatusCode != 200 {
-		metricDNSFwdDoHErrorStatus.Add(1)
+		f.metrics.fwdDoHErrorStatus.Add(1)
 		return nil, errors.New(hres.Status)
 	}
 	if ct := hres.Header.Get("Content-Type"); ct != dohType {
-		metricDNSFwdDoHErrorCT.Add(1)
+		f.metrics.fwdDoHErrorCT.Add(1)
 		return nil, fmt.Errorf("unexpected response Content-Type %q", ct)
 	}
 	res, err := io.ReadAll(hres.Body)
 	if err != nil {
-		metricDNSFwdDoHErrorBody.Add(1)
+		f.metrics.fwdDoHErrorBody.Add(1)
 	}
 	if truncatedFlagSet(res) {
-		metricDNSFwdTruncated.Add(1)
+		f.metrics.fwdTruncated.Add(1)
 	}
 	return res, err
 }
@@ -509,11 +511,11 @@ func (f *forwarder) send(ctx context.Context, fq *forwardQuery, rr resolverAndDe
 		if hc, ok := f.getKnownDoHClientForProvider(urlBase); ok {
 			return f.sendDoH(ctx, urlBase, hc, fq.packet)
 		}
-		metricDNSFwdErrorType.Add(1)
+		f.metrics.fwdErrorType.Add(1)
 		return nil, fmt.Errorf("arbitrary https:// resolvers not supported yet")
 	}
 	if strings.HasPrefix(rr.name.Addr, "tls://") {
-		metricDNSFwdErrorType.Add(1)
+		f.metrics.fwdErrorType.Add(1)
 		return nil, fmt.Errorf("tls:// resolvers not supported yet")
 	}
 
@@ -525,10 +527,10 @@ func (f *forwarder) send(ctx context.Context, fq *forwardQuery, rr resolverAndDe
 func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAndDelay) (ret []byte, err error) {
 	ipp, ok := rr.name.IPPort()
 	if !ok {
-		metricDNSFwdErrorType.Add(1)
+		f.metrics.fwdErrorType.Add(1)
 		return nil, fmt.Errorf("unrecognized resolver type %q", rr.name.Addr)
 	}
-	metricDNSFwdUDP.Add(1)
+	f.metrics.fwdUDP.Add(1)
 
 	ln, err := f.packetListener(ipp.Addr())
 	if err != nil {
@@ -551,13 +553,13 @@ func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAn
 	defer fq.closeOnCtxDone.Remove(conn)
 
 	if _, err := conn.WriteToUDPAddrPort(fq.packet, ipp); err != nil {
-		metricDNSFwdUDPErrorWrite.Add(1)
+		f.metrics.fwdUDPErrorWrite.Add(1)
 		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
 		return nil, err
 	}
-	metricDNSFwdUDPWrote.Add(1)
+	f.metrics.fwdUDPWrote.Add(1)
 
 	// The 1 extra byte is to detect packet truncation.
 	out := make([]byte, maxResponseBytes+1)
@@ -569,7 +571,7 @@ func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAn
 		if neterror.PacketWasTruncated(err) {
 			err = nil
 		} else {
-			metricDNSFwdUDPErrorRead.Add(1)
+			f.metrics.fwdUDPErrorRead.Add(1)
 			return nil, err
 		}
 	}
@@ -583,14 +585,14 @@ func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAn
 	out = out[:n]
 	txid := getTxID(out)
 	if txid != fq.txid {
-		metricDNSFwdUDPErrorTxID.Add(1)
+		f.metrics.fwdUDPErrorTxID.Add(1)
 		return nil, errors.New("txid doesn't match")
 	}
 	rcode := getRCode(out)
 	// don't forward transient errors back to the client when the server fails
 	if rcode == dns.RCodeServerFailure {
 		f.logf("recv: response code indicating server failure: %d", rcode)
-		metricDNSFwdUDPErrorServer.Add(1)
+		f.metrics.fwdUDPErrorServer.Add(1)
 		return nil, errServerFailure
 	}
 
@@ -608,11 +610,11 @@ func (f *forwarder) sendUDP(ctx context.Context, fq *forwardQuery, rr resolverAn
 	}
 
 	if truncatedFlagSet(out) {
-		metricDNSFwdTruncated.Add(1)
+		f.metrics.fwdTruncated.Add(1)
 	}
 
 	clampEDNSSize(out, maxResponseBytes)
-	metricDNSFwdUDPSuccess.Add(1)
+	f.metrics.fwdUDPSuccess.Add(1)
 	return out, nil
 }
 
@@ -663,10 +665,10 @@ type forwardQuery struct {
 // If resolvers is non-empty, it's used explicitly (notably, for exit
 // node DNS proxy queries), otherwise f.resolvers is used.
 func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, responseChan chan<- packet, resolvers ...resolverAndDelay) error {
-	metricDNSFwd.Add(1)
+	f.metrics.fwd.Add(1)
 	domain, err := nameFromQuery(query.bs)
 	if err != nil {
-		metricDNSFwdErrorName.Add(1)
+		f.metrics.fwdErrorName.Add(1)
 		return err
 	}
 
@@ -679,7 +681,7 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 	// when browsing for LAN devices.  But even when filtering this
 	// out, playing on Sonos still works.
 	if hasRDNSBonjourPrefix(domain) {
-		metricDNSFwdDropBonjour.Add(1)
+		f.metrics.fwdDropBonjour.Add(1)
 		res, err := nxDomainResponse(query)
 		if err != nil {
 			f.logf("error parsing bonjour query: %v", err)
@@ -704,7 +706,7 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 	if len(resolvers) == 0 {
 		resolvers = f.resolvers(domain)
 		if len(resolvers) == 0 {
-			metricDNSFwdErrorNoUpstream.Add(1)
+			f.metrics.fwdErrorNoUpstream.Add(1)
 			f.logf("no upstream resolvers set, returning SERVFAIL")
 			res, err := servfailResponse(query)
 			if err != nil {
@@ -764,10 +766,10 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 		case v := <-resc:
 			select {
 			case <-ctx.Done():
-				metricDNSFwdErrorContext.Add(1)
+				f.metrics.fwdErrorContext.Add(1)
 				return ctx.Err()
 			case responseChan <- packet{v, query.addr}:
-				metricDNSFwdSuccess.Add(1)
+				f.metrics.fwdSuccess.Add(1)
 				return nil
 			}
 		case err := <-errc:
@@ -785,17 +787,17 @@ func (f *forwarder) forwardWithDestChan(ctx context.Context, query packet, respo
 
 					select {
 					case <-ctx.Done():
-						metricDNSFwdErrorContext.Add(1)
-						metricDNSFwdErrorContextGotError.Add(1)
+						f.metrics.fwdErrorContext.Add(1)
+						f.metrics.fwdErrorContextGotError.Add(1)
 					case responseChan <- res:
 					}
 				}
 				return firstErr
 			}
 		case <-ctx.Done():
-			metricDNSFwdErrorContext.Add(1)
+			f.metrics.fwdErrorContext.Add(1)
 			if firstErr != nil {
-				metricDNSFwdErrorContextGotError.Add(1)
+				f.metrics.fwdErrorContextGotError.Add(1)
 				return firstErr
 			}
 			return ctx.Err()
@@ -183,6 +183,7 @@ type Resolver struct {
 	linkMon            *monitor.Mon     // or nil
 	dialer             *tsdial.Dialer   // non-nil
 	saveConfigForTests func(cfg Config) // used in tests to capture resolver config
+	metrics            *metrics         // non-nil
 	// forwarder forwards requests to upstream nameservers.
 	forwarder *forwarder
 
@@ -207,10 +208,15 @@ type ForwardLinkSelector interface {
 
 // New returns a new resolver.
 // linkMon optionally specifies a link monitor to use for socket rebinding.
-func New(logf logger.Logf, linkMon *monitor.Mon, linkSel ForwardLinkSelector, dialer *tsdial.Dialer) *Resolver {
+// clientMetrics is where the resolver records its client metrics; if nil,
+// clientmetric.Global is used.
+func New(logf logger.Logf, linkMon *monitor.Mon, linkSel ForwardLinkSelector, dialer *tsdial.Dialer, clientMetrics *clientmetric.Registry) *Resolver {
 	if dialer == nil {
 		panic("nil Dialer")
 	}
+	if clientMetrics == nil {
+		clientMetrics = clientmetric.Global()
+	}
 	r := &Resolver{
 		logf:     logger.WithPrefix(logf, "resolver: "),
 		linkMon:  linkMon,
@@ -218,8 +224,9 @@ func New(logf logger.Logf, linkMon *monitor.Mon, linkSel ForwardLinkSelector, di
 		hostToIP: map[dnsname.FQDN][]netip.Addr{},
 		ipToHost: map[netip.Addr]dnsname.FQDN{},
 		dialer:   dialer,
+		metrics:  newMetrics(clientMetrics),
 	}
-	r.forwarder = newForwarder(r.logf, linkMon, linkSel, dialer)
+	r.forwarder = newForwarder(r.logf, linkMon, linkSel, dialer, r.metrics)
 	return r
 }
 
@@ -268,10 +275,10 @@ func (r *Resolver) Close() {
 const dnsQueryTimeout = 10 * time.Second
 
 func (r *Resolver) Query(ctx context.Context, bs []byte, from netip.AddrPort) ([]byte, error) {
-	metricDNSQueryLocal.Add(1)
+	r.metrics.queryLocal.Add(1)
 	select {
 	case <-r.closed:
-		metricDNSQueryErrorClosed.Add(1)
+		r.metrics.queryErrorClosed.Add(1)
 		return nil, net.ErrClosed
 	default:
 	}
@@ -325,7 +332,7 @@ func parseExitNodeQuery(q []byte) *response {
 // and a nil error.
 // TODO: figure out if we even need an error result.
 func (r *Resolver) HandleExitNodeDNSQuery(ctx context.Context, q []byte, from netip.AddrPort, allowName func(name string) bool) (res []byte, err error) {
-	metricDNSExitProxyQuery.Add(1)
+	r.metrics.exitProxyQuery.Add(1)
 	ch := make(chan packet, 1)
 
 	resp := parseExitNodeQuery(q)
@@ -334,7 +341,7 @@ func (r *Resolver) HandleExitNodeDNSQuery(ctx context.Context, q []byte, from ne
 	}
 	name := resp.Question.Name.String()
 	if !allowName(name) {
-		metricDNSExitProxyErrorName.Add(1)
+		r.metrics.exitProxyErrorName.Add(1)
 		resp.Header.RCode = dns.RCodeRefused
 		return marshalResponse(resp)
 	}
@@ -353,7 +360,7 @@ func (r *Resolver) HandleExitNodeDNSQuery(ctx context.Context, q []byte, from ne
 		nameserver, err := stubResolverForOS()
 		if err != nil {
 			r.logf("stubResolverForOS: %v", err)
-			metricDNSExitProxyErrorResolvConf.Add(1)
+			r.metrics.exitProxyErrorResolvConf.Add(1)
 			return nil, err
 		}
 		// TODO: more than 1 resolver from /etc/resolv.conf?
@@ -372,7 +379,7 @@ func (r *Resolver) HandleExitNodeDNSQuery(ctx context.Context, q []byte, from ne
 
 		err = r.forwarder.forwardWithDestChan(ctx, packet{q, from}, ch, resolvers...)
 		if err != nil {
-			metricDNSExitProxyErrorForward.Add(1)
+			r.metrics.exitProxyErrorForward.Add(1)
 			return nil, err
 		}
 	}
@@ -533,10 +540,10 @@ func stubResolverForOS() (ip netip.Addr, err error) {
 // Returns dns.RCodeRefused to indicate that the local map is not
 // authoritative for domain.
 func (r *Resolver) resolveLocal(domain dnsname.FQDN, typ dns.Type) (netip.Addr, dns.RCode) {
-	metricDNSResolveLocal.Add(1)
+	r.metrics.resolveLocal.Add(1)
 	// Reject .onion domains per RFC 7686.
 	if dnsname.HasSuffix(domain.WithoutTrailingDot(), ".onion") {
-		metricDNSResolveLocalErrorOnion.Add(1)
+		r.metrics.resolveLocalErrorOnion.Add(1)
 		return netip.Addr{}, dns.RCodeNameError
 	}
 
@@ -566,7 +573,7 @@ func (r *Resolver) resolveLocal(domain dnsname.FQDN, typ dns.Type) (netip.Addr,
 		for _, suffix := range localDomains {
 			if suffix.Contains(domain) {
 				// We are authoritative for the queried domain.
-				metricDNSResolveLocalErrorMissing.Add(1)
+				r.metrics.resolveLocalErrorMissing.Add(1)
 				return netip.Addr{}, dns.RCodeNameError
 			}
 		}
@@ -584,37 +591,37 @@ func (r *Resolver) resolveLocal(domain dnsname.FQDN, typ dns.Type) (netip.Addr,
 	case dns.TypeA:
 		for _, ip := range addrs {
 			if ip.Is4() {
-				metricDNSResolveLocalOKA.Add(1)
+				r.metrics.resolveLocalOKA.Add(1)
 				return ip, dns.RCodeSuccess
 			}
 		}
-		metricDNSResolveLocalNoA.Add(1)
+		r.metrics.resolveLocalNoA.Add(1)
 		return netip.Addr{}, dns.RCodeSuccess
 	case dns.TypeAAAA:
 		for _, ip := range addrs {
 			if ip.Is6() {
-				metricDNSResolveLocalOKAAAA.Add(1)
+				r.metrics.resolveLocalOKAAAA.Add(1)
 				return ip, dns.RCodeSuccess
 			}
 		}
-		metricDNSResolveLocalNoAAAA.Add(1)
+		r.metrics.resolveLocalNoAAAA.Add(1)
 		return netip.Addr{}, dns.RCodeSuccess
 	case dns.TypeALL:
 		// Answer with whatever we've got.
 		// It could be IPv4, IPv6, or a zero addr.
 		// TODO: Return all available resolutions (A and AAAA, if we have them).
 		if len(addrs) == 0 {
-			metricDNSResolveLocalNoAll.Add(1)
+			r.metrics.resolveLocalNoAll.Add(1)
 			return netip.Addr{}, dns.RCodeSuccess
 		}
-		metricDNSResolveLocalOKAll.Add(1)
+		r.metrics.resolveLocalOKAll.Add(1)
 		return addrs[0], dns.RCodeSuccess
 
 	// Leave some record types explicitly unimplemented.
 	// These types relate to recursive resolution or special
 	// DNS semantics and might be implemented in the future.
 	case dns.TypeNS, dns.TypeSOA, dns.TypeAXFR, dns.TypeHINFO:
-		metricDNSResolveNotImplType.Add(1)
+		r.metrics.resolveNotImplType.Add(1)
 		return netip.Addr{}, dns.RCodeNotImplemented
 
 	// For everything except for the few types above that are explicitly not implemented, return no records.
@@ -624,7 +631,7 @@ func (r *Resolver) resolveLocal(domain dnsname.FQDN, typ dns.Type) (netip.Addr,
 	//   dig -t TYPE9824 example.com
 	// and note that NOERROR is returned, despite that record type being made up.
 	default:
-		metricDNSResolveNoRecordType.Add(1)
+		r.metrics.resolveNoRecordType.Add(1)
 		// The name exists, but no records exist of the requested type.
 		return netip.Addr{}, dns.RCodeSuccess
 	}
@@ -1148,17 +1155,17 @@ func rdnsNameToIPv6(name dnsname.FQDN) (ip netip.Addr, ok bool) {
 // It is assumed that resp.Question is populated by respond before this is called.
 func (r *Resolver) respondReverse(query []byte, name dnsname.FQDN, resp *response) ([]byte, error) {
 	if hasRDNSBonjourPrefix(name) {
-		metricDNSReverseMissBonjour.Add(1)
+		r.metrics.reverseMissBonjour.Add(1)
 		return nil, errNotOurName
 	}
 
 	resp.Name, resp.Header.RCode = r.resolveLocalReverse(name)
 	if resp.Header.RCode == dns.RCodeRefused {
-		metricDNSReverseMissOther.Add(1)
+		r.metrics.reverseMissOther.Add(1)
 		return nil, errNotOurName
 	}
 
-	metricDNSMagicDNSSuccessReverse.Add(1)
+	r.metrics.magicDNSSuccessReverse.Add(1)
 	return marshalResponse(resp)
 }
 
@@ -1175,10 +1182,10 @@ func (r *Resolver) respond(query []byte) ([]byte, error) {
 	// We will not return this error: it is the sender's fault.
 	if err != nil {
 		if errors.Is(err, dns.ErrSectionDone) {
-			metricDNSErrorParseNoQ.Add(1)
+			r.metrics.errorParseNoQ.Add(1)
 			r.logf("parseQuery(%02x): no DNS questions", query)
 		} else {
-			metricDNSErrorParseQuery.Add(1)
+			r.metrics.errorParseQuery.Add(1)
 			r.logf("parseQuery(%02x): %v", query, err)
 		}
 		resp := parser.response()
@@ -1188,7 +1195,7 @@ func (r *Resolver) respond(query []byte) ([]byte, error) {
 	rawName := parser.Question.Name.Data[:parser.Question.Name.Length]
 	name, err := dnsname.ToFQDN(rawNameToLower(rawName))
 	if err != nil {
-		metricDNSErrorNotFQDN.Add(1)
+		r.metrics.errorNotFQDN.Add(1)
 		// DNS packet unexpectedly contains an invalid FQDN.
 		resp := parser.response()
 		resp.Header.RCode = dns.RCodeFormatError
@@ -1243,61 +1250,114 @@ func unARPA(a string) (ipStr string, ok bool) {
 
 }
 
-var (
-	metricDNSQueryLocal       = clientmetric.NewCounter("dns_query_local")
-	metricDNSQueryErrorClosed = clientmetric.NewCounter("dns_query_local_error_closed")
-
-	metricDNSErrorParseNoQ   = clientmetric.NewCounter("dns_query_respond_error_no_question")
-	metricDNSErrorParseQuery = clientmetric.NewCounter("dns_query_respond_error_parse")
-	metricDNSErrorNotFQDN    = clientmetric.NewCounter("dns_query_respond_error_not_fqdn")
-
-	metricDNSMagicDNSSuccessName    = clientmetric.NewCounter("dns_query_magic_success_name")
-	metricDNSMagicDNSSuccessReverse = clientmetric.NewCounter("dns_query_magic_success_reverse")
-
-	metricDNSExitProxyQuery           = clientmetric.NewCounter("dns_exit_node_query")
-	metricDNSExitProxyErrorName       = clientmetric.NewCounter("dns_exit_node_error_name")
-	metricDNSExitProxyErrorForward    = clientmetric.NewCounter("dns_exit_node_error_forward")
-	metricDNSExitProxyErrorResolvConf = clientmetric.NewCounter("dns_exit_node_error_resolvconf")
-
-	metricDNSFwd                     = clientmetric.NewCounter("dns_query_fwd")
-	metricDNSFwdDropBonjour          = clientmetric.NewCounter("dns_query_fwd_drop_bonjour")
-	metricDNSFwdErrorName            = clientmetric.NewCounter("dns_query_fwd_error_name")
-	metricDNSFwdErrorNoUpstream      = clientmetric.NewCounter("dns_query_fwd_error_no_upstream")
-	metricDNSFwdSuccess              = clientmetric.NewCounter("dns_query_fwd_success")
-	metricDNSFwdErrorContext         = clientmetric.NewCounter("dns_query_fwd_error_context")
-	metricDNSFwdErrorContextGotError = clientmetric.NewCounter("dns_query_fwd_error_context_got_error")
-
-	metricDNSFwdErrorType      = clientmetric.NewCounter("dns_query_fwd_error_type")
-	metricDNSFwdErrorParseAddr = clientmetric.NewCounter("dns_query_fwd_error_parse_addr")
-	metricDNSFwdTruncated      = clientmetric.NewCounter("dns_query_fwd_truncated")
-
-	metricDNSFwdUDP            = clientmetric.NewCounter("dns_query_fwd_udp")       // on entry
-	metricDNSFwdUDPWrote       = clientmetric.NewCounter("dns_query_fwd_udp_wrote") // sent UDP packet
-	metricDNSFwdUDPErrorWrite  = clientmetric.NewCounter("dns_query_fwd_udp_error_write")
-	metricDNSFwdUDPErrorServer = clientmetric.NewCounter("dns_query_fwd_udp_error_server")
-	metricDNSFwdUDPErrorTxID   = clientmetric.NewCounter("dns_query_fwd_udp_error_txid")
-	metricDNSFwdUDPErrorRead   = clientmetric.NewCounter("dns_query_fwd_udp_error_read")
-	metricDNSFwdUDPSuccess     = clientmetric.NewCounter("dns_query_fwd_udp_success")
-
-	metricDNSFwdDoH               = clientmetric.NewCounter("dns_query_fwd_doh")
-	metricDNSFwdDoHErrorStatus    = clientmetric.NewCounter("dns_query_fwd_doh_error_status")
-	metricDNSFwdDoHErrorCT        = clientmetric.NewCounter("dns_query_fwd_doh_error_content_type")
-	metricDNSFwdDoHErrorTransport = clientmetric.NewCounter("dns_query_fwd_doh_error_transport")
-	metricDNSFwdDoHErrorBody      = clientmetric.NewCounter("dns_query_fwd_doh_error_body")
-
-	metricDNSResolveLocal             = clientmetric.NewCounter("dns_resolve_local")
-	metricDNSResolveLocalErrorOnion   = clientmetric.NewCounter("dns_resolve_local_error_onion")
-	metricDNSResolveLocalErrorMissing = clientmetric.NewCounter("dns_resolve_local_error_missing")
-	metricDNSResolveLocalErrorRefused = clientmetric.NewCounter("dns_resolve_local_error_refused")
-	metricDNSResolveLocalOKA          = clientmetric.NewCounter("dns_resolve_local_ok_a")
-	metricDNSResolveLocalOKAAAA       = clientmetric.NewCounter("dns_resolve_local_ok_aaaa")
-	metricDNSResolveLocalOKAll        = clientmetric.NewCounter("dns_resolve_local_ok_all")
-	metricDNSResolveLocalNoA          = clientmetric.NewCounter("dns_resolve_local_no_a")
-	metricDNSResolveLocalNoAAAA       = clientmetric.NewCounter("dns_resolve_local_no_aaaa")
-	metricDNSResolveLocalNoAll        = clientmetric.NewCounter("dns_resolve_local_no_all")
-	metricDNSResolveNotImplType       = clientmetric.NewCounter("dns_resolve_local_not_impl_type")
-	metricDNSResolveNoRecordType      = clientmetric.NewCounter("dns_resolve_local_no_record_type")
-
-	metricDNSReverseMissBonjour = clientmetric.NewCounter("dns_reverse_miss_bonjour")
-	metricDNSReverseMissOther   = clientmetric.NewCounter("dns_reverse_miss_other")
-)
+// metrics are a Resolver's client metrics.
+type metrics struct {
+	queryLocal       *clientmetric.Metric
+	queryErrorClosed *clientmetric.Metric
+
+	errorParseNoQ   *clientmetric.Metric
+	errorParseQuery *clientmetric.Metric
+	errorNotFQDN    *clientmetric.Metric
+
+	magicDNSSuccessName    *clientmetric.Metric
+	magicDNSSuccessReverse *clientmetric.Metric
+
+	exitProxyQuery           *clientmetric.Metric
+	exitProxyErrorName       *clientmetric.Metric
+	exitProxyErrorForward    *clientmetric.Metric
+	exitProxyErrorResolvConf *clientmetric.Metric
+
+	fwd                     *clientmetric.Metric
+	fwdDropBonjour          *clientmetric.Metric
+	fwdErrorName            *clientmetric.Metric
+	fwdErrorNoUpstream      *clientmetric.Metric
+	fwdSuccess              *clientmetric.Metric
+	fwdErrorContext         *clientmetric.Metric
+	fwdErrorContextGotError *clientmetric.Metric
+
+	fwdErrorType      *clientmetric.Metric
+	fwdErrorParseAddr *clientmetric.Metric
+	fwdTruncated      *clientmetric.Metric
+
+	fwdUDP            *clientmetric.Metric // on entry
+	fwdUDPWrote       *clientmetric.Metric // sent UDP packet
+	fwdUDPErrorWrite  *clientmetric.Metric
+	fwdUDPErrorServer *clientmetric.Metric
+	fwdUDPErrorTxID   *clientmetric.Metric
+	fwdUDPErrorRead   *clientmetric.Metric
+	fwdUDPSuccess     *clientmetric.Metric
+
+	fwdDoH               *clientmetric.Metric
+	fwdDoHErrorStatus    *clientmetric.Metric
+	fwdDoHErrorCT        *clientmetric.Metric
+	fwdDoHErrorTransport *clientmetric.Metric
+	fwdDoHErrorBody      *clientmetric.Metric
+
+	resolveLocal             *clientmetric.Metric
+	resolveLocalErrorOnion   *clientmetric.Metric
+	resolveLocalErrorMissing *clientmetric.Metric
+	resolveLocalErrorRefused *clientmetric.Metric
+	resolveLocalOKA          *clientmetric.Metric
+	resolveLocalOKAAAA       *clientmetric.Metric
+	resolveLocalOKAll        *clientmetric.Metric
+	resolveLocalNoA          *clientmetric.Metric
+	resolveLocalNoAAAA       *clientmetric.Metric
+	resolveLocalNoAll        *clientmetric.Metric
+	resolveNotImplType       *clientmetric.Metric
+	resolveNoRecordType      *clientmetric.Metric
+
+	reverseMissBonjour *clientmetric.Metric
+	reverseMissOther   *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		queryLocal:               r.Counter("dns_query_local"),
+		queryErrorClosed:         r.Counter("dns_query_local_error_closed"),
+		errorParseNoQ:            r.Counter("dns_query_respond_error_no_question"),
+		errorParseQuery:          r.Counter("dns_query_respond_error_parse"),
+		errorNotFQDN:             r.Counter("dns_query_respond_error_not_fqdn"),
+		magicDNSSuccessName:      r.Counter("dns_query_magic_success_name"),
+		magicDNSSuccessReverse:   r.Counter("dns_query_magic_success_reverse"),
+		exitProxyQuery:           r.Counter("dns_exit_node_query"),
+		exitProxyErrorName:       r.Counter("dns_exit_node_error_name"),
+		exitProxyErrorForward:    r.Counter("dns_exit_node_error_forward"),
+		exitProxyErrorResolvConf: r.Counter("dns_exit_node_error_resolvconf"),
+		fwd:                      r.Counter("dns_query_fwd"),
+		fwdDropBonjour:           r.Counter("dns_query_fwd_drop_bonjour"),
+		fwdErrorName:             r.Counter("dns_query_fwd_error_name"),
+		fwdErrorNoUpstream:       r.Counter("dns_query_fwd_error_no_upstream"),
+		fwdSuccess:               r.Counter("dns_query_fwd_success"),
+		fwdErrorContext:          r.Counter("dns_query_fwd_error_context"),
+		fwdErrorContextGotError:  r.Counter("dns_query_fwd_error_context_got_error"),
+		fwdErrorType:             r.Counter("dns_query_fwd_error_type"),
+		fwdErrorParseAddr:        r.Counter("dns_query_fwd_error_parse_addr"),
+		fwdTruncated:             r.Counter("dns_query_fwd_truncated"),
+		fwdUDP:                   r.Counter("dns_query_fwd_udp"),
+		fwdUDPWrote:              r.Counter("dns_query_fwd_udp_wrote"),
+		fwdUDPErrorWrite:         r.Counter("dns_query_fwd_udp_error_write"),
+		fwdUDPErrorServer:        r.Counter("dns_query_fwd_udp_error_server"),
+		fwdUDPErrorTxID:          r.Counter("dns_query_fwd_udp_error_txid"),
+		fwdUDPErrorRead:          r.Counter("dns_query_fwd_udp_error_read"),
+		fwdUDPSuccess:            r.Counter("dns_query_fwd_udp_success"),
+		fwdDoH:                   r.Counter("dns_query_fwd_doh"),
+		fwdDoHErrorStatus:        r.Counter("dns_query_fwd_doh_error_status"),
+		fwdDoHErrorCT:            r.Counter("dns_query_fwd_doh_error_content_type"),
+		fwdDoHErrorTransport:     r.Counter("dns_query_fwd_doh_error_transport"),
+		fwdDoHErrorBody:          r.Counter("dns_query_fwd_doh_error_body"),
+		resolveLocal:             r.Counter("dns_resolve_local"),
+		resolveLocalErrorOnion:   r.Counter("dns_resolve_local_error_onion"),
+		resolveLocalErrorMissing: r.Counter("dns_resolve_local_error_missing"),
+		resolveLocalErrorRefused: r.Counter("dns_resolve_local_error_refused"),
+		resolveLocalOKA:          r.Counter("dns_resolve_local_ok_a"),
+		resolveLocalOKAAAA:       r.Counter("dns_resolve_local_ok_aaaa"),
+		resolveLocalOKAll:        r.Counter("dns_resolve_local_ok_all"),
+		resolveLocalNoA:          r.Counter("dns_resolve_local_no_a"),
+		resolveLocalNoAAAA:       r.Counter("dns_resolve_local_no_aaaa"),
+		resolveLocalNoAll:        r.Counter("dns_resolve_local_no_all"),
+		resolveNotImplType:       r.Counter("dns_resolve_local_not_impl_type"),
+		resolveNoRecordType:      r.Counter("dns_resolve_local_no_record_type"),
+		reverseMissBonjour:       r.Counter("dns_reverse_miss_bonjour"),
+		reverseMissOther:         r.Counter("dns_reverse_miss_other"),
+	}
+}
@@ -181,10 +181,17 @@ type Client struct {
 	// If nil, portmap discovery is not done.
 	PortMapper *portmapper.Client // lazily initialized on first use
 
+	// ClientMetrics, if non-nil, is where the client records its client
+	// metrics. If nil, the process-wide clientmetric.Global is used.
+	ClientMetrics *clientmetric.Registry
+
 	// For tests
 	testEnoughRegions      int
 	testCaptivePortalDelay time.Duration
 
+	metricsOnce sync.Once
+	metricsv    *metrics // from ClientMetrics; use Client.metrics
+
 	mu       sync.Mutex            // guards following
 	nextFull bool                  // do a full region scan, even if last != nil
 	prev     map[time.Time]*Report // some previous reports
@@ -264,9 +271,9 @@ func (c *Client) ReceiveSTUNPacket(pkt []byte, src netip.AddrPort) {
 	c.vlogf("received STUN packet from %s", src)
 
 	if src.Addr().Is4() {
-		metricSTUNRecv4.Add(1)
+		c.metrics().stunRecv4.Add(1)
 	} else if src.Addr().Is6() {
-		metricSTUNRecv6.Add(1)
+		c.metrics().stunRecv6.Add(1)
 	}
 
 	c.mu.Lock()
@@ -774,10 +781,10 @@ func (c *Client) udpBindAddr() string {
 func (c *Client) GetReport(ctx context.Context, dm *tailcfg.DERPMap) (_ *Report, reterr error) {
 	defer func() {
 		if reterr != nil {
-			metricNumGetReportError.Add(1)
+			c.metrics().numGetReportError.Add(1)
 		}
 	}()
-	metricNumGetReport.Add(1)
+	c.metrics().numGetReport.Add(1)
 	// Mask user context with ours that we guarantee to cancel so
 	// we can depend on it being closed in goroutines later.
 	// (User ctx might be context.Background, etc)
@@ -830,7 +837,7 @@ func (c *Client) GetReport(ctx context.Context, dm *tailcfg.DERPMap) (_ *Report,
 		last = nil // causes makeProbePlan below to do a full (initial) plan
 		c.nextFull = false
 		c.lastFull = now
-		metricNumGetReportFull.Add(1)
+		c.metrics().numGetReportFull.Add(1)
 	}
 
 	rs.incremental = last != nil
@@ -1202,7 +1209,7 @@ func (c *Client) runHTTPOnlyChecks(ctx context.Context, last *Report, rs *report
 }
 
 func (c *Client) measureHTTPSLatency(ctx context.Context, reg *tailcfg.DERPRegion) (time.Duration, netip.Addr, error) {
-	metricHTTPSend.Add(1)
+	c.metrics().httpSend.Add(1)
 	var result httpstat.Result
 	ctx, cancel := context.WithTimeout(httpstat.WithHTTPStat(ctx, &result), overallProbeTimeout)
 	defer cancel()
@@ -1526,7 +1533,7 @@ func (rs *reportState) runProbe(ctx context.Context, dm *tailcfg.DERPMap, probe
 
 	switch probe.proto {
 	case probeIPv4:
-		metricSTUNSend4.Add(1)
+		rs.c.metrics().stunSend4.Add(1)
 		n, err := rs.pc4.WriteToUDPAddrPort(req, addr)
 		if n == len(req) && err == nil || neterror.TreatAsLostUDP(err) {
 			rs.mu.Lock()
@@ -1534,7 +1541,7 @@ func (rs *reportState) runProbe(ctx context.Context, dm *tailcfg.DERPMap, probe
 			rs.mu.Unlock()
 		}
 	case probeIPv6:
-		metricSTUNSend6.Add(1)
+		rs.c.metrics().stunSend6.Add(1)
 		n, err := rs.pc6.WriteToUDPAddrPort(req, addr)
 		if n == len(req) && err == nil || neterror.TreatAsLostUDP(err) {
 			rs.mu.Lock()
@@ -1635,14 +1642,40 @@ func conciseOptBool(b opt.Bool, trueVal string) string {
 	return ""
 }
 
-var (
-	metricNumGetReport      = clientmetric.NewCounter("netcheck_report")
-	metricNumGetReportFull  = clientmetric.NewCounter("netcheck_report_full")
-	metricNumGetReportError = clientmetric.NewCounter("netcheck_report_error")
-
-	metricSTUNSend4 = clientmetric.NewCounter("netcheck_stun_send_ipv4")
-	metricSTUNSend6 = clientmetric.NewCounter("netcheck_stun_send_ipv6")
-	metricSTUNRecv4 = clientmetric.NewCounter("netcheck_stun_recv_ipv4")
-	metricSTUNRecv6 = clientmetric.NewCounter("netcheck_stun_recv_ipv6")
-	metricHTTPSend  = clientmetric.NewCounter("netcheck_https_measure")
-)
+// metrics are a Client's client metrics.
+type metrics struct {
+	numGetReport      *clientmetric.Metric
+	numGetReportFull  *clientmetric.Metric
+	numGetReportError *clientmetric.Metric
+
+	stunSend4 *clientmetric.Metric
+	stunSend6 *clientmetric.Metric
+	stunRecv4 *clientmetric.Metric
+	stunRecv6 *clientmetric.Metric
+	httpSend  *clientmetric.Metric
+}
+
+// metrics returns c's client metrics, creating them on first use.
+func (c *Client) metrics() *metrics {
+	c.metricsOnce.Do(func() {
+		r := c.ClientMetrics
+		if r == nil {
+			r = clientmetric.Global()
+		}
+		c.metricsv = newMetrics(r)
+	})
+	return c.metricsv
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		numGetReport:      r.Counter("netcheck_report"),
+		numGetReportFull:  r.Counter("netcheck_report_full"),
+		numGetReportError: r.Counter("netcheck_report_error"),
+		stunSend4:         r.Counter("netcheck_stun_send_ipv4"),
+		stunSend6:         r.Counter("netcheck_stun_send_ipv6"),
+		stunRecv4:         r.Counter("netcheck_stun_recv_ipv4"),
+		stunRecv6:         r.Counter("netcheck_stun_recv_ipv6"),
+		httpSend:          r.Counter("netcheck_https_measure"),
+	}
+}
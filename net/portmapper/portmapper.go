@@ -62,6 +62,10 @@ type Client struct {
 	testPxPPort  uint16 // if non-zero, pxpPort to use for tests
 	testUPnPPort uint16 // if non-zero, uPnPPort to use for tests
 
+	clientMetrics *clientmetric.Registry // or nil for clientmetric.Global
+	metricsOnce   sync.Once
+	metricsv      *metrics // from clientMetrics; use Client.metrics
+
 	mu sync.Mutex // guards following, and all fields thereof
 
 	// runningCreate is whether we're currently working on creating
@@ -168,6 +172,25 @@ func (c *Client) SetGatewayLookupFunc(f func() (gw, myIP netip.Addr, ok bool)) {
 	c.ipAndGateway = f
 }
 
+// SetClientMetrics sets the registry the client records its client metrics
+// in. It must be called before the client is used. If not called,
+// clientmetric.Global is used.
+func (c *Client) SetClientMetrics(r *clientmetric.Registry) {
+	c.clientMetrics = r
+}
+
+// metrics returns c's client metrics, creating them on first use.
+func (c *Client) metrics() *metrics {
+	c.metricsOnce.Do(func() {
+		r := c.clientMetrics
+		if r == nil {
+			r = clientmetric.Global()
+		}
+		c.metricsv = newMetrics(r)
+	})
+	return c.metricsv
+}
+
 // NoteNetworkDown should be called when the network has transitioned to a down state.
 // It's too late to release port mappings at this point (the user might've just turned off
 // their wifi), but we can make sure we invalidate mappings for later when the network
@@ -711,13 +734,13 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 	if c.sawPMPRecently() {
 		res.PMP = true
 	} else if !DisablePMP {
-		metricPMPSent.Add(1)
+		c.metrics().pmpSent.Add(1)
 		uc.WriteToUDPAddrPort(pmpReqExternalAddrPacket, pxpAddr)
 	}
 	if c.sawPCPRecently() {
 		res.PCP = true
 	} else if !DisablePCP {
-		metricPCPSent.Add(1)
+		c.metrics().pcpSent.Add(1)
 		uc.WriteToUDPAddrPort(pcpAnnounceRequest(myIP), pxpAddr)
 	}
 	if c.sawUPnPRecently() {
@@ -768,7 +791,7 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 		// just ssdp:all, because there appear to be devices which only send
 		// their first descriptor (like urn:schemas-wifialliance-org:device:WFADevice:1)
 		// in response to ssdp:all. https://github.com/tailscale/tailscale/issues/3557
-		metricUPnPSent.Add(1)
+		c.metrics().upnpSent.Add(1)
 		uc.WriteToUDPAddrPort(uPnPPacket, upnpAddr)
 		uc.WriteToUDPAddrPort(uPnPPacket, upnpMulticastAddr)
 		uc.WriteToUDPAddrPort(uPnPIGDPacket, upnpMulticastAddr)
@@ -796,15 +819,15 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 		port := uint16(addr.(*net.UDPAddr).Port)
 		switch port {
 		case c.upnpPort():
-			metricUPnPResponse.Add(1)
+			c.metrics().upnpResponse.Add(1)
 			if ip == gw && mem.Contains(mem.B(buf[:n]), mem.S(":InternetGatewayDevice:")) {
 				meta, err := parseUPnPDiscoResponse(buf[:n])
 				if err != nil {
-					metricUPnPParseErr.Add(1)
+					c.metrics().upnpParseErr.Add(1)
 					c.logf("unrecognized UPnP discovery response; ignoring: %v", err)
 					continue
 				}
-				metricUPnPOK.Add(1)
+				c.metrics().upnpOK.Add(1)
 				c.logf("[v1] UPnP reply %+v, %q", meta, buf[:n])
 				res.UPnP = true
 				c.mu.Lock()
@@ -812,12 +835,12 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 				if c.uPnPMeta != meta {
 					c.logf("UPnP meta changed: %+v", meta)
 					c.uPnPMeta = meta
-					metricUPnPUpdatedMeta.Add(1)
+					c.metrics().upnpUpdatedMeta.Add(1)
 				}
 				c.mu.Unlock()
 			}
 		case c.pxpPort(): // same value for PMP and PCP
-			metricPXPResponse.Add(1)
+			c.metrics().pxpResponse.Add(1)
 			if pres, ok := parsePCPResponse(buf[:n]); ok {
 				if pres.OpCode == pcpOpReply|pcpOpAnnounce {
 					pcpHeard = true
@@ -828,35 +851,35 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 					case pcpCodeOK:
 						c.logf("[v1] Got PCP response: epoch: %v", pres.Epoch)
 						res.PCP = true
-						metricPCPOK.Add(1)
+						c.metrics().pcpOK.Add(1)
 						continue
 					case pcpCodeNotAuthorized:
 						// A PCP service is running, but refuses to
 						// provide port mapping services.
 						res.PCP = false
-						metricPCPNotAuthorized.Add(1)
+						c.metrics().pcpNotAuthorized.Add(1)
 						continue
 					case pcpCodeAddressMismatch:
 						// A PCP service is running, but it is behind a NAT, so it can't help us.
 						res.PCP = false
-						metricPCPAddressMismatch.Add(1)
+						c.metrics().pcpAddressMismatch.Add(1)
 						continue
 					default:
 						// Fall through to unexpected log line.
 					}
 				}
-				metricPCPUnhandledResponseCode.Add(1)
+				c.metrics().pcpUnhandledResponseCode.Add(1)
 				c.logf("unexpected PCP probe response: %+v", pres)
 			}
 			if pres, ok := parsePMPResponse(buf[:n]); ok {
 				if pres.OpCode != pmpOpReply|pmpOpMapPublicAddr {
 					c.logf("unexpected PMP probe response opcode: %+v", pres)
-					metricPMPUnhandledOpcode.Add(1)
+					c.metrics().pmpUnhandledOpcode.Add(1)
 					continue
 				}
 				switch pres.ResultCode {
 				case pmpCodeOK:
-					metricPMPOK.Add(1)
+					c.metrics().pmpOK.Add(1)
 					c.logf("[v1] Got PMP response; IP: %v, epoch: %v", pres.PublicAddr, pres.SecondsSinceEpoch)
 					res.PMP = true
 					c.mu.Lock()
@@ -866,19 +889,19 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 					c.mu.Unlock()
 					continue
 				case pmpCodeNotAuthorized:
-					metricPMPNotAuthorized.Add(1)
+					c.metrics().pmpNotAuthorized.Add(1)
 					c.logf("PMP probe failed due result code: %+v", pres)
 					continue
 				case pmpCodeNetworkFailure:
-					metricPMPNetworkFailure.Add(1)
+					c.metrics().pmpNetworkFailure.Add(1)
 					c.logf("PMP probe failed due result code: %+v", pres)
 					continue
 				case pmpCodeOutOfResources:
-					metricPMPOutOfResources.Add(1)
+					c.metrics().pmpOutOfResources.Add(1)
 					c.logf("PMP probe failed due result code: %+v", pres)
 					continue
 				}
-				metricPMPUnhandledResponseCode.Add(1)
+				c.metrics().pmpUnhandledResponseCode.Add(1)
 				c.logf("unexpected PMP probe response: %+v", pres)
 			}
 		}
@@ -907,73 +930,97 @@ func (c *Client) Probe(ctx context.Context) (res ProbeResult, err error) {
 	"MAN: \"ssdp:discover\"\r\n" +
 	"MX: 2\r\n\r\n")
 
-// PCP/PMP metrics
-var (
-	// metricPXPResponse counts the number of times we received a PMP/PCP response.
-	metricPXPResponse = clientmetric.NewCounter("portmap_pxp_response")
+// metrics are a Client's client metrics.
+type metrics struct {
+	// PCP/PMP metrics
+
+	// pxpResponse counts the number of times we received a PMP/PCP response.
+	pxpResponse *clientmetric.Metric
 
-	// metricPCPSent counts the number of times we sent a PCP request.
-	metricPCPSent = clientmetric.NewCounter("portmap_pcp_sent")
+	// pcpSent counts the number of times we sent a PCP request.
+	pcpSent *clientmetric.Metric
 
-	// metricPCPOK counts the number of times
+	// pcpOK counts the number of times
 	// we received a successful PCP response.
-	metricPCPOK = clientmetric.NewCounter("portmap_pcp_ok")
+	pcpOK *clientmetric.Metric
 
-	// metricPCPAddressMismatch counts the number of times
+	// pcpAddressMismatch counts the number of times
 	// we received a PCP address mismatch result code.
-	metricPCPAddressMismatch = clientmetric.NewCounter("portmap_pcp_address_mismatch")
+	pcpAddressMismatch *clientmetric.Metric
 
-	// metricPCPNotAuthorized counts the number of times
+	// pcpNotAuthorized counts the number of times
 	// we received a PCP not authorized result code.
-	metricPCPNotAuthorized = clientmetric.NewCounter("portmap_pcp_not_authorized")
+	pcpNotAuthorized *clientmetric.Metric
 
-	// metricPCPUnhandledResponseCode counts the number of times
+	// pcpUnhandledResponseCode counts the number of times
 	// we received an (as yet) unhandled PCP result code.
-	metricPCPUnhandledResponseCode = clientmetric.NewCounter("portmap_pcp_unhandled_response_code")
+	pcpUnhandledResponseCode *clientmetric.Metric
 
-	// metricPMPSent counts the number of times we sent a PMP request.
-	metricPMPSent = clientmetric.NewCounter("portmap_pmp_sent")
+	// pmpSent counts the number of times we sent a PMP request.
+	pmpSent *clientmetric.Metric
 
-	// metricPMPOK counts the number of times
+	// pmpOK counts the number of times
 	// we received a succesful PMP response.
-	metricPMPOK = clientmetric.NewCounter("portmap_pmp_ok")
+	pmpOK *clientmetric.Metric
 
-	// metricPMPUnhandledOpcode counts the number of times
+	// pmpUnhandledOpcode counts the number of times
 	// we received an unhandled PMP opcode.
-	metricPMPUnhandledOpcode = clientmetric.NewCounter("portmap_pmp_unhandled_opcode")
+	pmpUnhandledOpcode *clientmetric.Metric
 
-	// metricPMPUnhandledResponseCode counts the number of times
+	// pmpUnhandledResponseCode counts the number of times
 	// we received an unhandled PMP result code.
-	metricPMPUnhandledResponseCode = clientmetric.NewCounter("portmap_pmp_unhandled_response_code")
+	pmpUnhandledResponseCode *clientmetric.Metric
 
-	// metricPMPOutOfResources counts the number of times
+	// pmpOutOfResources counts the number of times
 	// we received a PCP out of resources result code.
-	metricPMPOutOfResources = clientmetric.NewCounter("portmap_pmp_out_of_resources")
+	pmpOutOfResources *clientmetric.Metric
 
-	// metricPMPNetworkFailure counts the number of times
+	// pmpNetworkFailure counts the number of times
 	// we received a PCP network failure result code.
-	metricPMPNetworkFailure = clientmetric.NewCounter("portmap_pmp_network_failure")
+	pmpNetworkFailure *clientmetric.Metric
 
-	// metricPMPNotAuthorized counts the number of times
+	// pmpNotAuthorized counts the number of times
 	// we received a PCP not authorized result code.
-	metricPMPNotAuthorized = clientmetric.NewCounter("portmap_pmp_not_authorized")
-)
+	pmpNotAuthorized *clientmetric.Metric
 
-// UPnP metrics
-var (
-	// metricUPnPSent counts the number of times we sent a UPnP request.
-	metricUPnPSent = clientmetric.NewCounter("portmap_upnp_sent")
+	// UPnP metrics
 
-	// metricUPnPResponse counts the number of times we received a UPnP response.
-	metricUPnPResponse = clientmetric.NewCounter("portmap_upnp_response")
+	// upnpSent counts the number of times we sent a UPnP request.
+	upnpSent *clientmetric.Metric
 
-	// metricUPnPParseErr counts the number of times we failed to parse a UPnP response.
-	metricUPnPParseErr = clientmetric.NewCounter("portmap_upnp_parse_err")
+	// upnpResponse counts the number of times we received a UPnP response.
+	upnpResponse *clientmetric.Metric
 
-	// metricUPnPOK counts the number of times we received a usable UPnP response.
-	metricUPnPOK = clientmetric.NewCounter("portmap_upnp_ok")
+	// upnpParseErr counts the number of times we failed to parse a UPnP response.
+	upnpParseErr *clientmetric.Metric
 
-	// metricUPnPUpdatedMeta counts the number of times
+	// upnpOK counts the number of times we received a usable UPnP response.
+	upnpOK *clientmetric.Metric
+
+	// upnpUpdatedMeta counts the number of times
 	// we received a UPnP response with a new meta.
-	metricUPnPUpdatedMeta = clientmetric.NewCounter("portmap_upnp_updated_meta")
-)
+	upnpUpdatedMeta *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		pxpResponse:              r.Counter("portmap_pxp_response"),
+		pcpSent:                  r.Counter("portmap_pcp_sent"),
+		pcpOK:                    r.Counter("portmap_pcp_ok"),
+		pcpAddressMismatch:       r.Counter("portmap_pcp_address_mismatch"),
+		pcpNotAuthorized:         r.Counter("portmap_pcp_not_authorized"),
+		pcpUnhandledResponseCode: r.Counter("portmap_pcp_unhandled_response_code"),
+		pmpSent:                  r.Counter("portmap_pmp_sent"),
+		pmpOK:                    r.Counter("portmap_pmp_ok"),
+		pmpUnhandledOpcode:       r.Counter("portmap_pmp_unhandled_opcode"),
+		pmpUnhandledResponseCode: r.Counter("portmap_pmp_unhandled_response_code"),
+		pmpOutOfResources:        r.Counter("portmap_pmp_out_of_resources"),
+		pmpNetworkFailure:        r.Counter("portmap_pmp_network_failure"),
+		pmpNotAuthorized:         r.Counter("portmap_pmp_not_authorized"),
+		upnpSent:                 r.Counter("portmap_upnp_sent"),
+		upnpResponse:             r.Counter("portmap_upnp_response"),
+		upnpParseErr:             r.Counter("portmap_upnp_parse_err"),
+		upnpOK:                   r.Counter("portmap_upnp_ok"),
+		upnpUpdatedMeta:          r.Counter("portmap_upnp_updated_meta"),
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package proxyproto generates HAProxy PROXY protocol headers, which tell
+// a backend the original source and destination of a proxied connection.
+//
+// See https://www.haproxy.org/download/2.7/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+)
+
+// v2Signature is the fixed prefix of a PROXY protocol version 2 header.
+const v2Signature = "\r\n\r\n\x00\r\nQUIT\n"
+
+// AppendHeader appends to b a PROXY protocol header of the given version
+// (1 or 2) for a TCP connection from src to dst.
+func AppendHeader(b []byte, version int, src, dst netip.AddrPort) ([]byte, error) {
+	switch version {
+	case 1:
+		return AppendV1(b, src, dst), nil
+	case 2:
+		return AppendV2(b, src, dst), nil
+	}
+	return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+}
+
+// AppendV1 appends to b a human-readable PROXY protocol version 1 header
+// for a TCP connection from src to dst.
+//
+// If src and dst are not valid addresses of the same family, the header
+// declares the connection's source as unknown.
+func AppendV1(b []byte, src, dst netip.AddrPort) []byte {
+	src, dst, ok := unmapPair(src, dst)
+	if !ok {
+		return append(b, "PROXY UNKNOWN\r\n"...)
+	}
+	b = append(b, "PROXY "...)
+	if src.Addr().Is4() {
+		b = append(b, "TCP4 "...)
+	} else {
+		b = append(b, "TCP6 "...)
+	}
+	b = src.Addr().AppendTo(b)
+	b = append(b, ' ')
+	b = dst.Addr().AppendTo(b)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, uint64(src.Port()), 10)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, uint64(dst.Port()), 10)
+	return append(b, "\r\n"...)
+}
+
+// AppendV2 appends to b a binary PROXY protocol version 2 header for a TCP
+// connection from src to dst.
+//
+// If src and dst are not valid addresses of the same family, the header
+// has an unspecified address family and the backend should use the
+// connection's own addresses.
+func AppendV2(b []byte, src, dst netip.AddrPort) []byte {
+	b = append(b, v2Signature...)
+	b = append(b, 0x21) // version 2, PROXY command
+	src, dst, ok := unmapPair(src, dst)
+	switch {
+	case !ok:
+		return append(b, 0x00, 0, 0) // AF_UNSPEC, no addresses
+	case src.Addr().Is4():
+		b = append(b, 0x11) // TCP over IPv4
+		b = binary.BigEndian.AppendUint16(b, 12)
+	default:
+		b = append(b, 0x21) // TCP over IPv6
+		b = binary.BigEndian.AppendUint16(b, 36)
+	}
+	b = append(b, src.Addr().AsSlice()...)
+	b = append(b, dst.Addr().AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	b = binary.BigEndian.AppendUint16(b, dst.Port())
+	return b
+}
+
+// unmapPair returns src and dst with any IPv4-mapped IPv6 addresses
+// unmapped, and whether they're valid and of the same address family.
+func unmapPair(src, dst netip.AddrPort) (_, _ netip.AddrPort, ok bool) {
+	src = netip.AddrPortFrom(src.Addr().Unmap(), src.Port())
+	dst = netip.AddrPortFrom(dst.Addr().Unmap(), dst.Port())
+	if !src.IsValid() || !dst.IsValid() || src.Addr().Is4() != dst.Addr().Is4() {
+		return src, dst, false
+	}
+	return src, dst, true
+}
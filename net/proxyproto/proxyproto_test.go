@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxyproto
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestAppendV1(t *testing.T) {
+	tests := []struct {
+		src, dst string
+		want     string
+	}{
+		{"100.64.1.2:51234", "100.64.0.1:5432", "PROXY TCP4 100.64.1.2 100.64.0.1 51234 5432\r\n"},
+		{"[fd7a:115c:a1e0::2]:51234", "[fd7a:115c:a1e0::1]:443", "PROXY TCP6 fd7a:115c:a1e0::2 fd7a:115c:a1e0::1 51234 443\r\n"},
+		{"[::ffff:100.64.1.2]:1", "100.64.0.1:2", "PROXY TCP4 100.64.1.2 100.64.0.1 1 2\r\n"},
+		{"100.64.1.2:1", "[fd7a:115c:a1e0::1]:2", "PROXY UNKNOWN\r\n"},
+		{"", "100.64.0.1:2", "PROXY UNKNOWN\r\n"},
+	}
+	for _, tt := range tests {
+		got := string(AppendV1(nil, parseAddrPort(tt.src), parseAddrPort(tt.dst)))
+		if got != tt.want {
+			t.Errorf("AppendV1(%q, %q) = %q; want %q", tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestAppendV2(t *testing.T) {
+	sig := []byte(v2Signature)
+	cat := func(bs ...[]byte) []byte { return bytes.Join(bs, nil) }
+	tests := []struct {
+		src, dst string
+		want     []byte
+	}{
+		{
+			"100.64.1.2:51234", "100.64.0.1:5432",
+			cat(sig,
+				[]byte{0x21, 0x11, 0, 12},
+				[]byte{100, 64, 1, 2},
+				[]byte{100, 64, 0, 1},
+				[]byte{0xc8, 0x22, 0x15, 0x38}),
+		},
+		{
+			"[fd7a:115c:a1e0::2]:1", "[fd7a:115c:a1e0::1]:2",
+			cat(sig,
+				[]byte{0x21, 0x21, 0, 36},
+				netip.MustParseAddr("fd7a:115c:a1e0::2").AsSlice(),
+				netip.MustParseAddr("fd7a:115c:a1e0::1").AsSlice(),
+				[]byte{0, 1, 0, 2}),
+		},
+		{
+			"100.64.1.2:1", "[fd7a:115c:a1e0::1]:2",
+			cat(sig, []byte{0x21, 0x00, 0, 0}),
+		},
+	}
+	for _, tt := range tests {
+		got := AppendV2(nil, parseAddrPort(tt.src), parseAddrPort(tt.dst))
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("AppendV2(%q, %q) = %x; want %x", tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestAppendHeaderBadVersion(t *testing.T) {
+	ap := netip.MustParseAddrPort("100.64.0.1:1")
+	if _, err := AppendHeader(nil, 3, ap, ap); err == nil {
+		t.Error("AppendHeader with version 3 succeeded")
+	}
+}
+
+func parseAddrPort(s string) netip.AddrPort {
+	if s == "" {
+		return netip.AddrPort{}
+	}
+	return netip.MustParseAddrPort(s)
+}
@@ -42,6 +42,10 @@ type Dialer struct {
 	// If nil, it's not used.
 	NetstackDialTCP func(context.Context, netip.AddrPort) (net.Conn, error)
 
+	// NetstackDialUDP dials the provided IPPort using netstack.
+	// If nil, UDP dials to IPs selected by UseNetstackForIP fail.
+	NetstackDialUDP func(context.Context, netip.AddrPort) (net.Conn, error)
+
 	peerClientOnce sync.Once
 	peerClient     *http.Client
 
@@ -307,6 +311,12 @@ func (d *Dialer) UserDial(ctx context.Context, network, addr string) (net.Conn,
 		return nil, err
 	}
 	if d.UseNetstackForIP != nil && d.UseNetstackForIP(ipp.Addr()) {
+		if strings.HasPrefix(network, "udp") {
+			if d.NetstackDialUDP == nil {
+				return nil, errors.New("Dialer not initialized correctly for UDP")
+			}
+			return d.NetstackDialUDP(ctx, ipp)
+		}
 		if d.NetstackDialTCP == nil {
 			return nil, errors.New("Dialer not initialized correctly")
 		}
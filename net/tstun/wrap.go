@@ -77,6 +77,10 @@ type Wrapper struct {
 	tdev  tun.Device
 	isTAP bool // whether tdev is a TAP device
 
+	clientMetrics *clientmetric.Registry // or nil for clientmetric.Global
+	metricsOnce   sync.Once
+	metricsv      *metrics // from clientMetrics; use Wrapper.metrics
+
 	closeOnce sync.Once
 
 	// lastActivityAtomic is read/written atomically.
@@ -488,7 +492,7 @@ func (t *Wrapper) filterOut(p *packet.Parsed) filter.Response {
 	if p.IPProto == ipproto.UDP && // disco is over UDP; avoid isSelfDisco call for TCP/etc
 		t.isSelfDisco(p) {
 		t.limitedLogf("[unexpected] received self disco out packet over tstun; dropping")
-		metricPacketOutDropSelfDisco.Add(1)
+		t.metrics().packetOutDropSelfDisco.Add(1)
 		return filter.DropSilently
 	}
 
@@ -512,7 +516,7 @@ func (t *Wrapper) filterOut(p *packet.Parsed) filter.Response {
 	}
 
 	if filt.RunOut(p, t.filterFlags) != filter.Accept {
-		metricPacketOutDropFilter.Add(1)
+		t.metrics().packetOutDropFilter.Add(1)
 		return filter.Drop
 	}
 
@@ -557,7 +561,7 @@ func (t *Wrapper) Read(buffs [][]byte, sizes []int, offset int) (int, error) {
 		return 1, err
 	}
 
-	metricPacketOut.Add(int64(len(res.data)))
+	t.metrics().packetOut.Add(int64(len(res.data)))
 
 	var buffsPos int
 	p := parsedPacketPool.Get().(*packet.Parsed)
@@ -572,7 +576,7 @@ func (t *Wrapper) Read(buffs [][]byte, sizes []int, offset int) (int, error) {
 		if !t.disableFilter {
 			response := t.filterOut(p)
 			if response != filter.Accept {
-				metricPacketOutDrop.Add(1)
+				t.metrics().packetOutDrop.Add(1)
 				continue
 			}
 		}
@@ -601,7 +605,7 @@ func (t *Wrapper) Read(buffs [][]byte, sizes []int, offset int) (int, error) {
 
 // injectedRead handles injected reads, which bypass filters.
 func (t *Wrapper) injectedRead(res tunInjectedRead, buf []byte, offset int) (int, error) {
-	metricPacketOut.Add(1)
+	t.metrics().packetOut.Add(1)
 
 	var n int
 	if !res.packet.IsNil() {
@@ -659,7 +663,7 @@ func (t *Wrapper) filterIn(p *packet.Parsed) filter.Response {
 	if p.IPProto == ipproto.UDP && // disco is over UDP; avoid isSelfDisco call for TCP/etc
 		t.isSelfDisco(p) {
 		t.limitedLogf("[unexpected] received self disco in packet over tstun; dropping")
-		metricPacketInDropSelfDisco.Add(1)
+		t.metrics().packetInDropSelfDisco.Add(1)
 		return filter.DropSilently
 	}
 
@@ -688,7 +692,7 @@ func (t *Wrapper) filterIn(p *packet.Parsed) filter.Response {
 	}
 
 	if outcome != filter.Accept {
-		metricPacketInDropFilter.Add(1)
+		t.metrics().packetInDropFilter.Add(1)
 
 		// Tell them, via TSMP, we're dropping them due to the ACL.
 		// Their host networking stack can translate this into ICMP
@@ -727,7 +731,7 @@ func (t *Wrapper) filterIn(p *packet.Parsed) filter.Response {
 // Write accepts incoming packets. The packets begins at buffs[:][offset:],
 // like wireguard-go/tun.Device.Write.
 func (t *Wrapper) Write(buffs [][]byte, offset int) (int, error) {
-	metricPacketIn.Add(int64(len(buffs)))
+	t.metrics().packetIn.Add(int64(len(buffs)))
 	i := 0
 	if !t.disableFilter {
 		p := parsedPacketPool.Get().(*packet.Parsed)
@@ -735,7 +739,7 @@ func (t *Wrapper) Write(buffs [][]byte, offset int) (int, error) {
 		for _, buff := range buffs {
 			p.Decode(buff[offset:])
 			if t.filterIn(p) != filter.Accept {
-				metricPacketInDrop.Add(1)
+				t.metrics().packetInDrop.Add(1)
 			} else {
 				buffs[i] = buff
 				i++
@@ -906,14 +910,47 @@ func (t *Wrapper) SetStatistics(stats *connstats.Statistics) {
 	t.stats.Store(stats)
 }
 
-var (
-	metricPacketIn              = clientmetric.NewCounter("tstun_in_from_wg")
-	metricPacketInDrop          = clientmetric.NewCounter("tstun_in_from_wg_drop")
-	metricPacketInDropFilter    = clientmetric.NewCounter("tstun_in_from_wg_drop_filter")
-	metricPacketInDropSelfDisco = clientmetric.NewCounter("tstun_in_from_wg_drop_self_disco")
-
-	metricPacketOut              = clientmetric.NewCounter("tstun_out_to_wg")
-	metricPacketOutDrop          = clientmetric.NewCounter("tstun_out_to_wg_drop")
-	metricPacketOutDropFilter    = clientmetric.NewCounter("tstun_out_to_wg_drop_filter")
-	metricPacketOutDropSelfDisco = clientmetric.NewCounter("tstun_out_to_wg_drop_self_disco")
-)
+// SetClientMetrics sets the registry t records its client metrics in.
+// It must be called before t is used. If not called, clientmetric.Global
+// is used.
+func (t *Wrapper) SetClientMetrics(r *clientmetric.Registry) {
+	t.clientMetrics = r
+}
+
+// metrics returns t's client metrics, creating them on first use.
+func (t *Wrapper) metrics() *metrics {
+	t.metricsOnce.Do(func() {
+		r := t.clientMetrics
+		if r == nil {
+			r = clientmetric.Global()
+		}
+		t.metricsv = newMetrics(r)
+	})
+	return t.metricsv
+}
+
+// metrics are a Wrapper's client metrics.
+type metrics struct {
+	packetIn              *clientmetric.Metric
+	packetInDrop          *clientmetric.Metric
+	packetInDropFilter    *clientmetric.Metric
+	packetInDropSelfDisco *clientmetric.Metric
+
+	packetOut              *clientmetric.Metric
+	packetOutDrop          *clientmetric.Metric
+	packetOutDropFilter    *clientmetric.Metric
+	packetOutDropSelfDisco *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		packetIn:               r.Counter("tstun_in_from_wg"),
+		packetInDrop:           r.Counter("tstun_in_from_wg_drop"),
+		packetInDropFilter:     r.Counter("tstun_in_from_wg_drop_filter"),
+		packetInDropSelfDisco:  r.Counter("tstun_in_from_wg_drop_self_disco"),
+		packetOut:              r.Counter("tstun_out_to_wg"),
+		packetOutDrop:          r.Counter("tstun_out_to_wg_drop"),
+		packetOutDropFilter:    r.Counter("tstun_out_to_wg_drop_filter"),
+		packetOutDropSelfDisco: r.Counter("tstun_out_to_wg_drop_self_disco"),
+	}
+}
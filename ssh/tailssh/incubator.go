@@ -33,6 +33,8 @@
 	"github.com/u-root/u-root/pkg/termios"
 	"go4.org/mem"
 	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	"golang.org/x/sys/unix"
 	"tailscale.com/cmd/tailscaled/childproc"
 	"tailscale.com/envknob"
@@ -60,6 +62,23 @@ func init() {
 	return nil, nil
 }
 
+// applyResourceLimits limits the resources that the incubator and the
+// processes it starts may use, if ia has limits. It fails if the limits
+// can't be enforced.
+// See applyResourceLimitsLinux.
+var applyResourceLimits = func(ia incubatorArgs) error {
+	if ia.hasResourceLimits() {
+		return fmt.Errorf("session resource limits are not supported on %v", runtime.GOOS)
+	}
+	return nil
+}
+
+// removeResourceLimits cleans up after applyResourceLimits once the
+// session with the given ID is done.
+var removeResourceLimits = func(sessionID string) error {
+	return nil
+}
+
 // newIncubatorCommand returns a new exec.Cmd configured with
 // `tailscaled be-child ssh` as the entrypoint.
 //
@@ -84,7 +103,9 @@ func (ss *sshSession) newIncubatorCommand() (cmd *exec.Cmd) {
 		isSFTP = true
 	case "":
 		name = loginShell(ss.conn.localUser.Uid)
-		if rawCmd := ss.RawCommand(); rawCmd != "" {
+		if fc := ss.conn.forceCommand(); fc != "" {
+			args = append(args, "-c", fc)
+		} else if rawCmd := ss.RawCommand(); rawCmd != "" {
 			args = append(args, "-c", rawCmd)
 		} else {
 			isShell = true
@@ -118,10 +139,23 @@ func (ss *sshSession) newIncubatorCommand() (cmd *exec.Cmd) {
 		"--has-tty=false", // updated in-place by startWithPTY
 		"--tty-name=",     // updated in-place by startWithPTY
 	}
+	if a := ss.conn.finalAction; ss.hasResourceLimits() {
+		incubatorArgs = append(incubatorArgs,
+			"--session-id="+ss.sharedID,
+			fmt.Sprintf("--memory-limit=%d", a.MemoryLimit),
+			fmt.Sprintf("--cpu-limit-percent=%d", a.CPULimitPercent),
+		)
+	}
 
 	if isSFTP {
 		incubatorArgs = append(incubatorArgs, "--sftp")
 	} else {
+		if ss.x11 != nil {
+			incubatorArgs = append(incubatorArgs,
+				"--x11-display="+ss.x11.xauth,
+				"--x11-auth-proto="+ss.x11.proto,
+			)
+		}
 		if isShell {
 			incubatorArgs = append(incubatorArgs, "--shell")
 			// Currently (2022-05-09) `login` is only used for shells
@@ -156,19 +190,30 @@ func (stdRWC) Close() error {
 }
 
 type incubatorArgs struct {
-	uid          uint64
-	gid          int
-	groups       string
-	localUser    string
-	remoteUser   string
-	remoteIP     string
-	ttyName      string
-	hasTTY       bool
-	cmdName      string
-	isSFTP       bool
-	isShell      bool
-	loginCmdPath string
-	cmdArgs      []string
+	uid             uint64
+	gid             int
+	groups          string
+	localUser       string
+	remoteUser      string
+	remoteIP        string
+	ttyName         string
+	hasTTY          bool
+	cmdName         string
+	isSFTP          bool
+	isShell         bool
+	loginCmdPath    string
+	x11Display      string
+	x11AuthProto    string
+	sessionID       string
+	memoryLimit     int64
+	cpuLimitPercent int
+	cmdArgs         []string
+}
+
+// hasResourceLimits reports whether the session's processes have
+// resource limits.
+func (ia incubatorArgs) hasResourceLimits() bool {
+	return ia.memoryLimit != 0 || ia.cpuLimitPercent != 0
 }
 
 func parseIncubatorArgs(args []string) (a incubatorArgs) {
@@ -185,6 +230,11 @@ func parseIncubatorArgs(args []string) (a incubatorArgs) {
 	flags.BoolVar(&a.isShell, "shell", false, "is launching a shell (with no cmds)")
 	flags.BoolVar(&a.isSFTP, "sftp", false, "run sftp server (cmd is ignored)")
 	flags.StringVar(&a.loginCmdPath, "login-cmd", "", "the path to `login` cmd")
+	flags.StringVar(&a.x11Display, "x11-display", "", "the X11 display to add the $"+x11CookieEnv+" cookie to the user's Xauthority for")
+	flags.StringVar(&a.x11AuthProto, "x11-auth-proto", "", "the X11 authorization protocol of the $"+x11CookieEnv+" cookie")
+	flags.StringVar(&a.sessionID, "session-id", "", "the SSH session ID, to name its resource limits after")
+	flags.Int64Var(&a.memoryLimit, "memory-limit", 0, "the maximum bytes of memory the session may use; 0 for no limit")
+	flags.IntVar(&a.cpuLimitPercent, "cpu-limit-percent", 0, "the maximum percentage of one CPU the session may use; 0 for no limit")
 	flags.Parse(args)
 	a.cmdArgs = flags.Args()
 	return a
@@ -215,10 +265,16 @@ func beIncubator(args []string) error {
 
 	euid := uint64(os.Geteuid())
 	runningAsRoot := euid == 0
-	if runningAsRoot && ia.isShell && ia.loginCmdPath != "" && ia.hasTTY {
+	if err := ia.setupX11Auth(); err != nil {
+		// Not fatal; only X11 clients are affected.
+		logf("xauth: %v", err)
+	}
+	if runningAsRoot && ia.isShell && ia.loginCmdPath != "" && ia.hasTTY && !ia.hasResourceLimits() {
 		// If we are trying to launch a login shell, just exec into login
 		// instead. We can only do this if a TTY was requested, otherwise login
 		// exits immediately, which breaks things likes mosh and VSCode.
+		// Not with resource limits, though: login's PAM session
+		// (pam_systemd) would move the shell out of the limits' cgroup.
 		return unix.Exec(ia.loginCmdPath, ia.loginArgs(), os.Environ())
 	}
 
@@ -230,6 +286,12 @@ func beIncubator(args []string) error {
 	if err == nil && sessionCloser != nil {
 		defer sessionCloser()
 	}
+	// Apply resource limits only once the login session exists, as
+	// creating it moves the incubator into the session's own cgroup.
+	if err := applyResourceLimits(ia); err != nil {
+		fmt.Fprintf(os.Stderr, "[tailscale-ssh: can't apply session resource limits: %v]\n", err)
+		return err
+	}
 	var groupIDs []int
 	for _, g := range strings.Split(ia.groups, ",") {
 		gid, err := strconv.ParseInt(g, 10, 32)
@@ -299,6 +361,36 @@ func beIncubator(args []string) error {
 	return err
 }
 
+// setupX11Auth adds the X11 authorization cookie passed in the
+// environment to the local user's Xauthority file, if X11 forwarding was
+// requested. It removes the cookie from the environment either way.
+func (ia incubatorArgs) setupX11Auth() error {
+	cookie := os.Getenv(x11CookieEnv)
+	os.Unsetenv(x11CookieEnv)
+	if ia.x11Display == "" || cookie == "" {
+		return nil
+	}
+	xauth, err := exec.LookPath("xauth")
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(xauth, "-q", "-")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("remove %s\nadd %s %s %s\n",
+		ia.x11Display, ia.x11Display, ia.x11AuthProto, cookie))
+	cmd.Env = os.Environ()
+	if uint64(os.Geteuid()) != ia.uid {
+		// Run as the user, so the Xauthority file is owned by and
+		// written with the permissions of the user.
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: uint32(ia.uid), Gid: uint32(ia.gid)},
+		}
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
 // launchProcess launches an incubator process for the provided session.
 // It is responsible for configuring the process execution environment.
 // The caller can wait for the process to exit by calling cmd.Wait().
@@ -319,8 +411,9 @@ func (ss *sshSession) launchProcess() error {
 		return err
 	}
 	cmd.Env = envForUser(ss.conn.localUser)
+	action := ss.conn.finalAction
 	for _, kv := range ss.Environ() {
-		if acceptEnvPair(kv) {
+		if acceptEnvPairFromList(kv, action.AcceptEnv) {
 			cmd.Env = append(cmd.Env, kv)
 		}
 	}
@@ -330,10 +423,27 @@ func (ss *sshSession) launchProcess() error {
 		fmt.Sprintf("SSH_CLIENT=%s %d %d", ci.src.Addr(), ci.src.Port(), ci.dst.Port()),
 		fmt.Sprintf("SSH_CONNECTION=%s %d %s %d", ci.src.Addr(), ci.src.Port(), ci.dst.Addr(), ci.dst.Port()),
 	)
+	if ss.conn.forceCommand() != "" && ss.RawCommand() != "" {
+		cmd.Env = append(cmd.Env, "SSH_ORIGINAL_COMMAND="+ss.RawCommand())
+	}
+	// Set last, so they override the above. exec.Cmd uses the last of
+	// duplicate variables.
+	keys := maps.Keys(action.SetEnv)
+	slices.Sort(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+action.SetEnv[k])
+	}
 
 	if ss.agentListener != nil {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("SSH_AUTH_SOCK=%s", ss.agentListener.Addr()))
 	}
+	if ss.x11 != nil {
+		cmd.Env = append(cmd.Env, "DISPLAY="+ss.x11.display)
+		if ss.conn.srv.tailscaledPath != "" {
+			// For the incubator to add to the user's Xauthority.
+			cmd.Env = append(cmd.Env, x11CookieEnv+"="+ss.x11.fakeCookie())
+		}
+	}
 
 	ptyReq, winCh, isPty := ss.Pty()
 	if !isPty {
@@ -693,3 +803,33 @@ func acceptEnvPair(kv string) bool {
 	}
 	return k == "TERM" || k == "LANG" || strings.HasPrefix(k, "LC_")
 }
+
+// acceptEnvPairFromList is like acceptEnvPair, but accepts the variables
+// named in names instead, if non-empty. A name ending in "*" matches
+// variables with that prefix.
+func acceptEnvPairFromList(kv string, names []string) bool {
+	if len(names) == 0 {
+		return acceptEnvPair(kv)
+	}
+	k, _, ok := strings.Cut(kv, "=")
+	if !ok || k == "" {
+		return false
+	}
+	for _, n := range names {
+		if prefix, ok := strs.CutSuffix(n, "*"); ok {
+			if strings.HasPrefix(k, prefix) {
+				return true
+			}
+		} else if k == n {
+			return true
+		}
+	}
+	return false
+}
+
+// hasResourceLimits reports whether the session's processes have
+// resource limits per the SSH policy.
+func (ss *sshSession) hasResourceLimits() bool {
+	a := ss.conn.finalAction
+	return a.MemoryLimit != 0 || a.CPULimitPercent != 0
+}
@@ -8,8 +8,12 @@
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
@@ -22,6 +26,8 @@
 func init() {
 	ptyName = ptyNameLinux
 	maybeStartLoginSession = maybeStartLoginSessionLinux
+	applyResourceLimits = applyResourceLimitsLinux
+	removeResourceLimits = removeResourceLimitsLinux
 }
 
 func ptyNameLinux(f *os.File) (string, error) {
@@ -174,6 +180,113 @@ func maybeStartLoginSessionLinux(logf logger.Logf, ia incubatorArgs) (func() err
 	return nil, nil
 }
 
+// sessionCgroupRoot is the cgroup v2 cgroup that contains a cgroup for
+// each SSH session with resource limits.
+const sessionCgroupRoot = "/sys/fs/cgroup/tailscale-ssh"
+
+// applyResourceLimitsLinux is the linux implementation of
+// applyResourceLimits. It moves the incubator into a new cgroup for the
+// session, named after its ID, with the limits set.
+func applyResourceLimitsLinux(ia incubatorArgs) error {
+	if !ia.hasResourceLimits() {
+		return nil
+	}
+	if ia.memoryLimit < 0 || ia.cpuLimitPercent < 0 {
+		return errors.New("negative resource limit")
+	}
+	if ia.sessionID == "" || strings.ContainsAny(ia.sessionID, "/.") {
+		return fmt.Errorf("invalid session ID %q", ia.sessionID)
+	}
+	if os.Geteuid() != 0 {
+		return errors.New("resource limits require running as root")
+	}
+	if !fileExists("/sys/fs/cgroup/cgroup.controllers") {
+		return errors.New("resource limits require cgroup v2")
+	}
+	if err := os.MkdirAll(sessionCgroupRoot, 0755); err != nil {
+		return err
+	}
+	// Let the session cgroups use the cpu and memory controllers.
+	if err := writeCgroupFile(sessionCgroupRoot, "cgroup.subtree_control", "+cpu +memory"); err != nil {
+		return err
+	}
+	dir := filepath.Join(sessionCgroupRoot, ia.sessionID)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	if ia.memoryLimit > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(ia.memoryLimit, 10)); err != nil {
+			return err
+		}
+	}
+	if ia.cpuLimitPercent > 0 {
+		// The quota and period are in microseconds.
+		const period = 100000
+		quota := ia.cpuLimitPercent * period / 100
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			return err
+		}
+	}
+	// Move ourselves in; the processes we start inherit the cgroup.
+	return writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(os.Getpid()))
+}
+
+func writeCgroupFile(dir, name, val string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(val), 0); err != nil {
+		return fmt.Errorf("writing %v to cgroup %v: %w", name, dir, err)
+	}
+	return nil
+}
+
+// removeResourceLimitsLinux is the linux implementation of
+// removeResourceLimits. It kills the processes still in the session's
+// cgroup, such as ones the user left running in the background, and then
+// removes the cgroup.
+func removeResourceLimitsLinux(sessionID string) error {
+	dir := filepath.Join(sessionCgroupRoot, sessionID)
+	if !fileExists(dir) {
+		return nil
+	}
+	// Killed processes leave the cgroup asynchronously, and removing it
+	// fails with EBUSY until they all have, so retry for a bit. Without
+	// cgroup.kill, processes can also be forked while being killed one at
+	// a time, so kill again on each attempt.
+	var err error
+	for i := 0; i < 50; i++ {
+		if err := killCgroupProcs(dir); err != nil {
+			return err
+		}
+		err = os.Remove(dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return err
+}
+
+// killCgroupProcs sends SIGKILL to the processes in the cgroup dir.
+func killCgroupProcs(dir string) error {
+	// cgroup.kill kills the whole cgroup at once, but it's only
+	// available since Linux 5.14.
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0); err == nil {
+		return nil
+	}
+	procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	for _, f := range strings.Fields(string(procs)) {
+		if pid, err := strconv.Atoi(f); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	return nil
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
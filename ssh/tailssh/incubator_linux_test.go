@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tailssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// TestIncubatorResourceLimits checks that a command started by the
+// incubator with resource limits runs in the session's limits cgroup,
+// after the incubator has registered a login session (which, on systemd
+// hosts, moves it into the session's own cgroup).
+func TestIncubatorResourceLimits(t *testing.T) {
+	if os.Getenv("TS_TEST_BE_INCUBATOR") == "1" {
+		// We're the incubator, started by the test below.
+		args := os.Args[slices.Index(os.Args, "--")+1:]
+		if err := beIncubator(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	if !fileExists("/sys/fs/cgroup/cgroup.controllers") {
+		t.Skip("requires cgroup v2")
+	}
+
+	sessionID := fmt.Sprintf("test-%d", os.Getpid())
+	defer removeResourceLimitsLinux(sessionID)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestIncubatorResourceLimits$", "--",
+		"--uid=0",
+		"--gid=0",
+		"--groups=0",
+		"--local-user=root",
+		"--remote-user=test",
+		"--remote-ip=100.64.0.1",
+		"--session-id="+sessionID,
+		"--memory-limit=268435456",
+		"--cmd=/bin/cat",
+		"--", "/proc/self/cgroup",
+	)
+	cmd.Env = append(os.Environ(), "TS_TEST_BE_INCUBATOR=1")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("incubator: %v, %s", err, out)
+	}
+	want := "0::" + strings.TrimPrefix(sessionCgroupRoot, "/sys/fs/cgroup") + "/" + sessionID
+	if !slices.Contains(strings.Split(strings.TrimSpace(string(out)), "\n"), want) {
+		t.Errorf("child's /proc/self/cgroup = %q; want line %q", out, want)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || (darwin && !ios) || freebsd
+
+package tailssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tailscale/hujson"
+	"tailscale.com/envknob"
+	"tailscale.com/tailcfg"
+)
+
+// policyFilePollInterval is how often the local SSH policy file is checked
+// for changes, so that sessions it no longer permits are closed.
+const policyFilePollInterval = 5 * time.Second
+
+// Precedence values for localSSHPolicy.
+const (
+	// precedenceControl evaluates the tailnet's rules before the local
+	// rules, which then only apply to connections the tailnet's rules
+	// don't match. It's the default.
+	precedenceControl = "control"
+
+	// precedenceLocal evaluates the local rules before the tailnet's
+	// rules, including its reject and check rules.
+	precedenceLocal = "local"
+
+	// precedenceLocalOnly ignores the tailnet's rules.
+	precedenceLocalOnly = "local-only"
+)
+
+// localSSHPolicy is the format of the local SSH policy file, which is
+// merged with the SSH policy from control. The rules use the same schema
+// as tailcfg.SSHPolicy; as there, the first matching rule wins.
+type localSSHPolicy struct {
+	// Precedence is how the local rules are ordered relative to the
+	// tailnet's: "control" (the default), "local" or "local-only".
+	Precedence string `json:"precedence,omitempty"`
+
+	Rules []*tailcfg.SSHRule `json:"rules"`
+}
+
+// parseLocalSSHPolicy parses the HuJSON local SSH policy in b.
+func parseLocalSSHPolicy(b []byte) (*localSSHPolicy, error) {
+	b, err := hujson.Standardize(b)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields() // catch typos rather than ignoring rules
+	pol := new(localSSHPolicy)
+	if err := dec.Decode(pol); err != nil {
+		return nil, err
+	}
+	switch pol.Precedence {
+	case "", precedenceLocal, precedenceControl, precedenceLocalOnly:
+	default:
+		return nil, fmt.Errorf("unknown precedence %q", pol.Precedence)
+	}
+	for i, r := range pol.Rules {
+		if r == nil || r.Action == nil {
+			return nil, fmt.Errorf("rule %d: missing action", i)
+		}
+	}
+	return pol, nil
+}
+
+// mergeSSHPolicy returns the effective SSH policy given the tailnet's
+// policy from control and the local policy, either of which may be nil.
+func mergeSSHPolicy(control *tailcfg.SSHPolicy, local *localSSHPolicy) *tailcfg.SSHPolicy {
+	if local == nil {
+		return control
+	}
+	var controlRules []*tailcfg.SSHRule
+	if control != nil {
+		controlRules = control.Rules
+	}
+	pol := &tailcfg.SSHPolicy{
+		Rules: make([]*tailcfg.SSHRule, 0, len(local.Rules)+len(controlRules)),
+	}
+	switch local.Precedence {
+	case precedenceLocal:
+		pol.Rules = append(pol.Rules, local.Rules...)
+		pol.Rules = append(pol.Rules, controlRules...)
+	case precedenceLocalOnly:
+		pol.Rules = append(pol.Rules, local.Rules...)
+	default:
+		pol.Rules = append(pol.Rules, controlRules...)
+		pol.Rules = append(pol.Rules, local.Rules...)
+	}
+	return pol
+}
+
+// policyFile caches the parsed contents of the local SSH policy file,
+// re-reading it when it changes.
+type policyFile struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	pol     *localSSHPolicy // nil if there's no file
+	err     error           // non-nil if the file is invalid
+}
+
+// get returns the local SSH policy in the file at path, or nil if there's
+// no such file. It reports whether the result changed since the previous
+// call.
+//
+// An invalid file is an error, rather than ignored, so that it can't
+// cause its reject rules to be skipped.
+func (f *policyFile) get(path string) (_ *localSSHPolicy, changed bool, _ error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		changed = f.pol != nil || f.err != nil
+		f.path, f.modTime, f.size, f.pol, f.err = path, time.Time{}, 0, nil, nil
+		return nil, changed, nil
+	}
+	if err != nil {
+		changed = f.err == nil
+		f.path, f.modTime, f.size, f.pol = path, time.Time{}, 0, nil
+		f.err = fmt.Errorf("local SSH policy file: %w", err)
+		return nil, changed, f.err
+	}
+	if path == f.path && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.pol, false, f.err
+	}
+	b, err := os.ReadFile(path)
+	var pol *localSSHPolicy
+	if err == nil {
+		pol, err = parseLocalSSHPolicy(b)
+	}
+	if err != nil {
+		err = fmt.Errorf("local SSH policy file %v: %w", path, err)
+	}
+	f.path, f.modTime, f.size, f.pol, f.err = path, fi.ModTime(), fi.Size(), pol, err
+	return pol, true, err
+}
+
+// localPolicy returns the local SSH policy, or nil if there's none.
+func (srv *server) localPolicy() (_ *localSSHPolicy, changed bool, _ error) {
+	path := srv.lb.SSHPolicyFilePath()
+	if path == "" {
+		return nil, false, nil
+	}
+	return srv.policyFile.get(path)
+}
+
+// debugPolicy returns the policy in the $TS_DEBUG_SSH_POLICY_FILE
+// development file, or nil if there's none. Its precedence field, if any,
+// is ignored.
+func (srv *server) debugPolicy() (*tailcfg.SSHPolicy, error) {
+	path := envknob.SSHPolicyFile()
+	if path == "" {
+		return nil, nil
+	}
+	pol, _, err := srv.debugPolicyFile.get(path)
+	if pol == nil || err != nil {
+		return nil, err
+	}
+	return &tailcfg.SSHPolicy{Rules: pol.Rules}, nil
+}
+
+// SSHPolicy returns the effective SSH policy: the tailnet's policy merged
+// with the local SSH policy file, if any. If the netmap has no SSH policy
+// (or it's ignored for development), the $TS_DEBUG_SSH_POLICY_FILE file
+// stands in for it. It returns nil if there's no policy.
+func (srv *server) SSHPolicy() (*tailcfg.SSHPolicy, error) {
+	var control *tailcfg.SSHPolicy
+	if nm := srv.lb.NetMap(); nm != nil && !envknob.SSHIgnoreTailnetPolicy() {
+		control = nm.SSHPolicy
+	}
+	if control == nil {
+		var err error
+		if control, err = srv.debugPolicy(); err != nil {
+			return nil, err
+		}
+	}
+	local, _, err := srv.localPolicy()
+	if err != nil {
+		return nil, err
+	}
+	return mergeSSHPolicy(control, local), nil
+}
+
+// watchPolicyFile polls the local SSH policy file for changes until done
+// is closed, re-evaluating active sessions when it changes.
+func (srv *server) watchPolicyFile(done <-chan struct{}) {
+	t := time.NewTicker(policyFilePollInterval)
+	defer t.Stop()
+	srv.localPolicy() // initial load
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		if _, changed, err := srv.localPolicy(); changed {
+			if err != nil {
+				srv.logf("ssh: %v", err)
+			} else {
+				srv.logf("ssh: local SSH policy file changed")
+			}
+			srv.OnPolicyChange()
+		}
+	}
+}
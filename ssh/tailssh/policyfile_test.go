@@ -0,0 +1,195 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+
+package tailssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+func TestParseLocalSSHPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *localSSHPolicy
+		wantErr bool
+	}{
+		{
+			name: "hujson",
+			in: `{
+				// Let admins in when the netmap is stale.
+				"precedence": "control",
+				"rules": [{
+					"principals": [{"nodeIP": "100.64.0.1"}],
+					"sshUsers": {"*": "root"},
+					"action": {"accept": true},
+				}],
+			}`,
+			want: &localSSHPolicy{
+				Precedence: "control",
+				Rules: []*tailcfg.SSHRule{{
+					Principals: []*tailcfg.SSHPrincipal{{NodeIP: "100.64.0.1"}},
+					SSHUsers:   map[string]string{"*": "root"},
+					Action:     &tailcfg.SSHAction{Accept: true},
+				}},
+			},
+		},
+		{
+			name:    "unknown-field",
+			in:      `{"rules": [{"principal": [{"any": true}], "action": {"accept": true}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown-precedence",
+			in:      `{"precedence": "tailnet", "rules": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing-action",
+			in:      `{"rules": [{"principals": [{"any": true}]}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLocalSSHPolicy([]byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeSSHPolicy(t *testing.T) {
+	c1 := &tailcfg.SSHRule{Action: &tailcfg.SSHAction{Accept: true}}
+	l1 := &tailcfg.SSHRule{Action: &tailcfg.SSHAction{Reject: true}}
+	control := &tailcfg.SSHPolicy{Rules: []*tailcfg.SSHRule{c1}}
+	local := func(precedence string) *localSSHPolicy {
+		return &localSSHPolicy{Precedence: precedence, Rules: []*tailcfg.SSHRule{l1}}
+	}
+	tests := []struct {
+		name    string
+		control *tailcfg.SSHPolicy
+		local   *localSSHPolicy
+		want    []*tailcfg.SSHRule
+	}{
+		{"no-local", control, nil, []*tailcfg.SSHRule{c1}},
+		{"no-control", nil, local(""), []*tailcfg.SSHRule{l1}},
+		{"default", control, local(""), []*tailcfg.SSHRule{c1, l1}},
+		{"local", control, local("local"), []*tailcfg.SSHRule{l1, c1}},
+		{"control", control, local("control"), []*tailcfg.SSHRule{c1, l1}},
+		{"local-only", control, local("local-only"), []*tailcfg.SSHRule{l1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeSSHPolicy(tt.control, tt.local)
+			if !reflect.DeepEqual(got.Rules, tt.want) {
+				t.Errorf("got %v; want %v", got.Rules, tt.want)
+			}
+		})
+	}
+	if got := mergeSSHPolicy(nil, nil); got != nil {
+		t.Errorf("mergeSSHPolicy(nil, nil) = %v; want nil", got)
+	}
+}
+
+func TestServerSSHPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh-policy.hujson")
+	controlRule := newSSHRule(&tailcfg.SSHAction{Accept: true})
+	srv := &server{
+		lb:   &localState{sshEnabled: true, matchingRule: controlRule, policyFile: path},
+		logf: t.Logf,
+	}
+	write := func(s string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// Don't depend on the filesystem's timestamp granularity.
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRules := func(want int) {
+		t.Helper()
+		pol, err := srv.SSHPolicy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pol.Rules) != want {
+			t.Fatalf("got %d rules; want %d", len(pol.Rules), want)
+		}
+	}
+	checkChanged := func(want bool) {
+		t.Helper()
+		if _, changed, _ := srv.localPolicy(); changed != want {
+			t.Fatalf("changed = %v; want %v", changed, want)
+		}
+	}
+
+	checkRules(1) // no file
+	checkChanged(false)
+
+	t0 := time.Now().Add(-time.Hour)
+	write(`{"rules": [{"principals": [{"any": true}], "action": {"reject": true}}]}`, t0)
+	checkChanged(true)
+	checkChanged(false)
+	checkRules(2)
+
+	write(`{"precedence": "local-only", "rules": []}`, t0.Add(time.Second))
+	checkRules(0)
+
+	// An invalid file fails closed.
+	write(`{"rules": [`, t0.Add(2*time.Second))
+	if _, err := srv.SSHPolicy(); err == nil {
+		t.Fatal("invalid policy file accepted")
+	}
+	checkChanged(false)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	checkChanged(true)
+	checkRules(1)
+}
+
+func TestServerDebugSSHPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "debug-policy.json")
+	if err := os.WriteFile(path, []byte(`{"rules": [{"principals": [{"any": true}], "action": {"reject": true}}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TS_DEBUG_SSH_POLICY_FILE", path)
+
+	// The netmap's policy wins over the development file.
+	controlRule := newSSHRule(&tailcfg.SSHAction{Accept: true})
+	srv := &server{lb: &localState{sshEnabled: true, matchingRule: controlRule}, logf: t.Logf}
+	pol, err := srv.SSHPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pol.Rules) != 1 || pol.Rules[0] != controlRule {
+		t.Errorf("with netmap policy: got %v; want netmap's rule", pol.Rules)
+	}
+
+	// Without one, the development file is used.
+	srv = &server{lb: &localState{sshEnabled: true}, logf: t.Logf}
+	pol, err = srv.SSHPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pol.Rules) != 1 || !pol.Rules[0].Action.Reject {
+		t.Errorf("without netmap policy: got %v; want the file's reject rule", pol.Rules)
+	}
+}
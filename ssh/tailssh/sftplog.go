@@ -0,0 +1,311 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tailssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"tailscale.com/util/mak"
+)
+
+// SFTP (version 3) packet types that sftpLogger understands.
+// See https://datatracker.ietf.org/doc/html/draft-ietf-secsh-filexfer-02.
+const (
+	sftpFxpInit     = 1
+	sftpFxpVersion  = 2
+	sftpFxpOpen     = 3
+	sftpFxpClose    = 4
+	sftpFxpRead     = 5
+	sftpFxpWrite    = 6
+	sftpFxpRemove   = 13
+	sftpFxpMkdir    = 14
+	sftpFxpRmdir    = 15
+	sftpFxpRename   = 18
+	sftpFxpStatus   = 101
+	sftpFxpHandle   = 102
+	sftpFxpData     = 103
+	sftpFxpExtended = 200
+
+	sftpFxOK = 0 // SSH_FXP_STATUS code for success
+)
+
+// sftpMaxPacket is the largest SFTP packet sftpLogger accepts. It's well
+// above what clients and servers send (OpenSSH uses 256KB).
+const sftpMaxPacket = 1 << 20
+
+var errMalformedSFTP = errors.New("malformed SFTP packet")
+
+// sftpEvent is a file operation in an SFTP session, as recorded.
+type sftpEvent struct {
+	// Op is the operation: "open", "read", "write", "rename", "remove",
+	// "mkdir" or "rmdir". Reads and writes are recorded when their file
+	// is closed, with the total number of bytes transferred.
+	Op string `json:"op"`
+
+	Path    string `json:"path"`
+	NewPath string `json:"newPath,omitempty"` // for "rename"
+	Flags   string `json:"flags,omitempty"`   // for "open": some of "rwactx"
+	Bytes   int64  `json:"bytes,omitempty"`   // for "read" and "write"
+
+	// Err is the error the SFTP server responded with, if any.
+	Err string `json:"err,omitempty"`
+}
+
+// sftpLogger parses both directions of an SFTP session's protocol stream
+// and reports the file operations performed in it.
+type sftpLogger struct {
+	emit func(sftpEvent) error // called with mu held
+
+	mu         sync.Mutex
+	fromClient []byte                 // partial packet from the client
+	fromServer []byte                 // partial packet from the server
+	pending    map[uint32]sftpRequest // by request ID
+	handles    map[string]*sftpHandle // open files, by server handle
+}
+
+// sftpRequest is a request from the client awaiting a response.
+type sftpRequest struct {
+	op      string // as in sftpEvent.Op, or "close"
+	path    string
+	newPath string
+	flags   uint32 // for "open"
+	handle  string // for "read", "write" and "close"
+	n       int64  // bytes to write, for "write"
+}
+
+// sftpHandle is a file opened by the client.
+type sftpHandle struct {
+	path    string
+	read    int64
+	written int64
+}
+
+// clientWriter returns a writer that parses the client's stream written
+// to it before passing it on to w.
+func (l *sftpLogger) clientWriter(w io.Writer) io.Writer {
+	return sftpTee{w, func(p []byte) error {
+		return l.parse(&l.fromClient, p, l.handleRequest)
+	}}
+}
+
+// serverWriter returns a writer that parses the server's stream written
+// to it before passing it on to w.
+func (l *sftpLogger) serverWriter(w io.Writer) io.Writer {
+	return sftpTee{w, func(p []byte) error {
+		return l.parse(&l.fromServer, p, l.handleResponse)
+	}}
+}
+
+type sftpTee struct {
+	w     io.Writer
+	parse func([]byte) error
+}
+
+func (t sftpTee) Write(p []byte) (int, error) {
+	if err := t.parse(p); err != nil {
+		return 0, err
+	}
+	return t.w.Write(p)
+}
+
+// parse appends p to the partial packet in buf and calls handle with the
+// type and payload of each packet completed.
+func (l *sftpLogger) parse(buf *[]byte, p []byte, handle func(typ byte, d *sftpDecoder) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*buf = append(*buf, p...)
+	for len(*buf) >= 4 {
+		n := binary.BigEndian.Uint32(*buf)
+		if n == 0 || n > sftpMaxPacket {
+			return errMalformedSFTP
+		}
+		if uint32(len(*buf)-4) < n {
+			break
+		}
+		pkt := (*buf)[4 : 4+n]
+		d := &sftpDecoder{b: pkt[1:]}
+		if err := handle(pkt[0], d); err != nil {
+			return err
+		}
+		if d.err {
+			return errMalformedSFTP
+		}
+		*buf = (*buf)[4+n:]
+	}
+	if len(*buf) == 0 {
+		*buf = nil // don't retain large packets
+	}
+	return nil
+}
+
+func (l *sftpLogger) handleRequest(typ byte, d *sftpDecoder) error {
+	if typ == sftpFxpInit {
+		return nil
+	}
+	id := d.uint32()
+	var req sftpRequest
+	switch typ {
+	case sftpFxpOpen:
+		req = sftpRequest{op: "open", path: d.string()}
+		req.flags = d.uint32()
+	case sftpFxpClose:
+		req = sftpRequest{op: "close", handle: d.string()}
+	case sftpFxpRead:
+		req = sftpRequest{op: "read", handle: d.string()}
+	case sftpFxpWrite:
+		req = sftpRequest{op: "write", handle: d.string()}
+		d.uint64() // offset
+		req.n = int64(d.skipString())
+	case sftpFxpRemove:
+		req = sftpRequest{op: "remove", path: d.string()}
+	case sftpFxpMkdir:
+		req = sftpRequest{op: "mkdir", path: d.string()}
+	case sftpFxpRmdir:
+		req = sftpRequest{op: "rmdir", path: d.string()}
+	case sftpFxpRename:
+		req = sftpRequest{op: "rename", path: d.string()}
+		req.newPath = d.string()
+	case sftpFxpExtended:
+		if d.string() != "posix-rename@openssh.com" {
+			return nil
+		}
+		req = sftpRequest{op: "rename", path: d.string()}
+		req.newPath = d.string()
+	default:
+		return nil
+	}
+	if !d.err {
+		mak.Set(&l.pending, id, req)
+	}
+	return nil
+}
+
+func (l *sftpLogger) handleResponse(typ byte, d *sftpDecoder) error {
+	if typ == sftpFxpVersion {
+		return nil
+	}
+	id := d.uint32()
+	req, ok := l.pending[id]
+	if !ok || d.err {
+		return nil
+	}
+	delete(l.pending, id)
+
+	switch typ {
+	case sftpFxpHandle:
+		h := d.string()
+		if req.op != "open" || d.err {
+			return nil
+		}
+		mak.Set(&l.handles, h, &sftpHandle{path: req.path})
+		return l.emit(sftpEvent{Op: "open", Path: req.path, Flags: sftpOpenFlags(req.flags)})
+	case sftpFxpData:
+		n := d.skipString()
+		if h := l.handles[req.handle]; h != nil && req.op == "read" {
+			h.read += int64(n)
+		}
+		return nil
+	case sftpFxpStatus:
+	default:
+		return nil
+	}
+
+	var errStr string
+	if code := d.uint32(); code != sftpFxOK {
+		errStr = d.string()
+		if errStr == "" {
+			errStr = fmt.Sprintf("status %d", code)
+		}
+		d.err = false // the message is optional in older versions
+	}
+	switch req.op {
+	case "open", "remove", "mkdir", "rmdir", "rename":
+		return l.emit(sftpEvent{Op: req.op, Path: req.path, NewPath: req.newPath, Flags: sftpOpenFlags(req.flags), Err: errStr})
+	case "write":
+		if h := l.handles[req.handle]; h != nil && errStr == "" {
+			h.written += req.n
+		}
+	case "close":
+		h := l.handles[req.handle]
+		if h == nil {
+			return nil
+		}
+		delete(l.handles, req.handle)
+		if h.read > 0 {
+			if err := l.emit(sftpEvent{Op: "read", Path: h.path, Bytes: h.read}); err != nil {
+				return err
+			}
+		}
+		if h.written > 0 {
+			return l.emit(sftpEvent{Op: "write", Path: h.path, Bytes: h.written})
+		}
+	}
+	return nil
+}
+
+// sftpOpenFlags returns the SSH_FXF_* open flags f as a string of letters:
+// r(ead), w(rite), a(ppend), c(reate), t(runcate) and (e)x(clusive).
+func sftpOpenFlags(f uint32) string {
+	const letters = "rwactx"
+	var b []byte
+	for i := range letters {
+		if f&(1<<i) != 0 {
+			b = append(b, letters[i])
+		}
+	}
+	return string(b)
+}
+
+// sftpDecoder decodes the fields of an SFTP packet payload. Once a read
+// runs past the end of the payload, err is set and reads return zero
+// values.
+type sftpDecoder struct {
+	b   []byte
+	err bool
+}
+
+func (d *sftpDecoder) uint32() uint32 {
+	if len(d.b) < 4 {
+		d.err = true
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *sftpDecoder) uint64() uint64 {
+	if len(d.b) < 8 {
+		d.err = true
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d.b)
+	d.b = d.b[8:]
+	return v
+}
+
+// skipString skips over a string field, returning its length.
+func (d *sftpDecoder) skipString() int {
+	n := d.uint32()
+	if d.err || uint32(len(d.b)) < n {
+		d.err = true
+		return 0
+	}
+	d.b = d.b[n:]
+	return int(n)
+}
+
+func (d *sftpDecoder) string() string {
+	b := d.b
+	n := d.skipString()
+	if d.err {
+		return ""
+	}
+	return string(b[4 : 4+n])
+}
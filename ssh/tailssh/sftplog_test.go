@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tailssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// sftpPacket returns an SFTP packet of type typ with the given fields,
+// which may be uint32s, uint64s or strings.
+func sftpPacket(typ byte, fields ...any) []byte {
+	payload := []byte{typ}
+	for _, f := range fields {
+		switch f := f.(type) {
+		case uint32:
+			payload = binary.BigEndian.AppendUint32(payload, f)
+		case uint64:
+			payload = binary.BigEndian.AppendUint64(payload, f)
+		case string:
+			payload = binary.BigEndian.AppendUint32(payload, uint32(len(f)))
+			payload = append(payload, f...)
+		default:
+			panic("unknown field type")
+		}
+	}
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(payload))), payload...)
+}
+
+func TestSFTPLogger(t *testing.T) {
+	var got []sftpEvent
+	l := &sftpLogger{emit: func(ev sftpEvent) error {
+		got = append(got, ev)
+		return nil
+	}}
+	var toServer, toClient bytes.Buffer
+	cw := l.clientWriter(&toServer)
+	sw := l.serverWriter(&toClient)
+
+	const noAttrs = uint32(0)
+	steps := []struct {
+		fromClient bool
+		pkt        []byte
+	}{
+		{true, sftpPacket(sftpFxpInit, uint32(3))},
+		{false, sftpPacket(sftpFxpVersion, uint32(3))},
+
+		// Upload a file, in two writes.
+		{true, sftpPacket(sftpFxpOpen, uint32(1), "/tmp/up", uint32(0x1a), noAttrs)},
+		{false, sftpPacket(sftpFxpHandle, uint32(1), "h1")},
+		{true, sftpPacket(sftpFxpWrite, uint32(2), "h1", uint64(0), "hello ")},
+		{true, sftpPacket(sftpFxpWrite, uint32(3), "h1", uint64(6), "world")},
+		{false, sftpPacket(sftpFxpStatus, uint32(3), uint32(sftpFxOK), "", "")},
+		{false, sftpPacket(sftpFxpStatus, uint32(2), uint32(sftpFxOK), "", "")},
+		{true, sftpPacket(sftpFxpClose, uint32(4), "h1")},
+		{false, sftpPacket(sftpFxpStatus, uint32(4), uint32(sftpFxOK), "", "")},
+
+		// Download a file.
+		{true, sftpPacket(sftpFxpOpen, uint32(5), "/tmp/down", uint32(0x1), noAttrs)},
+		{false, sftpPacket(sftpFxpHandle, uint32(5), "h2")},
+		{true, sftpPacket(sftpFxpRead, uint32(6), "h2", uint64(0), uint32(32768))},
+		{false, sftpPacket(sftpFxpData, uint32(6), "abc")},
+		{true, sftpPacket(sftpFxpRead, uint32(7), "h2", uint64(3), uint32(32768))},
+		{false, sftpPacket(sftpFxpStatus, uint32(7), uint32(1), "EOF", "")},
+		{true, sftpPacket(sftpFxpClose, uint32(8), "h2")},
+		{false, sftpPacket(sftpFxpStatus, uint32(8), uint32(sftpFxOK), "", "")},
+
+		// Other operations.
+		{true, sftpPacket(sftpFxpRename, uint32(9), "/tmp/up", "/tmp/up2")},
+		{false, sftpPacket(sftpFxpStatus, uint32(9), uint32(sftpFxOK), "", "")},
+		{true, sftpPacket(sftpFxpExtended, uint32(10), "posix-rename@openssh.com", "/tmp/up2", "/tmp/up3")},
+		{false, sftpPacket(sftpFxpStatus, uint32(10), uint32(sftpFxOK), "", "")},
+		{true, sftpPacket(sftpFxpRemove, uint32(11), "/etc/passwd")},
+		{false, sftpPacket(sftpFxpStatus, uint32(11), uint32(3), "permission denied", "")},
+		{true, sftpPacket(sftpFxpMkdir, uint32(12), "/tmp/d", noAttrs)},
+		{false, sftpPacket(sftpFxpStatus, uint32(12), uint32(sftpFxOK), "", "")},
+		{true, sftpPacket(sftpFxpRmdir, uint32(13), "/tmp/d")},
+		{false, sftpPacket(sftpFxpStatus, uint32(13), uint32(sftpFxOK))}, // no message
+	}
+	var wantToServer, wantToClient []byte
+	for i, st := range steps {
+		w := sw
+		if st.fromClient {
+			w = cw
+			wantToServer = append(wantToServer, st.pkt...)
+		} else {
+			wantToClient = append(wantToClient, st.pkt...)
+		}
+		// Write a byte at a time, to exercise reassembly.
+		for _, b := range st.pkt {
+			if _, err := w.Write([]byte{b}); err != nil {
+				t.Fatalf("step %d: %v", i, err)
+			}
+		}
+	}
+
+	want := []sftpEvent{
+		{Op: "open", Path: "/tmp/up", Flags: "wct"},
+		{Op: "write", Path: "/tmp/up", Bytes: 11},
+		{Op: "open", Path: "/tmp/down", Flags: "r"},
+		{Op: "read", Path: "/tmp/down", Bytes: 3},
+		{Op: "rename", Path: "/tmp/up", NewPath: "/tmp/up2"},
+		{Op: "rename", Path: "/tmp/up2", NewPath: "/tmp/up3"},
+		{Op: "remove", Path: "/etc/passwd", Err: "permission denied"},
+		{Op: "mkdir", Path: "/tmp/d"},
+		{Op: "rmdir", Path: "/tmp/d"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n got: %+v\nwant: %+v", got, want)
+	}
+	if !bytes.Equal(toServer.Bytes(), wantToServer) || !bytes.Equal(toClient.Bytes(), wantToClient) {
+		t.Error("streams not passed through unchanged")
+	}
+	if len(l.pending) != 0 || len(l.handles) != 0 {
+		t.Errorf("leaked state: %d pending, %d handles", len(l.pending), len(l.handles))
+	}
+}
+
+func TestSFTPLoggerMalformed(t *testing.T) {
+	l := &sftpLogger{emit: func(sftpEvent) error { return nil }}
+	w := l.clientWriter(io.Discard)
+	if _, err := w.Write([]byte{0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Error("oversized packet accepted")
+	}
+
+	l = &sftpLogger{emit: func(sftpEvent) error { return nil }}
+	w = l.clientWriter(io.Discard)
+	// An open request whose path runs past the end of the packet.
+	bad := []byte{0, 0, 0, 10, sftpFxpOpen, 0, 0, 0, 1, 0, 0, 0, 99, 'x'}
+	if _, err := w.Write(bad); err == nil {
+		t.Error("truncated field accepted")
+	}
+}
@@ -25,6 +25,7 @@
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,16 +33,20 @@
 	"time"
 
 	gossh "github.com/tailscale/golang-x-crypto/ssh"
+	"golang.org/x/exp/slices"
 	"tailscale.com/envknob"
 	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/logtail/backoff"
 	"tailscale.com/net/tsaddr"
+	"tailscale.com/net/tsdial"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tempfork/gliderlabs/ssh"
 	"tailscale.com/types/logger"
 	"tailscale.com/types/netmap"
 	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/mak"
+	"tailscale.com/util/multierr"
 )
 
 var (
@@ -62,8 +67,11 @@ type ipnLocalBackend interface {
 	ShouldRunSSH() bool
 	NetMap() *netmap.NetworkMap
 	WhoIs(ipp netip.AddrPort) (n *tailcfg.Node, u tailcfg.UserProfile, ok bool)
+	PeerCaps(src netip.Addr) []string
 	DoNoiseRequest(req *http.Request) (*http.Response, error)
 	TailscaleVarRoot() string
+	SSHPolicyFilePath() string
+	Dialer() *tsdial.Dialer
 }
 
 type server struct {
@@ -75,6 +83,9 @@ type server struct {
 	timeNow          func() time.Time // or nil for time.Now
 
 	sessionWaitGroup sync.WaitGroup
+	policyFile       policyFile    // the local SSH policy file
+	debugPolicyFile  policyFile    // the $TS_DEBUG_SSH_POLICY_FILE file
+	stopWatching     chan struct{} // closed on Shutdown; or nil
 
 	// mu protects the following
 	mu                   sync.Mutex
@@ -100,7 +111,9 @@ func init() {
 			lb:             lb,
 			logf:           logf,
 			tailscaledPath: tsd,
+			stopWatching:   make(chan struct{}),
 		}
+		go srv.watchPolicyFile(srv.stopWatching)
 		return srv, nil
 	})
 }
@@ -152,6 +165,9 @@ func (srv *server) HandleSSHConn(nc net.Conn) error {
 // Shutdown terminates all active sessions.
 func (srv *server) Shutdown() {
 	srv.mu.Lock()
+	if !srv.shutdownCalled && srv.stopWatching != nil {
+		close(srv.stopWatching)
+	}
 	srv.shutdownCalled = true
 	for c := range srv.activeConns {
 		c.Close()
@@ -175,6 +191,81 @@ func (srv *server) OnPolicyChange() {
 	}
 }
 
+// Sessions returns the active SSH sessions, oldest first.
+func (srv *server) Sessions() []*ipnstate.SSHSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var ret []*ipnstate.SSHSession
+	for c := range srv.activeConns {
+		if c.info == nil {
+			continue
+		}
+		c.mu.Lock()
+		for _, ss := range c.sessions {
+			s := &ipnstate.SSHSession{
+				ID:        ss.sharedID,
+				ConnID:    c.connID,
+				PeerAddr:  c.info.src,
+				PeerNode:  c.info.node.StableID,
+				PeerName:  c.info.node.Name,
+				LoginName: c.info.uprof.LoginName,
+				SSHUser:   c.info.sshUser,
+				Started:   ss.started,
+				Command:   ss.RawCommand(),
+				Recording: ss.recordingPath,
+			}
+			if c.localUser != nil {
+				s.LocalUser = c.localUser.Username
+			}
+			if ss.Subsystem() != "" {
+				s.Command = "subsystem:" + ss.Subsystem()
+			}
+			ret = append(ret, s)
+		}
+		c.mu.Unlock()
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Started.Before(ret[j].Started)
+	})
+	return ret
+}
+
+// KillSession terminates the SSH session with the given ID, or all
+// sessions on the connection if id is a connection ID. It reports whether
+// there was such a session or connection.
+func (srv *server) KillSession(id string) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for c := range srv.activeConns {
+		if c.info == nil {
+			continue
+		}
+		c.mu.Lock()
+		found := false
+		for _, ss := range c.sessions {
+			if ss.sharedID == id || c.connID == id {
+				metricSessionsKilled.Add(1)
+				ss.logf("terminating session at the request of the machine's owner")
+				ss.ctx.CloseWithError(userVisibleError{
+					"Session terminated by the machine's owner.",
+					context.Canceled,
+				})
+				found = true
+			}
+		}
+		c.mu.Unlock()
+		if c.connID == id {
+			c.logf("closing connection at the request of the machine's owner")
+			c.Close()
+			return true
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
 // conn represents a single SSH connection and its associated
 // ssh.Server.
 //
@@ -333,6 +424,10 @@ func (c *conn) PublicKeyHandler(ctx ssh.Context, pubKey ssh.PublicKey) error {
 	if err := c.isAuthorized(ctx); err != nil {
 		return err
 	}
+	if cert, ok := pubKey.(*gossh.Certificate); ok {
+		c.logf("accepting SSH certificate key ID %q serial %d signed by %s", cert.KeyId, cert.Serial, gossh.FingerprintSHA256(cert.SignatureKey))
+		return nil
+	}
 	c.logf("accepting SSH public key %s", bytes.TrimSpace(gossh.MarshalAuthorizedKey(pubKey)))
 	return nil
 }
@@ -409,6 +504,7 @@ func (srv *server) newConn() (*conn, error) {
 	c := &conn{srv: srv}
 	now := srv.now()
 	c.connID = fmt.Sprintf("ssh-conn-%s-%02x", now.UTC().Format("20060102T150405"), randBytes(5))
+	fwdHandler := &ssh.ForwardedTCPHandler{}
 	c.Server = &ssh.Server{
 		Version:              "Tailscale",
 		ServerConfigCallback: c.ServerConfig,
@@ -417,18 +513,26 @@ func (srv *server) newConn() (*conn, error) {
 		PublicKeyHandler:    c.PublicKeyHandler,
 		PasswordHandler:     c.fakePasswordHandler,
 
-		Handler:                     c.handleSessionPostSSHAuth,
-		LocalPortForwardingCallback: c.mayForwardLocalPortTo,
+		Handler:                       c.handleSessionPostSSHAuth,
+		LocalPortForwardingCallback:   c.mayForwardLocalPortTo,
+		ReversePortForwardingCallback: c.mayReversePortForwardTo,
+		X11Callback:                   c.mayForwardX11,
+		PtyCallback:                   c.mayAllocatePTY,
 		SubsystemHandlers: map[string]ssh.SubsystemHandler{
 			"sftp": c.handleSessionPostSSHAuth,
 		},
 		// Note: the direct-tcpip channel handler and LocalPortForwardingCallback
-		// only adds support for forwarding ports from the local machine.
-		// TODO(maisem/bradfitz): add remote port forwarding support.
+		// add support for forwarding ports from the local machine, and the
+		// tcpip-forward request handlers and ReversePortForwardingCallback
+		// add support for listening on this node and forwarding connections
+		// back to the client (remote port forwarding).
 		ChannelHandlers: map[string]ssh.ChannelHandler{
 			"direct-tcpip": ssh.DirectTCPIPHandler,
 		},
-		RequestHandlers: map[string]ssh.RequestHandler{},
+		RequestHandlers: map[string]ssh.RequestHandler{
+			"tcpip-forward":        fwdHandler.HandleSSHRequest,
+			"cancel-tcpip-forward": fwdHandler.HandleSSHRequest,
+		},
 	}
 	ss := c.Server
 	for k, v := range ssh.DefaultRequestHandlers {
@@ -454,13 +558,91 @@ func (srv *server) newConn() (*conn, error) {
 // to the specified host and port.
 // TODO(bradfitz/maisem): should we have more checks on host/port?
 func (c *conn) mayForwardLocalPortTo(ctx ssh.Context, destinationHost string, destinationPort uint32) bool {
-	if c.finalAction != nil && c.finalAction.AllowLocalPortForwarding {
+	if c.finalAction != nil && c.finalAction.AllowLocalPortForwarding && c.certPermits(certPermitPortForwarding) {
 		metricLocalPortForward.Add(1)
 		return true
 	}
 	return false
 }
 
+// mayReversePortForwardTo reports whether the ctx should be allowed to listen
+// on bindHost:bindPort on this node and forward the accepted connections
+// back to the client.
+func (c *conn) mayReversePortForwardTo(ctx ssh.Context, bindHost string, bindPort uint32) bool {
+	if c.finalAction == nil || !c.finalAction.AllowRemotePortForwarding || c.localUser == nil {
+		return false
+	}
+	if !c.certPermits(certPermitPortForwarding) {
+		return false
+	}
+	if !c.isReverseBindHostAllowed(bindHost) {
+		c.logf("denying remote port forward on %q; only loopback and this node's Tailscale IPs are allowed", bindHost)
+		return false
+	}
+	if bindPort != 0 && bindPort < 1024 && c.localUser.Uid != "0" {
+		// The listener is opened by tailscaled, which typically runs as
+		// root; don't let it bind privileged ports on behalf of users
+		// who couldn't bind them themselves.
+		c.logf("denying remote port forward to privileged port %d for local user %q", bindPort, c.localUser.Username)
+		return false
+	}
+	metricRemotePortForward.Add(1)
+	return true
+}
+
+// isReverseBindHostAllowed reports whether a remote port forward may listen
+// on host. Only loopback addresses and this node's Tailscale IPs are
+// allowed, so that a forward can't expose a port on the node's LAN or
+// public interfaces, including through the wildcard addresses.
+func (c *conn) isReverseBindHostAllowed(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	nm := c.srv.lb.NetMap()
+	if nm == nil {
+		return false
+	}
+	for _, a := range nm.Addresses {
+		if a.IsSingleIP() && a.Addr() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// mayForwardX11 reports whether the ctx should be allowed to forward X11
+// connections to the client.
+func (c *conn) mayForwardX11(ctx ssh.Context, x11 ssh.X11) bool {
+	if c.finalAction != nil && c.finalAction.AllowX11Forwarding && c.certPermits(certPermitX11Forwarding) {
+		metricX11Forward.Add(1)
+		return true
+	}
+	return false
+}
+
+// mayAllocatePTY reports whether the client may be given a pseudo-terminal
+// per the SSH policy.
+func (c *conn) mayAllocatePTY(ctx ssh.Context, pty ssh.Pty) bool {
+	if c.finalAction != nil && c.finalAction.DenyPTY {
+		c.logf("denied PTY request")
+		return false
+	}
+	return c.certPermits(certPermitPTY)
+}
+
+// mayForwardAgent reports whether the client may forward its SSH agent
+// per the SSH policy.
+func (c *conn) mayForwardAgent() bool {
+	return c.finalAction != nil && c.finalAction.AllowAgentForwarding && c.certPermits(certPermitAgentForwarding)
+}
+
 // havePubKeyPolicy reports whether any policy rule may provide access by means
 // of a ssh.PublicKey.
 func (c *conn) havePubKeyPolicy() bool {
@@ -481,7 +663,7 @@ func (c *conn) havePubKeyPolicy() bool {
 			continue
 		}
 		for _, p := range r.Principals {
-			if len(p.PubKeys) > 0 && c.principalMatchesTailscaleIdentity(p) {
+			if (len(p.PubKeys) > 0 || len(p.CertAuthorities) > 0) && c.principalMatchesTailscaleIdentity(p) {
 				return true
 			}
 		}
@@ -489,37 +671,19 @@ func (c *conn) havePubKeyPolicy() bool {
 	return false
 }
 
-// sshPolicy returns the SSHPolicy for current node.
-// If there is no SSHPolicy in the netmap, it returns a debugPolicy
-// if one is defined.
+// sshPolicy returns the SSHPolicy for current node: the one in the netmap
+// merged with the local SSH policy file, if any.
 func (c *conn) sshPolicy() (_ *tailcfg.SSHPolicy, ok bool) {
 	lb := c.srv.lb
 	if !lb.ShouldRunSSH() {
 		return nil, false
 	}
-	nm := lb.NetMap()
-	if nm == nil {
+	pol, err := c.srv.SSHPolicy()
+	if err != nil {
+		c.logf("%v", err)
 		return nil, false
 	}
-	if pol := nm.SSHPolicy; pol != nil && !envknob.SSHIgnoreTailnetPolicy() {
-		return pol, true
-	}
-	debugPolicyFile := envknob.SSHPolicyFile()
-	if debugPolicyFile != "" {
-		c.logf("reading debug SSH policy file: %v", debugPolicyFile)
-		f, err := os.ReadFile(debugPolicyFile)
-		if err != nil {
-			c.logf("error reading debug SSH policy file: %v", err)
-			return nil, false
-		}
-		p := new(tailcfg.SSHPolicy)
-		if err := json.Unmarshal(f, p); err != nil {
-			c.logf("invalid JSON in %v: %v", debugPolicyFile, err)
-			return nil, false
-		}
-		return p, true
-	}
-	return nil, false
+	return pol, pol != nil
 }
 
 func toIPPort(a net.Addr) (ipp netip.AddrPort) {
@@ -787,10 +951,12 @@ type sshSession struct {
 	ssh.Session
 	sharedID string // ID that's shared with control
 	logf     logger.Logf
+	started  time.Time
 
 	ctx           *sshContext // implements context.Context
 	conn          *conn
 	agentListener net.Listener // non-nil if agent-forwarding requested+allowed
+	x11           *x11Forward  // non-nil if X11 forwarding requested+allowed
 
 	// initialized by launchProcess:
 	cmd    *exec.Cmd
@@ -799,6 +965,11 @@ type sshSession struct {
 	stderr io.Reader // nil for pty sessions
 	ptyReq *ssh.Pty  // non-nil for pty sessions
 
+	// recordingPath is the path of the session's local recording file,
+	// or "remote" if it's streamed to a recorder. It's protected by
+	// conn.mu.
+	recordingPath string
+
 	// We use this sync.Once to ensure that we only terminate the process once,
 	// either it exits itself or is terminated
 	exitOnce sync.Once
@@ -812,10 +983,15 @@ func (ss *sshSession) vlogf(format string, args ...interface{}) {
 
 func (c *conn) newSSHSession(s ssh.Session) *sshSession {
 	sharedID := fmt.Sprintf("sess-%s-%02x", c.srv.now().UTC().Format("20060102T150405"), randBytes(5))
-	c.logf("starting session: %v", sharedID)
+	if cert, ok := c.pubKey.(*gossh.Certificate); ok {
+		c.logf("starting session: %v (certificate key ID %q)", sharedID, cert.KeyId)
+	} else {
+		c.logf("starting session: %v", sharedID)
+	}
 	return &sshSession{
 		Session:  s,
 		sharedID: sharedID,
+		started:  c.srv.now(),
 		ctx:      newSSHContext(s.Context()),
 		conn:     c,
 		logf:     logger.WithPrefix(c.srv.logf, "ssh-session("+sharedID+"): "),
@@ -944,7 +1120,7 @@ func (c *conn) detachSession(ss *sshSession) {
 // forwards agent connections between the listener and the ssh.Session.
 // On success, it assigns ss.agentListener.
 func (ss *sshSession) handleSSHAgentForwarding(s ssh.Session, lu *user.User) error {
-	if !ssh.AgentRequested(ss) || !ss.conn.finalAction.AllowAgentForwarding {
+	if !ssh.AgentRequested(ss) || !ss.conn.mayForwardAgent() {
 		return nil
 	}
 	ss.logf("ssh: agent forwarding requested")
@@ -1029,11 +1205,17 @@ func (ss *sshSession) run() {
 		}
 	}
 
+	if ss.Subsystem() == "sftp" && ss.conn.forceCommand() != "" {
+		ss.logf("refusing SFTP with a forced command")
+		fmt.Fprintf(ss.Stderr(), "SFTP is not permitted\r\n")
+		ss.Exit(1)
+		return
+	}
+
 	// Take control of the PTY so that we can configure it below.
 	// See https://github.com/tailscale/tailscale/issues/4146
 	ss.DisablePTYEmulation()
 
-	var rec *recording // or nil if disabled
 	if ss.Subsystem() != "sftp" {
 		if err := ss.handleSSHAgentForwarding(ss, lu); err != nil {
 			ss.logf("agent forwarding failed: %v", err)
@@ -1041,18 +1223,27 @@ func (ss *sshSession) run() {
 			// TODO(maisem/bradfitz): add a way to close all session resources
 			defer ss.agentListener.Close()
 		}
+		if err := ss.handleX11Forwarding(); err != nil {
+			ss.logf("X11 forwarding failed: %v", err)
+		} else if ss.x11 != nil {
+			defer ss.x11.Close()
+		}
+	}
 
-		if ss.shouldRecord() {
-			var err error
-			rec, err = ss.startNewRecording()
-			if err != nil {
-				fmt.Fprintf(ss, "can't start new recording\r\n")
-				ss.logf("startNewRecording: %v", err)
-				ss.Exit(1)
-				return
-			}
-			defer rec.Close()
+	var rec *recording // or nil if disabled
+	if ss.shouldRecord() {
+		var err error
+		rec, err = ss.startNewRecording()
+		if err != nil {
+			fmt.Fprintf(ss.Stderr(), "can't start new recording\r\n")
+			ss.logf("startNewRecording: %v", err)
+			ss.Exit(1)
+			return
 		}
+		defer rec.Close()
+		ss.conn.mu.Lock()
+		ss.recordingPath = rec.path
+		ss.conn.mu.Unlock()
 	}
 
 	err := ss.launchProcess()
@@ -1090,7 +1281,7 @@ func (ss *sshSession) run() {
 	// stderr is nil for ptys.
 	if ss.stderr != nil {
 		go func() {
-			_, err := io.Copy(ss.Stderr(), ss.stderr)
+			_, err := io.Copy(rec.writer("e", ss.Stderr()), ss.stderr)
 			if err != nil {
 				logf("stderr copy: %v", err)
 			}
@@ -1105,6 +1296,11 @@ func (ss *sshSession) run() {
 	// or itself will be a no-op because the process was killed by the
 	// aforementioned goroutine.
 	ss.exitOnce.Do(func() {})
+	if ss.hasResourceLimits() {
+		if err := removeResourceLimits(ss.sharedID); err != nil {
+			logf("removing resource limits: %v", err)
+		}
+	}
 
 	if err == nil {
 		ss.logf("Session complete")
@@ -1124,11 +1320,7 @@ func (ss *sshSession) run() {
 }
 
 func (ss *sshSession) shouldRecord() bool {
-	// for now only record pty sessions
-	// TODO(bradfitz,maisem): make configurable on SSHPolicy and
-	// support recording non-pty stuff too.
-	_, _, isPtyReq := ss.Pty()
-	return recordSSH() && isPtyReq
+	return recordSSH() || len(ss.conn.finalAction.Recorders) > 0
 }
 
 type sshConnInfo struct {
@@ -1244,9 +1436,9 @@ func (c *conn) principalMatches(p *tailcfg.SSHPrincipal, pubKey gossh.PublicKey)
 	return c.principalMatchesPubKey(p, pubKey)
 }
 
-// principalMatchesTailscaleIdentity reports whether one of p's four fields
-// that match the Tailscale identity match (Node, NodeIP, UserLogin, Any).
-// This function does not consider PubKeys.
+// principalMatchesTailscaleIdentity reports whether one of p's fields
+// that match the Tailscale identity match (Node, NodeIP, UserLogin, Any,
+// NodeTag, UserID, PeerCap). This function does not consider PubKeys.
 func (c *conn) principalMatchesTailscaleIdentity(p *tailcfg.SSHPrincipal) bool {
 	ci := c.info
 	if p.Any {
@@ -1263,16 +1455,43 @@ func (c *conn) principalMatchesTailscaleIdentity(p *tailcfg.SSHPrincipal) bool {
 	if p.UserLogin != "" && ci.uprof.LoginName == p.UserLogin {
 		return true
 	}
+	if n := ci.node; n != nil {
+		if p.NodeTag != "" && slices.Contains(n.Tags, p.NodeTag) {
+			return true
+		}
+		// Tagged nodes are owned by their tags, not the user who
+		// tagged them.
+		if !p.UserID.IsZero() && len(n.Tags) == 0 && n.User == p.UserID {
+			return true
+		}
+	}
+	if p.PeerCap != "" && slices.Contains(c.srv.lb.PeerCaps(ci.src.Addr()), p.PeerCap) {
+		return true
+	}
 	return false
 }
 
+// principalMatchesPubKey reports whether clientPubKey satisfies p's
+// PubKeys or CertAuthorities. If both are empty, any (or no) key matches.
 func (c *conn) principalMatchesPubKey(p *tailcfg.SSHPrincipal, clientPubKey gossh.PublicKey) (bool, error) {
-	if len(p.PubKeys) == 0 {
+	if len(p.PubKeys) == 0 && len(p.CertAuthorities) == 0 {
 		return true, nil
 	}
 	if clientPubKey == nil {
 		return false, nil
 	}
+	if len(p.CertAuthorities) > 0 {
+		if cert, ok := clientPubKey.(*gossh.Certificate); ok {
+			if err := c.checkUserCert(cert, p.CertAuthorities); err != nil {
+				c.logf("SSH certificate %q not accepted: %v", cert.KeyId, err)
+			} else {
+				return true, nil
+			}
+		}
+	}
+	if len(p.PubKeys) == 0 {
+		return false, nil
+	}
 	knownKeys := p.PubKeys
 	if len(knownKeys) == 1 && strings.HasPrefix(knownKeys[0], "https://") {
 		var err error
@@ -1289,6 +1508,100 @@ func (c *conn) principalMatchesPubKey(p *tailcfg.SSHPrincipal, clientPubKey goss
 	return false, nil
 }
 
+// supportedCertCriticalOptions are the OpenSSH certificate critical
+// options that are enforced. Certificates with any other critical option
+// are rejected, as OpenSSH does.
+var supportedCertCriticalOptions = []string{"force-command", "source-address"}
+
+// checkUserCert returns an error unless cert is a currently valid user
+// certificate for the requested SSH user, signed by one of the certificate
+// authorities in cas (in authorized_keys format), whose source-address
+// critical option (if any) permits the client's address.
+func (c *conn) checkUserCert(cert *gossh.Certificate, cas []string) error {
+	if cert.CertType != gossh.UserCert {
+		return fmt.Errorf("certificate type %d is not a user certificate", cert.CertType)
+	}
+	if !slices.ContainsFunc(cas, func(ca string) bool {
+		return pubKeyMatchesAuthorizedKey(cert.SignatureKey, ca)
+	}) {
+		return errors.New("certificate not signed by a trusted authority")
+	}
+	// Unlike OpenSSH's authorized_keys, a certificate that doesn't
+	// list any principals isn't valid for every user.
+	if len(cert.ValidPrincipals) == 0 {
+		return errors.New("certificate has no principals")
+	}
+	checker := &gossh.CertChecker{
+		SupportedCriticalOptions: supportedCertCriticalOptions,
+		Clock:                    c.srv.now,
+	}
+	if err := checker.CheckCert(c.info.sshUser, cert); err != nil {
+		return err
+	}
+	if v, ok := cert.CriticalOptions["source-address"]; ok {
+		if !certSourceAddressAllows(v, c.info.src.Addr()) {
+			return fmt.Errorf("source address %v not permitted by certificate", c.info.src.Addr())
+		}
+	}
+	return nil
+}
+
+// certSourceAddressAllows reports whether the value of an OpenSSH
+// certificate's source-address critical option, a comma-separated list of
+// addresses and CIDR prefixes, contains ip.
+func certSourceAddressAllows(v string, ip netip.Addr) bool {
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if pfx, err := netip.ParsePrefix(s); err == nil {
+			if pfx.Contains(ip) {
+				return true
+			}
+		} else if a, err := netip.ParseAddr(s); err == nil && a == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenSSH certificate extensions that grant permissions. When the client
+// authenticates with a certificate, each of these is only permitted (in
+// addition to being allowed by the SSH policy) if the certificate has the
+// extension, as OpenSSH does.
+const (
+	certPermitPortForwarding  = "permit-port-forwarding"
+	certPermitPTY             = "permit-pty"
+	certPermitAgentForwarding = "permit-agent-forwarding"
+	certPermitX11Forwarding   = "permit-X11-forwarding"
+)
+
+// certPermits reports whether the client's certificate, if it
+// authenticated with one, has the permission extension ext. Clients that
+// didn't authenticate with a certificate aren't restricted by extensions.
+func (c *conn) certPermits(ext string) bool {
+	cert, ok := c.pubKey.(*gossh.Certificate)
+	if !ok {
+		return true
+	}
+	if _, ok := cert.Extensions[ext]; !ok {
+		c.logf("denied: certificate %q lacks %s", cert.KeyId, ext)
+		return false
+	}
+	return true
+}
+
+// forceCommand returns the command that the session must run instead of
+// the one the client requested, if any: the policy's ForceCommand, or else
+// the force-command critical option of the client's certificate.
+func (c *conn) forceCommand() string {
+	if fc := c.finalAction.ForceCommand; fc != "" {
+		return fc
+	}
+	if cert, ok := c.pubKey.(*gossh.Certificate); ok {
+		return cert.CriticalOptions["force-command"]
+	}
+	return ""
+}
+
 func pubKeyMatchesAuthorizedKey(pubKey ssh.PublicKey, wantKey string) bool {
 	wantKeyType, rest, ok := strings.Cut(wantKey, " ")
 	if !ok {
@@ -1312,7 +1625,8 @@ func randBytes(n int) []byte {
 
 // startNewRecording starts a new SSH session recording.
 //
-// It writes an asciinema file to
+// If the session's SSHAction has Recorders, it streams the recording to
+// one of them. Otherwise, it writes an asciinema file to
 // $TAILSCALE_VAR_ROOT/ssh-sessions/ssh-session-<unixtime>-*.cast.
 func (ss *sshSession) startNewRecording() (_ *recording, err error) {
 	var w ssh.Window
@@ -1330,13 +1644,11 @@ func (ss *sshSession) startNewRecording() (_ *recording, err error) {
 		ss:    ss,
 		start: now,
 	}
-	varRoot := ss.conn.srv.lb.TailscaleVarRoot()
-	if varRoot == "" {
-		return nil, errors.New("no var root for recording storage")
-	}
-	dir := filepath.Join(varRoot, "ssh-sessions")
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return nil, err
+	command := ss.RawCommand()
+	if ss.Subsystem() == "sftp" {
+		// Record the file operations, not the SFTP protocol stream.
+		rec.sftp = &sftpLogger{emit: rec.writeSFTPEvent}
+		command = "internal-sftp"
 	}
 	defer func() {
 		if err != nil {
@@ -1344,11 +1656,40 @@ func (ss *sshSession) startNewRecording() (_ *recording, err error) {
 		}
 	}()
 
-	f, err := os.CreateTemp(dir, fmt.Sprintf("ssh-session-%v-*.cast", now.UnixNano()))
-	if err != nil {
-		return nil, err
+	if recs := ss.conn.finalAction.Recorders; len(recs) > 0 {
+		w, errc, err := connectToRecorder(ss.ctx, recs, ss.conn.srv.lb.Dialer().UserDial)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			if err := <-errc; err != nil {
+				ss.logf("recording upload failed: %v", err)
+				ss.ctx.CloseWithError(userVisibleError{
+					"Session recording failed; terminating session.",
+					err,
+				})
+			}
+		}()
+		rec.out = w
+		rec.path = "remote"
+		ss.logf("starting asciinema recording to remote recorder")
+	} else {
+		varRoot := ss.conn.srv.lb.TailscaleVarRoot()
+		if varRoot == "" {
+			return nil, errors.New("no var root for recording storage")
+		}
+		dir := filepath.Join(varRoot, "ssh-sessions")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.CreateTemp(dir, fmt.Sprintf("ssh-session-%v-*.cast", now.UnixNano()))
+		if err != nil {
+			return nil, err
+		}
+		rec.out = f
+		rec.path = f.Name()
+		ss.logf("starting asciinema recording to %s", f.Name())
 	}
-	rec.out = f
 
 	// {"version": 2, "width": 221, "height": 84, "timestamp": 1647146075, "env": {"SHELL": "/bin/bash", "TERM": "screen"}}
 	type CastHeader struct {
@@ -1356,6 +1697,7 @@ type CastHeader struct {
 		Width     int               `json:"width"`
 		Height    int               `json:"height"`
 		Timestamp int64             `json:"timestamp"`
+		Command   string            `json:"command,omitempty"` // empty for shells
 		Env       map[string]string `json:"env"`
 	}
 	j, err := json.Marshal(CastHeader{
@@ -1363,6 +1705,7 @@ type CastHeader struct {
 		Width:     w.Width,
 		Height:    w.Height,
 		Timestamp: now.Unix(),
+		Command:   command,
 		Env: map[string]string{
 			"TERM": term,
 			// TODO(bradfitz): anything else important?
@@ -1376,50 +1719,187 @@ type CastHeader struct {
 		},
 	})
 	if err != nil {
-		f.Close()
 		return nil, err
 	}
-	ss.logf("starting asciinema recording to %s", f.Name())
 	j = append(j, '\n')
-	if _, err := f.Write(j); err != nil {
-		f.Close()
+	if _, err := rec.out.Write(j); err != nil {
 		return nil, err
 	}
 	return rec, nil
 }
 
+// recorderResponseTimeout is how long to wait for a recorder to
+// acknowledge a recording after its upload is complete.
+const recorderResponseTimeout = 10 * time.Second
+
+// recorderWriteTimeout is how long a write to a recorder may block before
+// the recorder is considered stalled and the upload fails. It's a var for
+// tests.
+var recorderWriteTimeout = 10 * time.Second
+
+// recorderConn is a connection to a recorder whose writes time out after
+// recorderWriteTimeout. The upload body is streamed, so
+// recorderResponseTimeout doesn't apply until the session ends; this is
+// what stops a recorder that accepts the connection but then stops
+// reading from blocking the session forever.
+type recorderConn struct {
+	net.Conn
+}
+
+func (c recorderConn) Write(p []byte) (int, error) {
+	if err := c.SetWriteDeadline(time.Now().Add(recorderWriteTimeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+// connectToRecorder connects to the first of recs that accepts a
+// connection, using dial, and starts uploading a session recording to it.
+//
+// It returns a WriteCloser to stream the recording to, and a channel
+// that receives the result of the upload once the WriteCloser is closed
+// or the upload fails. Once the upload has failed, writes to the
+// WriteCloser fail too. The upload fails if the recorder stops reading for
+// recorderWriteTimeout.
+func connectToRecorder(ctx context.Context, recs []netip.AddrPort, dial func(ctx context.Context, network, addr string) (net.Conn, error)) (io.WriteCloser, <-chan error, error) {
+	var (
+		conn net.Conn
+		rec  netip.AddrPort
+		errs []error
+	)
+	for _, ap := range recs {
+		c, err := dial(ctx, "tcp", ap.String())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn, rec = recorderConn{c}, ap
+		break
+	}
+	if conn == nil {
+		return nil, nil, fmt.Errorf("connecting to recorder: %w", multierr.New(errs...))
+	}
+
+	var dialed atomic.Bool
+	hc := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(context.Context, string, string) (net.Conn, error) {
+				if dialed.Swap(true) {
+					return nil, errors.New("recorder connection already used")
+				}
+				return conn, nil
+			},
+			DisableKeepAlives:     true,
+			ResponseHeaderTimeout: recorderResponseTimeout,
+		},
+	}
+	pr, pw := io.Pipe()
+	// The upload outlives ctx: it's finished by closing pw, usually just
+	// before the session's context is canceled.
+	req, err := http.NewRequestWithContext(context.Background(), "POST", "http://"+rec.String()+"/record", pr)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		err := doRecorderUpload(hc, req)
+		// Fail any further writes, even if the recorder responded
+		// before we finished.
+		pr.CloseWithError(err)
+		errc <- err
+	}()
+	return pw, errc, nil
+}
+
+// doRecorderUpload sends req, a recording upload, with hc, returning an
+// error unless the recorder accepted the recording.
+func doRecorderUpload(hc *http.Client, req *http.Request) error {
+	res, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading recording: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("recorder responded with %v", res.Status)
+	}
+	return nil
+}
+
 // recording is the state for an SSH session recording.
+//
+// It's an asciinema cast of the session's input and output. For SFTP
+// sessions, the cast instead has an "sftp" event with a JSON sftpEvent
+// for each file operation.
 type recording struct {
 	ss    *sshSession
 	start time.Time
+	sftp  *sftpLogger // non-nil for SFTP sessions
+	path  string      // the cast file, or "remote" for a recorder
 
-	mu  sync.Mutex // guards writes to, close of out
-	out *os.File   // nil if closed
+	// out is the cast file or recorder upload, or nil if closed. Both
+	// are safe for concurrent use, and writes to them may block (on a
+	// slow recorder), so mu is only held to load or clear out, not while
+	// writing to or closing it.
+	mu  sync.Mutex
+	out io.WriteCloser
 }
 
 func (r *recording) Close() error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-	if r.out == nil {
+	out := r.out
+	r.out = nil
+	r.mu.Unlock()
+	if out == nil {
 		return nil
 	}
-	err := r.out.Close()
-	r.out = nil
-	return err
+	return out.Close()
 }
 
 // writer returns an io.Writer around w that first records the write.
 //
-// The dir should be "i" for input or "o" for output.
+// The dir should be "i" for input, "o" for output or "e" for error output,
+// which is recorded as output. For SFTP sessions, input and output are
+// parsed for file operations to record instead, and error output isn't
+// recorded.
 //
 // If r is nil, it returns w unchanged.
 func (r *recording) writer(dir string, w io.Writer) io.Writer {
 	if r == nil {
 		return w
 	}
+	if r.sftp != nil {
+		switch dir {
+		case "i":
+			return r.sftp.clientWriter(w)
+		case "o":
+			return r.sftp.serverWriter(w)
+		}
+		return w
+	}
+	if dir == "e" {
+		dir = "o"
+	}
 	return &loggingWriter{r, dir, w}
 }
 
+// writeSFTPEvent records the SFTP file operation ev.
+func (r *recording) writeSFTPEvent(ev sftpEvent) error {
+	evj, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	j, err := json.Marshal([]any{
+		time.Since(r.start).Seconds(),
+		"sftp",
+		string(evj),
+	})
+	if err != nil {
+		return err
+	}
+	return r.writeCastLine(append(j, '\n'))
+}
+
 // loggingWriter is an io.Writer wrapper that writes first an
 // asciinema JSON cast format recording line, and then writes to w.
 type loggingWriter struct {
@@ -1438,19 +1918,20 @@ func (w loggingWriter) Write(p []byte) (n int, err error) {
 		return 0, err
 	}
 	j = append(j, '\n')
-	if err := w.writeCastLine(j); err != nil {
+	if err := w.r.writeCastLine(j); err != nil {
 		return 0, err
 	}
 	return w.w.Write(p)
 }
 
-func (w loggingWriter) writeCastLine(j []byte) error {
-	w.r.mu.Lock()
-	defer w.r.mu.Unlock()
-	if w.r.out == nil {
+func (r *recording) writeCastLine(j []byte) error {
+	r.mu.Lock()
+	out := r.out
+	r.mu.Unlock()
+	if out == nil {
 		return errors.New("logger closed")
 	}
-	_, err := w.r.out.Write(j)
+	_, err := out.Write(j)
 	if err != nil {
 		return fmt.Errorf("logger Write: %w", err)
 	}
@@ -1487,6 +1968,9 @@ func envEq(a, b string) bool {
 	metricTerminalFetchError   = clientmetric.NewCounter("ssh_terminalaction_fetch_error")
 	metricHolds                = clientmetric.NewCounter("ssh_holds")
 	metricPolicyChangeKick     = clientmetric.NewCounter("ssh_policy_change_kick")
+	metricSessionsKilled       = clientmetric.NewCounter("ssh_sessions_killed")
 	metricSFTP                 = clientmetric.NewCounter("ssh_sftp_requests")
 	metricLocalPortForward     = clientmetric.NewCounter("ssh_local_port_forward_requests")
+	metricRemotePortForward    = clientmetric.NewCounter("ssh_remote_port_forward_requests")
+	metricX11Forward           = clientmetric.NewCounter("ssh_x11_forward_requests")
 )
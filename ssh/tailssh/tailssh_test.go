@@ -8,6 +8,7 @@
 
 import (
 	"bytes"
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
@@ -32,6 +33,7 @@
 
 	gossh "github.com/tailscale/golang-x-crypto/ssh"
 	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/ipn/store/mem"
 	"tailscale.com/net/nettest"
 	"tailscale.com/net/tsdial"
@@ -186,6 +188,74 @@ func TestMatchRule(t *testing.T) {
 			ci:       &sshConnInfo{uprof: tailcfg.UserProfile{LoginName: "foo@bar.com"}},
 			wantUser: "ubuntu",
 		},
+		{
+			name: "match-principal-node-tag",
+			rule: &tailcfg.SSHRule{
+				Action:     someAction,
+				Principals: []*tailcfg.SSHPrincipal{{NodeTag: "tag:prod"}},
+				SSHUsers:   map[string]string{"*": "ubuntu"},
+			},
+			ci:       &sshConnInfo{node: &tailcfg.Node{Tags: []string{"tag:dev", "tag:prod"}}},
+			wantUser: "ubuntu",
+		},
+		{
+			name: "no-match-principal-node-tag",
+			rule: &tailcfg.SSHRule{
+				Action:     someAction,
+				Principals: []*tailcfg.SSHPrincipal{{NodeTag: "tag:prod"}},
+				SSHUsers:   map[string]string{"*": "ubuntu"},
+			},
+			ci:      &sshConnInfo{node: &tailcfg.Node{Tags: []string{"tag:dev"}}},
+			wantErr: errPrincipalMatch,
+		},
+		{
+			name: "match-principal-user-id",
+			rule: &tailcfg.SSHRule{
+				Action:     someAction,
+				Principals: []*tailcfg.SSHPrincipal{{UserID: 42}},
+				SSHUsers:   map[string]string{"*": "ubuntu"},
+			},
+			ci:       &sshConnInfo{node: &tailcfg.Node{User: 42}},
+			wantUser: "ubuntu",
+		},
+		{
+			name: "no-match-principal-user-id-tagged",
+			rule: &tailcfg.SSHRule{
+				Action:     someAction,
+				Principals: []*tailcfg.SSHPrincipal{{UserID: 42}},
+				SSHUsers:   map[string]string{"*": "ubuntu"},
+			},
+			ci:      &sshConnInfo{node: &tailcfg.Node{User: 42, Tags: []string{"tag:prod"}}},
+			wantErr: errPrincipalMatch,
+		},
+		{
+			name: "match-principal-peer-cap",
+			rule: &tailcfg.SSHRule{
+				Action:     someAction,
+				Principals: []*tailcfg.SSHPrincipal{{PeerCap: "https://example.com/cap/ssh"}},
+				SSHUsers:   map[string]string{"*": "ubuntu"},
+			},
+			ci: &sshConnInfo{
+				src:  netip.MustParseAddrPort("100.64.1.2:1234"),
+				node: &tailcfg.Node{},
+			},
+			wantUser: "ubuntu",
+		},
+		{
+			// Node.Capabilities are the node's own capabilities from
+			// control, not ones granted to it by the packet filter.
+			name: "no-match-principal-peer-cap-node-capabilities",
+			rule: &tailcfg.SSHRule{
+				Action:     someAction,
+				Principals: []*tailcfg.SSHPrincipal{{PeerCap: "https://example.com/cap/ssh"}},
+				SSHUsers:   map[string]string{"*": "ubuntu"},
+			},
+			ci: &sshConnInfo{
+				src:  netip.MustParseAddrPort("100.64.1.3:1234"),
+				node: &tailcfg.Node{Capabilities: []string{"https://example.com/cap/ssh"}},
+			},
+			wantErr: errPrincipalMatch,
+		},
 		{
 			name: "ssh-user-equal",
 			rule: &tailcfg.SSHRule{
@@ -199,11 +269,16 @@ func TestMatchRule(t *testing.T) {
 			wantUser: "alice",
 		},
 	}
+	lb := &localState{
+		peerCaps: map[netip.Addr][]string{
+			netip.MustParseAddr("100.64.1.2"): {"https://example.com/cap/ssh"},
+		},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &conn{
 				info: tt.ci,
-				srv:  &server{logf: t.Logf},
+				srv:  &server{lb: lb, logf: t.Logf},
 			}
 			got, gotUser, err := c.matchRule(tt.rule, nil)
 			if err != tt.wantErr {
@@ -230,6 +305,12 @@ type localState struct {
 	// It is served for paths like https://unused/ssh-action/<action-name>.
 	// The action name is the last part of the action URL.
 	serverActions map[string]*tailcfg.SSHAction
+
+	policyFile string // path of the local SSH policy file, if any
+
+	selfAddrs []netip.Prefix // the node's Tailscale IPs, as in NetworkMap.Addresses
+
+	peerCaps map[netip.Addr][]string // capabilities granted to peers by IP
 }
 
 var (
@@ -271,20 +352,25 @@ func (ts *localState) NetMap() *netmap.NetworkMap {
 		SelfNode: &tailcfg.Node{
 			ID: 1,
 		},
+		Addresses: ts.selfAddrs,
 		SSHPolicy: policy,
 	}
 }
 
 func (ts *localState) WhoIs(ipp netip.AddrPort) (n *tailcfg.Node, u tailcfg.UserProfile, ok bool) {
 	return &tailcfg.Node{
-			ID:       2,
-			StableID: "peer-id",
-		}, tailcfg.UserProfile{
-			LoginName: "peer",
-		}, true
+		ID:       2,
+		StableID: "peer-id",
+	}, tailcfg.UserProfile{
+		LoginName: "peer",
+	}, true
 
 }
 
+func (ts *localState) PeerCaps(src netip.Addr) []string {
+	return ts.peerCaps[src]
+}
+
 func (ts *localState) DoNoiseRequest(req *http.Request) (*http.Response, error) {
 	rec := httptest.NewRecorder()
 	k, ok := strs.CutPrefix(req.URL.Path, "/ssh-action/")
@@ -307,6 +393,14 @@ func (ts *localState) TailscaleVarRoot() string {
 	return ""
 }
 
+func (ts *localState) SSHPolicyFilePath() string {
+	return ts.policyFile
+}
+
+func (ts *localState) Dialer() *tsdial.Dialer {
+	return new(tsdial.Dialer)
+}
+
 func newSSHRule(action *tailcfg.SSHAction) *tailcfg.SSHRule {
 	return &tailcfg.SSHRule{
 		SSHUsers: map[string]string{
@@ -640,6 +734,245 @@ func TestSSH(t *testing.T) {
 			t.Errorf("got %q; want %q", got, str)
 		}
 	})
+
+	t.Run("force_command", func(t *testing.T) {
+		defer func(a *tailcfg.SSHAction) { sc.finalAction = a }(sc.finalAction)
+		sc.finalAction = &tailcfg.SSHAction{
+			Accept:       true,
+			ForceCommand: `echo "forced $SSH_ORIGINAL_COMMAND $FOO"`,
+			SetEnv:       map[string]string{"FOO": "bar"},
+		}
+		got, err := execSSH("hostname").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "forced hostname bar\n"; string(got) != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		srv.trackActiveConn(sc, true)
+		defer srv.trackActiveConn(sc, false)
+
+		cmd := execSSH("sleep", "30")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+
+		var sessions []*ipnstate.SSHSession
+		for deadline := time.Now().Add(10 * time.Second); len(sessions) == 0; {
+			if time.Now().After(deadline) {
+				t.Fatal("timeout waiting for session")
+			}
+			time.Sleep(10 * time.Millisecond)
+			sessions = srv.Sessions()
+		}
+		if len(sessions) != 1 {
+			t.Fatalf("got %d sessions; want 1", len(sessions))
+		}
+		s := sessions[0]
+		if s.ConnID != sc.connID || s.LocalUser != u.Username || s.Command != "sleep 30" {
+			t.Errorf("unexpected session %+v", s)
+		}
+
+		if srv.KillSession("sess-unknown") {
+			t.Error("killed unknown session")
+		}
+		if !srv.KillSession(s.ID) {
+			t.Fatal("session not found")
+		}
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("killed session exited successfully")
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for killed session to end")
+		}
+	})
+}
+
+func TestMayReversePortForwardTo(t *testing.T) {
+	root := &user.User{Uid: "0", Username: "root"}
+	alice := &user.User{Uid: "1000", Username: "alice"}
+	allow := &tailcfg.SSHAction{Accept: true, AllowRemotePortForwarding: true}
+	lb := &localState{
+		selfAddrs: []netip.Prefix{
+			netip.MustParsePrefix("100.64.0.1/32"),
+			netip.MustParsePrefix("fd7a:115c:a1e0::1/128"),
+		},
+	}
+	tests := []struct {
+		name   string
+		action *tailcfg.SSHAction
+		user   *user.User
+		host   string
+		port   uint32
+		want   bool
+	}{
+		{"no-action", nil, alice, "localhost", 8080, false},
+		{"not-allowed", &tailcfg.SSHAction{Accept: true, AllowLocalPortForwarding: true}, alice, "localhost", 8080, false},
+		{"allowed", allow, alice, "localhost", 8080, true},
+		{"any-port", allow, alice, "localhost", 0, true},
+		{"privileged-port", allow, alice, "localhost", 80, false},
+		{"privileged-port-root", allow, root, "localhost", 80, true},
+		{"no-user", allow, nil, "localhost", 8080, false},
+		{"loopback-v4", allow, alice, "127.0.0.1", 8080, true},
+		{"loopback-v6", allow, alice, "::1", 8080, true},
+		{"tailscale-ip-v4", allow, alice, "100.64.0.1", 8080, true},
+		{"tailscale-ip-v6", allow, alice, "fd7a:115c:a1e0::1", 8080, true},
+		{"other-tailscale-ip", allow, alice, "100.64.0.2", 8080, false},
+		{"all-interfaces", allow, alice, "0.0.0.0", 8080, false},
+		{"all-interfaces-v6", allow, alice, "::", 8080, false},
+		{"all-interfaces-empty", allow, alice, "", 8080, false},
+		{"lan", allow, alice, "192.168.1.10", 8080, false},
+		{"hostname", allow, alice, "example.com", 8080, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &conn{
+				srv:         &server{lb: lb, logf: t.Logf},
+				finalAction: tt.action,
+				localUser:   tt.user,
+			}
+			if got := c.mayReversePortForwardTo(nil, tt.host, tt.port); got != tt.want {
+				t.Errorf("mayReversePortForwardTo(%q, %d) = %v; want %v", tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectToRecorder(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []byte
+	)
+	recorder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/record" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		got = b
+		mu.Unlock()
+	}))
+	defer recorder.Close()
+	recorderAddr := netip.MustParseAddrPort(recorder.Listener.Addr().String())
+
+	// Listen and close, to get an address that refuses connections.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := netip.MustParseAddrPort(ln.Addr().String())
+	ln.Close()
+
+	var d net.Dialer
+	ctx := context.Background()
+
+	t.Run("upload", func(t *testing.T) {
+		w, errc, err := connectToRecorder(ctx, []netip.AddrPort{deadAddr, recorderAddr}, d.DialContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const cast = "{\"version\": 2}\n[0.1, \"o\", \"hi\"]\n"
+		if _, err := io.WriteString(w, cast); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		if err := <-errc; err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if string(got) != cast {
+			t.Errorf("recorder got %q; want %q", got, cast)
+		}
+	})
+
+	t.Run("no-recorder", func(t *testing.T) {
+		if _, _, err := connectToRecorder(ctx, []netip.AddrPort{deadAddr}, d.DialContext); err == nil {
+			t.Fatal("connectToRecorder with no reachable recorder succeeded")
+		}
+	})
+
+	t.Run("upload-failure", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "disk full", http.StatusInsufficientStorage)
+		}))
+		defer failing.Close()
+		w, errc, err := connectToRecorder(ctx, []netip.AddrPort{netip.MustParseAddrPort(failing.Listener.Addr().String())}, d.DialContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The recorder responds without reading anything.
+		uploadErr := <-errc
+		if uploadErr == nil {
+			t.Fatal("failed upload reported success")
+		}
+		if _, err := w.Write([]byte("x")); !errors.Is(err, uploadErr) {
+			t.Errorf("write to failed upload = %v; want %v", err, uploadErr)
+		}
+	})
+
+	t.Run("stalled-recorder", func(t *testing.T) {
+		defer func(d time.Duration) { recorderWriteTimeout = d }(recorderWriteTimeout)
+		recorderWriteTimeout = 100 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// A recorder that accepts the connection but never reads.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		go func() {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			<-ctx.Done()
+		}()
+
+		w, errc, err := connectToRecorder(ctx, []netip.AddrPort{netip.MustParseAddrPort(ln.Addr().String())}, d.DialContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		werrc := make(chan error, 1)
+		go func() {
+			buf := bytes.Repeat([]byte("x"), 64<<10)
+			for {
+				if _, err := w.Write(buf); err != nil {
+					werrc <- err
+					return
+				}
+			}
+		}()
+		select {
+		case err := <-errc:
+			if err == nil {
+				t.Fatal("stalled upload reported success")
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("stalled upload didn't fail")
+		}
+		select {
+		case <-werrc:
+		case <-time.After(10 * time.Second):
+			t.Fatal("writes to stalled upload still blocked")
+		}
+	})
 }
 
 func parseEnv(out []byte) map[string]string {
@@ -738,6 +1071,167 @@ func TestExpandPublicKeyURL(t *testing.T) {
 	}
 }
 
+func TestPrincipalMatchesCert(t *testing.T) {
+	newSigner := func() gossh.Signer {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := gossh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	ca, otherCA, user := newSigner(), newSigner(), newSigner()
+	now := time.Unix(1670000000, 0)
+	newCert := func(signer gossh.Signer, mod func(*gossh.Certificate)) *gossh.Certificate {
+		cert := &gossh.Certificate{
+			Key:             user.PublicKey(),
+			KeyId:           "alice@example.com",
+			CertType:        gossh.UserCert,
+			ValidPrincipals: []string{"alice"},
+			ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+			ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+		}
+		if mod != nil {
+			mod(cert)
+		}
+		if err := cert.SignCert(rand.Reader, signer); err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	caLine := string(bytes.TrimSpace(gossh.MarshalAuthorizedKey(ca.PublicKey())))
+
+	tests := []struct {
+		name string
+		key  gossh.PublicKey
+		want bool
+	}{
+		{"valid", newCert(ca, nil), true},
+		{"plain-key", user.PublicKey(), false},
+		{"unknown-ca", newCert(otherCA, nil), false},
+		{"expired", newCert(ca, func(c *gossh.Certificate) {
+			c.ValidBefore = uint64(now.Add(-time.Second).Unix())
+		}), false},
+		{"not-yet-valid", newCert(ca, func(c *gossh.Certificate) {
+			c.ValidAfter = uint64(now.Add(time.Minute).Unix())
+		}), false},
+		{"wrong-principal", newCert(ca, func(c *gossh.Certificate) {
+			c.ValidPrincipals = []string{"bob"}
+		}), false},
+		{"no-principals", newCert(ca, func(c *gossh.Certificate) {
+			c.ValidPrincipals = nil
+		}), false},
+		{"host-cert", newCert(ca, func(c *gossh.Certificate) {
+			c.CertType = gossh.HostCert
+		}), false},
+		{"unknown-critical-option", newCert(ca, func(c *gossh.Certificate) {
+			c.CriticalOptions = map[string]string{"verify-required": ""}
+		}), false},
+		{"source-address", newCert(ca, func(c *gossh.Certificate) {
+			c.CriticalOptions = map[string]string{"source-address": "10.0.0.1,100.64.0.0/10"}
+		}), true},
+		{"wrong-source-address", newCert(ca, func(c *gossh.Certificate) {
+			c.CriticalOptions = map[string]string{"source-address": "10.0.0.0/8"}
+		}), false},
+		{"force-command", newCert(ca, func(c *gossh.Certificate) {
+			c.CriticalOptions = map[string]string{"force-command": "uptime"}
+		}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &conn{
+				srv: &server{logf: t.Logf, timeNow: func() time.Time { return now }},
+				info: &sshConnInfo{
+					sshUser: "alice",
+					src:     netip.MustParseAddrPort("100.100.100.100:1234"),
+				},
+			}
+			p := &tailcfg.SSHPrincipal{Any: true, CertAuthorities: []string{caLine}}
+			got, err := c.principalMatchesPubKey(p, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertPermissions(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allExtensions := map[string]string{
+		certPermitPortForwarding:  "",
+		certPermitPTY:             "",
+		certPermitAgentForwarding: "",
+		certPermitX11Forwarding:   "",
+	}
+	allow := &tailcfg.SSHAction{
+		Accept:                    true,
+		AllowAgentForwarding:      true,
+		AllowLocalPortForwarding:  true,
+		AllowRemotePortForwarding: true,
+		AllowX11Forwarding:        true,
+	}
+	check := func(name string, c *conn, want bool) {
+		t.Helper()
+		got := map[string]bool{
+			"local-forward":  c.mayForwardLocalPortTo(nil, "localhost", 80),
+			"remote-forward": c.mayReversePortForwardTo(nil, "localhost", 8080),
+			"x11":            c.mayForwardX11(nil, ssh.X11{}),
+			"pty":            c.mayAllocatePTY(nil, ssh.Pty{}),
+			"agent":          c.mayForwardAgent(),
+		}
+		for what, ok := range got {
+			if ok != want {
+				t.Errorf("%s: %s = %v; want %v", name, what, ok, want)
+			}
+		}
+	}
+	newConn := func(pubKey gossh.PublicKey) *conn {
+		return &conn{
+			srv:         &server{lb: &localState{}, logf: t.Logf},
+			finalAction: allow,
+			localUser:   &user.User{Uid: "1000", Username: "alice"},
+			pubKey:      pubKey,
+		}
+	}
+
+	check("plain-key", newConn(signer.PublicKey()), true)
+	check("cert-with-extensions", newConn(&gossh.Certificate{
+		Key:         signer.PublicKey(),
+		CertType:    gossh.UserCert,
+		Permissions: gossh.Permissions{Extensions: allExtensions},
+	}), true)
+	check("cert-without-extensions", newConn(&gossh.Certificate{
+		Key:      signer.PublicKey(),
+		CertType: gossh.UserCert,
+	}), false)
+
+	// Each extension only permits its own feature.
+	c := newConn(&gossh.Certificate{
+		Key:         signer.PublicKey(),
+		CertType:    gossh.UserCert,
+		Permissions: gossh.Permissions{Extensions: map[string]string{certPermitPTY: ""}},
+	})
+	if !c.mayAllocatePTY(nil, ssh.Pty{}) {
+		t.Error("permit-pty: PTY denied")
+	}
+	if c.mayForwardAgent() || c.mayForwardX11(nil, ssh.X11{}) || c.mayForwardLocalPortTo(nil, "localhost", 80) {
+		t.Error("permit-pty: other features allowed")
+	}
+}
+
 func TestAcceptEnvPair(t *testing.T) {
 	tests := []struct {
 		in   string
@@ -757,6 +1251,29 @@ func TestAcceptEnvPair(t *testing.T) {
 	}
 }
 
+func TestAcceptEnvPairFromList(t *testing.T) {
+	names := []string{"EDITOR", "GIT_*"}
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"EDITOR=vi", true},
+		{"EDITORS=vi", false},
+		{"GIT_AUTHOR_NAME=x", true},
+		{"GIT=x", false},
+		{"TERM=x", false}, // not in the list
+		{"EDITOR", false},
+	}
+	for _, tt := range tests {
+		if got := acceptEnvPairFromList(tt.in, names); got != tt.want {
+			t.Errorf("for %q, got %v; want %v", tt.in, got, tt.want)
+		}
+	}
+	if !acceptEnvPairFromList("TERM=x", nil) {
+		t.Error("empty list doesn't accept the defaults")
+	}
+}
+
 func TestPathFromPAMEnvLine(t *testing.T) {
 	u := &user.User{Username: "foo", HomeDir: "/Homes/Foo"}
 	tests := []struct {
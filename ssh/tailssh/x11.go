@@ -0,0 +1,204 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || (darwin && !ios) || freebsd
+
+package tailssh
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	gossh "github.com/tailscale/golang-x-crypto/ssh"
+	"tailscale.com/tempfork/gliderlabs/ssh"
+	"tailscale.com/types/logger"
+)
+
+const (
+	// x11DisplayOffset is the first X11 display number tried for
+	// forwarding, leaving lower ones for local X servers. It's the same
+	// as OpenSSH's default X11DisplayOffset.
+	x11DisplayOffset = 10
+
+	// x11MaxDisplays is how many display numbers are tried.
+	x11MaxDisplays = 1000
+
+	// x11CookieEnv is the environment variable that passes the fake X11
+	// authorization cookie to the incubator, which adds it to the user's
+	// Xauthority file and removes it from the environment.
+	x11CookieEnv = "TS_SSH_X11_COOKIE"
+)
+
+// x11Forward is the state of a session's X11 forwarding.
+//
+// Like OpenSSH, X11 clients on this node are given a fake authorization
+// cookie. The forwarder checks each X11 connection presents it and
+// replaces it with the client's real cookie, which never leaves this
+// process.
+type x11Forward struct {
+	ln      net.Listener
+	display string // "localhost:10.0", for DISPLAY
+	xauth   string // "unix:10.0", for xauth
+	proto   string // authorization protocol, e.g. "MIT-MAGIC-COOKIE-1"
+	fake    []byte // cookie given to local X11 clients
+	real    []byte // cookie from the SSH client
+	single  bool   // forward only one connection
+}
+
+// handleX11Forwarding sets up X11 forwarding if the client requested it
+// and it's allowed. On success, it assigns ss.x11.
+func (ss *sshSession) handleX11Forwarding() error {
+	req, ok := ssh.X11Requested(ss)
+	if !ok || !ss.conn.finalAction.AllowX11Forwarding {
+		return nil
+	}
+	ss.logf("ssh: X11 forwarding requested")
+	x, err := newX11Forward(req)
+	if err != nil {
+		return err
+	}
+	sshConn := ss.Context().Value(ssh.ContextKeyConn).(gossh.Conn)
+	go x.forwardConnections(sshConn, ss.logf)
+	ss.x11 = x
+	return nil
+}
+
+// newX11Forward returns a new x11Forward for the X11 forwarding request
+// req, listening on the first free display number.
+func newX11Forward(req ssh.X11) (*x11Forward, error) {
+	real, err := hex.DecodeString(req.AuthCookie)
+	if err != nil || len(real) == 0 {
+		return nil, errors.New("invalid X11 authorization cookie")
+	}
+	x := &x11Forward{
+		proto:  req.AuthProtocol,
+		fake:   randBytes(len(real)),
+		real:   real,
+		single: req.SingleConnection,
+	}
+	for n := x11DisplayOffset; n < x11DisplayOffset+x11MaxDisplays; n++ {
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", 6000+n))
+		if err != nil {
+			continue
+		}
+		x.ln = ln
+		x.display = fmt.Sprintf("localhost:%d.%d", n, req.ScreenNumber)
+		x.xauth = fmt.Sprintf("unix:%d.%d", n, req.ScreenNumber)
+		return x, nil
+	}
+	return nil, errors.New("no free X11 display")
+}
+
+// fakeCookie returns the hex-encoded fake authorization cookie.
+func (x *x11Forward) fakeCookie() string {
+	return hex.EncodeToString(x.fake)
+}
+
+// Close stops accepting X11 connections.
+func (x *x11Forward) Close() error {
+	return x.ln.Close()
+}
+
+// forwardConnections accepts X11 connections until x is closed, and
+// forwards them to the SSH client over x11 channels on sshConn.
+func (x *x11Forward) forwardConnections(sshConn gossh.Conn, logf logger.Logf) {
+	for {
+		c, err := x.ln.Accept()
+		if err != nil {
+			return
+		}
+		if x.single {
+			x.ln.Close()
+		}
+		go func() {
+			if err := x.forward(sshConn, c); err != nil {
+				logf("X11 forwarding: %v", err)
+			}
+		}()
+	}
+}
+
+// forward forwards the X11 connection c to the SSH client.
+func (x *x11Forward) forward(sshConn gossh.Conn, c net.Conn) error {
+	defer c.Close()
+	setup, err := x.readSetup(c)
+	if err != nil {
+		return err
+	}
+	var origAddr string
+	var origPort uint32
+	if ta, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		origAddr, origPort = ta.IP.String(), uint32(ta.Port)
+	}
+	ch, reqs, err := sshConn.OpenChannel(ssh.X11ChannelType, gossh.Marshal(struct {
+		OriginatorAddress string
+		OriginatorPort    uint32
+	}{origAddr, origPort}))
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	go gossh.DiscardRequests(reqs)
+	if _, err := ch.Write(setup); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(c, ch)
+		if cw, ok := c.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(ch, c)
+		ch.CloseWrite()
+	}()
+	wg.Wait()
+	return nil
+}
+
+// readSetup reads the connection setup request that X11 clients start
+// with from r and returns it with the fake authorization cookie replaced
+// by the real one. It fails if the client didn't present the fake
+// cookie.
+func (x *x11Forward) readSetup(r io.Reader) ([]byte, error) {
+	// The request is a 12 byte header followed by the authorization
+	// protocol name and data, each padded to a multiple of 4 bytes.
+	hdr := make([]byte, 12)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	var bo binary.ByteOrder
+	switch hdr[0] {
+	case 'B':
+		bo = binary.BigEndian
+	case 'l':
+		bo = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("bad X11 byte order %q", hdr[0])
+	}
+	nameLen, dataLen := int(bo.Uint16(hdr[6:])), int(bo.Uint16(hdr[8:]))
+	pad4 := func(n int) int { return (n + 3) &^ 3 }
+	rest := make([]byte, pad4(nameLen)+pad4(dataLen))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	name := rest[:nameLen]
+	data := rest[pad4(nameLen) : pad4(nameLen)+dataLen]
+	if string(name) != x.proto || subtle.ConstantTimeCompare(data, x.fake) != 1 {
+		return nil, errors.New("X11 connection with wrong authorization")
+	}
+	copy(data, x.real)
+	return append(hdr, rest...), nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+
+package tailssh
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "github.com/tailscale/golang-x-crypto/ssh"
+	"tailscale.com/tempfork/gliderlabs/ssh"
+)
+
+// x11Setup returns an X11 connection setup request, in little-endian
+// byte order, with the given authorization.
+func x11Setup(proto string, cookie []byte) []byte {
+	b := []byte{'l', 0}
+	b = binary.LittleEndian.AppendUint16(b, 11) // protocol major version
+	b = binary.LittleEndian.AppendUint16(b, 0)  // minor version
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(proto)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(cookie)))
+	b = append(b, 0, 0)
+	pad := func(b []byte) []byte {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	b = pad(append(b, proto...))
+	return pad(append(b, cookie...))
+}
+
+// fakeSSHConn is a gossh.Conn that forwards the channels the server opens
+// by dialing the client's X server at xServer.
+type fakeSSHConn struct {
+	gossh.Conn
+	t       *testing.T
+	xServer string // unix socket
+}
+
+func (c *fakeSSHConn) OpenChannel(name string, data []byte) (gossh.Channel, <-chan *gossh.Request, error) {
+	if name != "x11" {
+		c.t.Errorf("OpenChannel(%q); want x11", name)
+	}
+	conn, err := net.Dial("unix", c.xServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqs := make(chan *gossh.Request)
+	close(reqs)
+	return fakeChannel{conn.(*net.UnixConn)}, reqs, nil
+}
+
+type fakeChannel struct {
+	*net.UnixConn
+}
+
+func (fakeChannel) SendRequest(string, bool, []byte) (bool, error) { return false, nil }
+func (fakeChannel) Stderr() io.ReadWriter                          { return nil }
+
+func TestX11Forwarding(t *testing.T) {
+	const proto = "MIT-MAGIC-COOKIE-1"
+	realCookie := []byte("0123456789abcdef")
+
+	// The client's fake X server checks it gets the real cookie and
+	// greets the X11 client.
+	xServer := filepath.Join(t.TempDir(), "X0")
+	xln, err := net.Listen("unix", xServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xln.Close()
+	go func() {
+		for {
+			c, err := xln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				want := x11Setup(proto, realCookie)
+				got := make([]byte, len(want))
+				if _, err := io.ReadFull(c, got); err != nil {
+					t.Errorf("X server read: %v", err)
+					return
+				}
+				if string(got) != string(want) {
+					t.Errorf("X server got setup %q; want %q", got, want)
+					return
+				}
+				io.WriteString(c, "welcome")
+			}()
+		}
+	}()
+
+	x, err := newX11Forward(ssh.X11{
+		AuthProtocol: proto,
+		AuthCookie:   hex.EncodeToString(realCookie),
+		ScreenNumber: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	if !strings.HasPrefix(x.display, "localhost:") || !strings.HasSuffix(x.display, ".0") {
+		t.Errorf("display = %q", x.display)
+	}
+	if x.fakeCookie() == hex.EncodeToString(realCookie) {
+		t.Fatal("fake cookie is the real cookie")
+	}
+	go x.forwardConnections(&fakeSSHConn{t: t, xServer: xServer}, t.Logf)
+
+	dialX := func(cookie []byte) string {
+		c, err := net.Dial("tcp", x.ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(10 * time.Second))
+		if _, err := c.Write(x11Setup(proto, cookie)); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(c)
+		return string(got)
+	}
+	if got := dialX(x.fake); got != "welcome" {
+		t.Errorf("with fake cookie, got %q; want welcome", got)
+	}
+	if got := dialX(realCookie); got != "" {
+		t.Errorf("with real cookie, got %q; want connection closed", got)
+	}
+}
@@ -4,7 +4,7 @@
 
 package tailcfg
 
-//go:generate go run tailscale.com/cmd/viewer --type=User,Node,Hostinfo,NetInfo,Login,DNSConfig,RegisterResponse,DERPRegion,DERPMap,DERPNode,SSHRule,SSHPrincipal,ControlDialPlan --clonefunc
+//go:generate go run tailscale.com/cmd/viewer --type=User,Node,Hostinfo,NetInfo,Login,DNSConfig,RegisterResponse,DERPRegion,DERPMap,DERPNode,SSHRule,SSHAction,SSHPrincipal,ControlDialPlan --clonefunc
 
 import (
 	"bytes"
@@ -88,7 +88,13 @@
 //   - 49: 2022-11-03: Client understands EarlyNoise
 //   - 50: 2022-11-14: Client understands CapabilityIngress
 //   - 51: 2022-11-30: Client understands CapabilityTailnetLockAlpha
-const CurrentCapabilityVersion CapabilityVersion = 51
+//   - 52: 2022-12-07: Client understands SSHAction.AllowRemotePortForwarding
+//   - 53: 2022-12-08: Client understands SSHAction.Recorders
+//   - 54: 2022-12-09: Client understands SSHAction.AllowX11Forwarding
+//   - 55: 2022-12-12: Client understands SSHPrincipal.NodeTag, UserID and PeerCap
+//   - 56: 2022-12-13: Client understands SSHAction session restrictions (ForceCommand, AcceptEnv, SetEnv, DenyPTY, MemoryLimit, CPULimitPercent)
+//   - 57: 2022-12-14: Client understands SSHPrincipal.CertAuthorities
+const CurrentCapabilityVersion CapabilityVersion = 57
 
 type StableID string
 
@@ -1847,15 +1853,27 @@ type SSHRule struct {
 
 // SSHPrincipal is either a particular node or a user on any node.
 type SSHPrincipal struct {
-	// Matching any one of the following four field causes a match.
-	// It must also match Certs, if non-empty.
+	// Matching any one of the following fields causes a match.
+	// It must also match PubKeys or CertAuthorities, if either is
+	// non-empty.
 
 	Node      StableNodeID `json:"node,omitempty"`
 	NodeIP    string       `json:"nodeIP,omitempty"`
 	UserLogin string       `json:"userLogin,omitempty"` // email-ish: foo@example.com, bar@github
 	Any       bool         `json:"any,omitempty"`       // if true, match any connection
+
+	// NodeTag, if non-empty, matches nodes with this ACL tag
+	// (e.g. "tag:prod").
+	NodeTag string `json:"nodeTag,omitempty"`
+
+	// UserID, if non-zero, matches the untagged nodes of this user.
+	UserID UserID `json:"userID,omitempty"`
 	// TODO(bradfitz): add StableUserID, once that exists
 
+	// PeerCap, if non-empty, matches nodes that the packet filter grants
+	// this capability to this node (see FilterRule.CapGrant).
+	PeerCap string `json:"peerCap,omitempty"`
+
 	// PubKeys, if non-empty, means that this SSHPrincipal only
 	// matches if one of these public keys is presented by the user.
 	//
@@ -1866,6 +1884,15 @@ type SSHPrincipal struct {
 	//   * $LOGINNAME_EMAIL ("foo@bar.com" or "foo@github")
 	//   * $LOGINNAME_LOCALPART (the "foo" from either of the above)
 	PubKeys []string `json:"pubKeys,omitempty"`
+
+	// CertAuthorities, if non-empty, are OpenSSH certificate authority
+	// public keys in authorized_keys format ("ssh-ed25519 AAAA...").
+	// The SSHPrincipal then also matches if the user presents a user
+	// certificate signed by one of them. The certificate must be
+	// currently valid and list the requested SSH username among its
+	// principals. Its only critical options may be "force-command"
+	// and "source-address", which are enforced.
+	CertAuthorities []string `json:"certAuthorities,omitempty"`
 }
 
 // SSHAction is how to handle an incoming connection.
@@ -1915,6 +1942,59 @@ type SSHAction struct {
 	// AllowLocalPortForwarding, if true, allows accepted connections
 	// to use local port forwarding if requested.
 	AllowLocalPortForwarding bool `json:"allowLocalPortForwarding,omitempty"`
+
+	// AllowRemotePortForwarding, if true, allows accepted connections
+	// to use remote port forwarding if requested, listening on this node
+	// and forwarding the connections back to the client. Listeners may
+	// only be bound to loopback addresses and the node's Tailscale IPs.
+	AllowRemotePortForwarding bool `json:"allowRemotePortForwarding,omitempty"`
+
+	// AllowX11Forwarding, if true, allows accepted connections to
+	// forward X11 connections to the client's X server if requested.
+	AllowX11Forwarding bool `json:"allowX11Forwarding,omitempty"`
+
+	// Recorders, if non-empty, are the addresses ("ip:port") of session
+	// recording servers on the tailnet. Accepted sessions are recorded in
+	// asciinema cast format and streamed by HTTP POST to the /record path
+	// of the first recorder that accepts a connection.
+	//
+	// Recording fails closed: if no recorder can be reached, the session
+	// is refused, and if the upload fails, the session is terminated.
+	Recorders []netip.AddrPort `json:"recorders,omitempty"`
+
+	// ForceCommand, if non-empty, is the command run for accepted
+	// sessions instead of the one requested or the user's shell, like
+	// OpenSSH's ForceCommand. It's run with the user's shell's -c
+	// flag, with the requested command, if any, in the
+	// SSH_ORIGINAL_COMMAND environment variable. SFTP is refused.
+	ForceCommand string `json:"forceCommand,omitempty"`
+
+	// AcceptEnv, if non-empty, are the names of the environment
+	// variables that clients may set, replacing the default of TERM,
+	// LANG and LC_*. A name ending in "*" matches any variable with
+	// that prefix.
+	AcceptEnv []string `json:"acceptEnv,omitempty"`
+
+	// SetEnv are environment variables to set for accepted sessions,
+	// overriding any the client sets.
+	SetEnv map[string]string `json:"setEnv,omitempty"`
+
+	// DenyPTY, if true, refuses clients' requests for a
+	// pseudo-terminal.
+	DenyPTY bool `json:"denyPTY,omitempty"`
+
+	// MemoryLimit, if non-zero, is the maximum number of bytes of
+	// memory that a session's processes may use together.
+	//
+	// Resource limits are only supported on Linux with cgroup v2;
+	// elsewhere, sessions with limits are refused. When a session with
+	// limits ends, any of its processes still running are killed.
+	MemoryLimit int64 `json:"memoryLimit,omitempty"`
+
+	// CPULimitPercent, if non-zero, is the maximum share of a CPU that a
+	// session's processes may use together, in percent of one CPU: 50
+	// is half a CPU, and 200 is two. See MemoryLimit for support.
+	CPULimitPercent int `json:"cpuLimitPercent,omitempty"`
 }
 
 // OverTLSPublicKeyResponse is the JSON response to /key?v=<n>
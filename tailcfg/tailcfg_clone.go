@@ -365,10 +365,7 @@ func (src *SSHRule) Clone() *SSHRule {
 			dst.SSHUsers[k] = v
 		}
 	}
-	if dst.Action != nil {
-		dst.Action = new(SSHAction)
-		*dst.Action = *src.Action
-	}
+	dst.Action = src.Action.Clone()
 	return dst
 }
 
@@ -380,6 +377,45 @@ func (src *SSHRule) Clone() *SSHRule {
 	Action      *SSHAction
 }{})
 
+// Clone makes a deep copy of SSHAction.
+// The result aliases no memory with the original.
+func (src *SSHAction) Clone() *SSHAction {
+	if src == nil {
+		return nil
+	}
+	dst := new(SSHAction)
+	*dst = *src
+	dst.Recorders = append(src.Recorders[:0:0], src.Recorders...)
+	dst.AcceptEnv = append(src.AcceptEnv[:0:0], src.AcceptEnv...)
+	if dst.SetEnv != nil {
+		dst.SetEnv = map[string]string{}
+		for k, v := range src.SetEnv {
+			dst.SetEnv[k] = v
+		}
+	}
+	return dst
+}
+
+// A compilation failure here means this code must be regenerated, with the command at the top of this file.
+var _SSHActionCloneNeedsRegeneration = SSHAction(struct {
+	Message                   string
+	Reject                    bool
+	Accept                    bool
+	SessionDuration           time.Duration
+	AllowAgentForwarding      bool
+	HoldAndDelegate           string
+	AllowLocalPortForwarding  bool
+	AllowRemotePortForwarding bool
+	AllowX11Forwarding        bool
+	Recorders                 []netip.AddrPort
+	ForceCommand              string
+	AcceptEnv                 []string
+	SetEnv                    map[string]string
+	DenyPTY                   bool
+	MemoryLimit               int64
+	CPULimitPercent           int
+}{})
+
 // Clone makes a deep copy of SSHPrincipal.
 // The result aliases no memory with the original.
 func (src *SSHPrincipal) Clone() *SSHPrincipal {
@@ -389,16 +425,21 @@ func (src *SSHPrincipal) Clone() *SSHPrincipal {
 	dst := new(SSHPrincipal)
 	*dst = *src
 	dst.PubKeys = append(src.PubKeys[:0:0], src.PubKeys...)
+	dst.CertAuthorities = append(src.CertAuthorities[:0:0], src.CertAuthorities...)
 	return dst
 }
 
 // A compilation failure here means this code must be regenerated, with the command at the top of this file.
 var _SSHPrincipalCloneNeedsRegeneration = SSHPrincipal(struct {
-	Node      StableNodeID
-	NodeIP    string
-	UserLogin string
-	Any       bool
-	PubKeys   []string
+	Node            StableNodeID
+	NodeIP          string
+	UserLogin       string
+	Any             bool
+	NodeTag         string
+	UserID          UserID
+	PeerCap         string
+	PubKeys         []string
+	CertAuthorities []string
 }{})
 
 // Clone makes a deep copy of ControlDialPlan.
@@ -420,7 +461,7 @@ func (src *ControlDialPlan) Clone() *ControlDialPlan {
 
 // Clone duplicates src into dst and reports whether it succeeded.
 // To succeed, <src, dst> must be of types <*T, *T> or <*T, **T>,
-// where T is one of User,Node,Hostinfo,NetInfo,Login,DNSConfig,RegisterResponse,DERPRegion,DERPMap,DERPNode,SSHRule,SSHPrincipal,ControlDialPlan.
+// where T is one of User,Node,Hostinfo,NetInfo,Login,DNSConfig,RegisterResponse,DERPRegion,DERPMap,DERPNode,SSHRule,SSHAction,SSHPrincipal,ControlDialPlan.
 func Clone(dst, src any) bool {
 	switch src := src.(type) {
 	case *User:
@@ -522,6 +563,15 @@ func Clone(dst, src any) bool {
 			*dst = src.Clone()
 			return true
 		}
+	case *SSHAction:
+		switch dst := dst.(type) {
+		case *SSHAction:
+			*dst = *src.Clone()
+			return true
+		case **SSHAction:
+			*dst = src.Clone()
+			return true
+		}
 	case *SSHPrincipal:
 		switch dst := dst.(type) {
 		case *SSHPrincipal:
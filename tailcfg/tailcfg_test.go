@@ -649,6 +649,33 @@ func TestEndpointTypeMarshal(t *testing.T) {
 	}
 }
 
+func TestSSHPrincipalJSON(t *testing.T) {
+	p := &SSHPrincipal{
+		NodeTag: "tag:prod",
+		UserID:  123,
+		PeerCap: "https://example.com/cap/ssh-admin",
+		PubKeys: []string{"ssh-ed25519 AAAA"},
+	}
+	j, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"nodeTag":"tag:prod","userID":123,"peerCap":"https://example.com/cap/ssh-admin","pubKeys":["ssh-ed25519 AAAA"]}`
+	if string(j) != want {
+		t.Errorf("got %s; want %s", j, want)
+	}
+	var back SSHPrincipal
+	if err := json.Unmarshal(j, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, p) {
+		t.Errorf("round trip = %+v; want %+v", back, p)
+	}
+	if got := p.View().AsStruct(); !reflect.DeepEqual(got, p) {
+		t.Errorf("View().AsStruct() = %+v; want %+v", got, p)
+	}
+}
+
 var sinkBytes []byte
 
 func BenchmarkKeyMarshalText(b *testing.B) {
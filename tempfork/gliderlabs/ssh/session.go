@@ -107,6 +107,7 @@ func DefaultSessionHandler(srv *Server, conn *gossh.ServerConn, newChan gossh.Ne
 		conn:              conn,
 		handler:           srv.Handler,
 		ptyCb:             srv.PtyCallback,
+		x11Cb:             srv.X11Callback,
 		sessReqCb:         srv.SessionRequestCallback,
 		subsystemHandlers: srv.SubsystemHandlers,
 		ctx:               ctx,
@@ -126,6 +127,7 @@ type session struct {
 	winch               chan Window
 	env                 []string
 	ptyCb               PtyCallback
+	x11Cb               X11Callback
 	sessReqCb           SessionRequestCallback
 	rawCmd              string
 	subsystem           string
@@ -365,6 +367,21 @@ func (sess *session) handleRequests(reqs <-chan *gossh.Request) {
 				sess.winch <- win
 			}
 			req.Reply(ok, nil)
+		case x11RequestType:
+			if sess.handled || sess.x11Cb == nil {
+				req.Reply(false, nil)
+				continue
+			}
+			var x11 X11
+			if err := gossh.Unmarshal(req.Payload, &x11); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			ok := sess.x11Cb(sess.ctx, x11)
+			if ok {
+				setX11Requested(sess.ctx, x11)
+			}
+			req.Reply(ok, nil)
 		case agentRequestType:
 			// TODO: option/callback to allow agent forwarding
 			SetAgentRequested(sess.ctx)
@@ -65,6 +65,9 @@
 // ReversePortForwardingCallback is a hook for allowing reverse port forwarding
 type ReversePortForwardingCallback func(ctx Context, bindHost string, bindPort uint32) bool
 
+// X11Callback is a hook for allowing X11 forwarding
+type X11Callback func(ctx Context, x11 X11) bool
+
 // ServerConfigCallback is a hook for creating custom default server configs
 type ServerConfigCallback func(ctx Context) *gossh.ServerConfig
 
@@ -93,6 +96,25 @@ type Window struct {
 	HeightPixels int
 }
 
+// X11 represents an X11 forwarding request.
+//
+// See https://datatracker.ietf.org/doc/html/rfc4254#section-6.3.1
+type X11 struct {
+	// SingleConnection is whether only one X11 connection should be
+	// forwarded.
+	SingleConnection bool
+
+	// AuthProtocol is the X11 authentication protocol, such as
+	// "MIT-MAGIC-COOKIE-1".
+	AuthProtocol string
+
+	// AuthCookie is the hex-encoded X11 authentication cookie.
+	AuthCookie string
+
+	// ScreenNumber is the X11 screen number.
+	ScreenNumber uint32
+}
+
 // Pty represents a PTY request and configuration.
 type Pty struct {
 	// Term is the TERM environment variable value.
@@ -0,0 +1,25 @@
+package ssh
+
+const (
+	x11RequestType = "x11-req"
+
+	// X11ChannelType is the type of the channels that X11 connections
+	// are forwarded over, from the server to the client.
+	X11ChannelType = "x11"
+)
+
+// contextKeyX11Request is an internal context key for storing the
+// client's X11 forwarding request
+var contextKeyX11Request = &contextKey{"x11-req"}
+
+func setX11Requested(ctx Context, x11 X11) {
+	ctx.SetValue(contextKeyX11Request, x11)
+}
+
+// X11Requested returns the client's X11 forwarding request and true if
+// the client requested X11 forwarding and the server's X11Callback
+// allowed it.
+func X11Requested(sess Session) (X11, bool) {
+	x11, ok := sess.Context().Value(contextKeyX11Request).(X11)
+	return x11, ok
+}
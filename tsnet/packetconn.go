@@ -0,0 +1,178 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsnet
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"tailscale.com/util/multierr"
+)
+
+// multiPacketConn is a net.PacketConn over several PacketConns bound to the
+// same port on different local addresses, as used by ListenPacket for an
+// address without a host. Packets received on any of them are returned by
+// ReadFrom, and WriteTo sends from the first one of the destination's
+// address family.
+type multiPacketConn struct {
+	pcs   []net.PacketConn
+	port  uint16
+	recvc chan received // from the read loops
+	done  chan struct{} // closed by Close
+
+	closeOnce sync.Once
+
+	mu              sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{} // closed and replaced when readDeadline changes
+}
+
+// received is a packet, or a read error, from one of a multiPacketConn's
+// PacketConns.
+type received struct {
+	b    []byte
+	from net.Addr
+	err  error
+}
+
+func newMultiPacketConn(pcs []net.PacketConn, port uint16) *multiPacketConn {
+	c := &multiPacketConn{
+		pcs:             pcs,
+		port:            port,
+		recvc:           make(chan received),
+		done:            make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+	for _, pc := range pcs {
+		go c.readLoop(pc)
+	}
+	return c
+}
+
+func (c *multiPacketConn) readLoop(pc net.PacketConn) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		r := received{from: from, err: err}
+		if err == nil {
+			r.b = append([]byte(nil), buf[:n]...)
+		}
+		select {
+		case c.recvc <- r:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *multiPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline, changed := c.readDeadline, c.deadlineChanged
+		c.mu.Unlock()
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		n, from, retry, err := c.readOrWait(p, timeout, changed)
+		if timer != nil {
+			timer.Stop()
+		}
+		if !retry {
+			return n, from, err
+		}
+	}
+}
+
+// readOrWait is ReadFrom's wait for a packet, Close, the read deadline
+// or the deadline changing, in which case it reports that ReadFrom should
+// retry.
+func (c *multiPacketConn) readOrWait(p []byte, timeout <-chan time.Time, changed <-chan struct{}) (n int, from net.Addr, retry bool, err error) {
+	select {
+	case r := <-c.recvc:
+		if r.err != nil {
+			return 0, nil, false, r.err
+		}
+		return copy(p, r.b), r.from, false, nil
+	case <-c.done:
+		return 0, nil, false, net.ErrClosed
+	case <-timeout:
+		return 0, nil, false, os.ErrDeadlineExceeded
+	case <-changed:
+		return 0, nil, true, nil
+	}
+}
+
+func (c *multiPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	ua, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, errors.New("tsnet: WriteTo requires a *net.UDPAddr")
+	}
+	ip, ok := netip.AddrFromSlice(ua.IP)
+	if !ok {
+		return 0, errors.New("tsnet: WriteTo: invalid IP")
+	}
+	ip = ip.Unmap()
+	for _, pc := range c.pcs {
+		if local, ok := pc.LocalAddr().(*net.UDPAddr); ok && (local.IP.To4() != nil) == ip.Is4() {
+			return pc.WriteTo(p, addr)
+		}
+	}
+	return 0, errors.New("tsnet: WriteTo: not listening on an address of the destination's family")
+}
+
+func (c *multiPacketConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	var errs []error
+	for _, pc := range c.pcs {
+		if err := pc.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return multierr.New(errs...)
+}
+
+func (c *multiPacketConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{Port: int(c.port)}
+}
+
+func (c *multiPacketConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *multiPacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	return nil
+}
+
+func (c *multiPacketConn) SetWriteDeadline(t time.Time) error {
+	for _, pc := range c.pcs {
+		if err := pc.SetWriteDeadline(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -9,6 +9,8 @@
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -19,6 +21,7 @@
 	"net/netip"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -26,9 +29,11 @@
 	"tailscale.com/client/tailscale"
 	"tailscale.com/control/controlclient"
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/ipn/localapi"
 	"tailscale.com/ipn/store"
 	"tailscale.com/ipn/store/mem"
@@ -39,6 +44,7 @@
 	"tailscale.com/net/tsdial"
 	"tailscale.com/smallzstd"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/util/mak"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/monitor"
@@ -48,6 +54,11 @@
 // Server is an embedded Tailscale server.
 //
 // Its exported fields may be changed until the first call to Listen.
+//
+// Multiple Servers may run in the same process, each as a separate node
+// with its own identity, as long as each uses a distinct Dir.
+// Each Server tracks its own health (including DNS configuration health)
+// and client metrics, and uploads its own logs.
 type Server struct {
 	// Dir specifies the name of the directory to use for
 	// state. If empty, a directory is selected automatically
@@ -90,6 +101,8 @@ type Server struct {
 
 	initOnce         sync.Once
 	initErr          error
+	health           *health.Tracker
+	clientMetrics    *clientmetric.Registry
 	lb               *ipnlocal.LocalBackend
 	netstack         *netstack.Impl
 	linkMon          *monitor.Mon
@@ -105,9 +118,12 @@ type Server struct {
 	mu        sync.Mutex
 	listeners map[listenKey]*listener
 	dialer    *tsdial.Dialer
+	certs     map[string]*tls.Certificate // cert domain => parsed cert, for ListenTLS
+	authURL   string                      // the last auth URL that Up returned in a NeedsLoginError
 }
 
 // Dial connects to the address on the tailnet.
+// The network may be any "tcp" or "udp" network type.
 // It will start the server if it has not been started yet.
 func (s *Server) Dial(ctx context.Context, network, address string) (net.Conn, error) {
 	if err := s.Start(); err != nil {
@@ -139,6 +155,124 @@ func (s *Server) LocalClient() (*tailscale.LocalClient, error) {
 	return s.localClient, nil
 }
 
+// NeedsLoginError is returned by Up when the node needs an interactive
+// login.
+type NeedsLoginError struct {
+	// AuthURL is the URL to visit to authenticate the node.
+	// It may be empty if Up's context was done before the control
+	// server provided one.
+	AuthURL string
+
+	// Err is the context's error if Up returned because its context was
+	// done, or else nil.
+	Err error
+}
+
+func (e *NeedsLoginError) Error() string {
+	msg := "tsnet: node needs login"
+	if e.AuthURL != "" {
+		msg += " at " + e.AuthURL
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *NeedsLoginError) Unwrap() error { return e.Err }
+
+// NeedsMachineAuthError is returned by Up when the node is logged in but
+// is waiting to be approved by a tailnet admin.
+type NeedsMachineAuthError struct{}
+
+func (*NeedsMachineAuthError) Error() string {
+	return "tsnet: node needs approval by a tailnet admin"
+}
+
+// BackendError is returned by Up when the backend reports a
+// user-visible error, such as an invalid or expired auth key.
+type BackendError struct {
+	Msg string
+}
+
+func (e *BackendError) Error() string { return "tsnet: backend error: " + e.Msg }
+
+// Up connects the server to the tailnet and waits until it is running,
+// returning the node's status, which includes its Tailscale IPs.
+// It will start the server if it has not been started yet.
+//
+// If the backend reports an error (such as an invalid auth key), Up returns
+// a *BackendError. If the node needs an interactive login, Up returns a
+// *NeedsLoginError containing the URL to visit as soon as the control server
+// provides it, and if the node needs approval by a tailnet admin, it
+// returns a *NeedsMachineAuthError. In both cases the login remains in
+// progress, and Up may be called again to wait for it to complete. Up
+// returns each auth URL only once: when called again, it waits for the
+// login to complete, or for a new auth URL, or for ctx to be done, in
+// which case it returns a *NeedsLoginError wrapping ctx's error.
+func (s *Server) Up(ctx context.Context) (*ipnstate.Status, error) {
+	lc, err := s.LocalClient() // calls Start
+	if err != nil {
+		return nil, fmt.Errorf("tsnet.Up: %w", err)
+	}
+	watcher, err := lc.WatchIPNBus(ctx, ipn.NotifyInitialState)
+	if err != nil {
+		return nil, fmt.Errorf("tsnet.Up: %w", err)
+	}
+	defer watcher.Close()
+
+	var (
+		state   ipn.State
+		authURL string
+	)
+	for {
+		n, err := watcher.Next()
+		if err != nil {
+			if ctx.Err() != nil && state == ipn.NeedsLogin {
+				return nil, &NeedsLoginError{AuthURL: authURL, Err: ctx.Err()}
+			}
+			return nil, fmt.Errorf("tsnet.Up: %w (backend state %v)", err, state)
+		}
+		if n.ErrMessage != nil {
+			return nil, &BackendError{Msg: *n.ErrMessage}
+		}
+		if n.BrowseToURL != nil && *n.BrowseToURL != "" {
+			authURL = *n.BrowseToURL
+		}
+		if n.State != nil {
+			state = *n.State
+		}
+		switch {
+		case state == ipn.NeedsLogin && authURL != "" && s.noteAuthURL(authURL):
+			return nil, &NeedsLoginError{AuthURL: authURL}
+		case state == ipn.NeedsMachineAuth:
+			return nil, &NeedsMachineAuthError{}
+		case state != ipn.Running || n.State == nil:
+			continue
+		}
+		st, err := lc.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tsnet.Up: %w", err)
+		}
+		if len(st.TailscaleIPs) == 0 {
+			return nil, errors.New("tsnet.Up: running, but no IP")
+		}
+		return st, nil
+	}
+}
+
+// noteAuthURL records that Up is returning authURL to the caller,
+// reporting whether it hasn't already.
+func (s *Server) noteAuthURL(authURL string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.authURL == authURL {
+		return false
+	}
+	s.authURL = authURL
+	return true
+}
+
 // Start connects the server to the tailnet.
 // Optional: any calls to Dial/Listen will also call Start.
 func (s *Server) Start() error {
@@ -189,6 +323,7 @@ func (s *Server) Close() error {
 	s.listeners = nil
 
 	wg.Wait()
+	s.releaseDir()
 	return nil
 }
 
@@ -249,6 +384,10 @@ func (s *Server) start() (reterr error) {
 	} else if !fi.IsDir() {
 		return fmt.Errorf("%v is not a directory", s.rootPath)
 	}
+	if err := s.claimDir(); err != nil {
+		return err
+	}
+	closePool.addFunc(s.releaseDir)
 
 	cfgPath := filepath.Join(s.rootPath, "tailscaled.log.conf")
 
@@ -272,6 +411,7 @@ func (s *Server) start() (reterr error) {
 		return fmt.Errorf("error creating filch: %w", err)
 	}
 	closePool.add(s.logbuffer)
+	s.clientMetrics = clientmetric.NewRegistry()
 	c := logtail.Config{
 		Collection: lpc.Collection,
 		PrivateID:  lpc.PrivateID,
@@ -284,7 +424,8 @@ func (s *Server) start() (reterr error) {
 			}
 			return w
 		},
-		HTTPC: &http.Client{Transport: logpolicy.NewLogtailTransport(logtail.DefaultHost)},
+		HTTPC:        &http.Client{Transport: logpolicy.NewLogtailTransport(logtail.DefaultHost)},
+		MetricsDelta: s.clientMetrics.EncodeLogTailMetricsDelta,
 	}
 	s.logtail = logtail.NewLogger(c, logf)
 	closePool.addFunc(func() { s.logtail.Shutdown(context.Background()) })
@@ -295,11 +436,14 @@ func (s *Server) start() (reterr error) {
 	}
 	closePool.add(s.linkMon)
 
+	s.health = health.NewTracker()
 	s.dialer = &tsdial.Dialer{Logf: logf} // mutated below (before used)
 	eng, err := wgengine.NewUserspaceEngine(logf, wgengine.Config{
-		ListenPort:  0,
-		LinkMonitor: s.linkMon,
-		Dialer:      s.dialer,
+		ListenPort:    0,
+		LinkMonitor:   s.linkMon,
+		Dialer:        s.dialer,
+		HealthTracker: s.health,
+		ClientMetrics: s.clientMetrics,
 	})
 	if err != nil {
 		return err
@@ -325,6 +469,9 @@ func (s *Server) start() (reterr error) {
 	s.dialer.NetstackDialTCP = func(ctx context.Context, dst netip.AddrPort) (net.Conn, error) {
 		return ns.DialContextTCP(ctx, dst)
 	}
+	s.dialer.NetstackDialUDP = func(ctx context.Context, dst netip.AddrPort) (net.Conn, error) {
+		return ns.DialContextUDP(ctx, dst)
+	}
 
 	if s.Store == nil {
 		stateFile := filepath.Join(s.rootPath, "tailscaled.state")
@@ -394,6 +541,40 @@ func (s *Server) start() (reterr error) {
 	return nil
 }
 
+var (
+	dirsMu    sync.Mutex
+	dirsInUse map[string]*Server // state directory => Server using it
+)
+
+// claimDir records that s uses s.rootPath as its state directory, returning
+// an error if another Server in this process is already using it.
+func (s *Server) claimDir() error {
+	dir, err := filepath.Abs(s.rootPath)
+	if err != nil {
+		return err
+	}
+	dirsMu.Lock()
+	defer dirsMu.Unlock()
+	if other, ok := dirsInUse[dir]; ok && other != s {
+		return fmt.Errorf("state directory %q is already in use by another tsnet.Server in this process; set a distinct Server.Dir", dir)
+	}
+	mak.Set(&dirsInUse, dir, s)
+	return nil
+}
+
+// releaseDir undoes claimDir.
+func (s *Server) releaseDir() {
+	dir, err := filepath.Abs(s.rootPath)
+	if err != nil {
+		return
+	}
+	dirsMu.Lock()
+	defer dirsMu.Unlock()
+	if dirsInUse[dir] == s {
+		delete(dirsInUse, dir)
+	}
+}
+
 type closeOnErrorPool []func()
 
 func (p *closeOnErrorPool) add(c io.Closer)   { *p = append(*p, func() { c.Close() }) }
@@ -554,6 +735,148 @@ func (s *Server) Listen(network, addr string) (net.Listener, error) {
 	return ln, nil
 }
 
+// ListenPacket announces UDP only on the Tailscale network.
+//
+// The network must be "udp", "udp4" or "udp6". The host portion of addr
+// must be either empty, to listen on all of the node's Tailscale IPs (of
+// the network's address family), or one of them (as reported by
+// LocalClient().Status); the packet conn is bound directly in netstack.
+// Unlike Listen, this requires the node's Tailscale IPs to be known, so
+// call Up first. The port must be numeric.
+// It will start the server if it has not been started yet.
+func (s *Server) ListenPacket(network, addr string) (net.PacketConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, errors.New("unsupported network type")
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("tsnet: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("tsnet: ListenPacket port must be numeric: %w", err)
+	}
+	var ips []netip.Addr
+	if host != "" {
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return nil, fmt.Errorf("tsnet: ListenPacket host must be empty or an IP: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	if host == "" {
+		for _, ip := range s.lb.StatusWithoutPeers().TailscaleIPs {
+			if network == "udp" || (network == "udp4") == ip.Is4() {
+				ips = append(ips, ip)
+			}
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("tsnet: ListenPacket(%q, %q): node has no Tailscale IPs yet", network, addr)
+		}
+	}
+
+	var pcs []net.PacketConn
+	for _, ip := range ips {
+		nw := "udp6"
+		if ip.Is4() {
+			nw = "udp4"
+		}
+		pc, err := s.netstack.ListenPacket(nw, netip.AddrPortFrom(ip, uint16(port)).String())
+		if err != nil {
+			for _, pc := range pcs {
+				pc.Close()
+			}
+			return nil, fmt.Errorf("tsnet: %w", err)
+		}
+		pcs = append(pcs, pc)
+	}
+	if len(pcs) == 1 {
+		return pcs[0], nil
+	}
+	return newMultiPacketConn(pcs, uint16(port)), nil
+}
+
+// ListenTLS announces only on the Tailscale network and returns a TLS
+// listener serving the node's certificate for its MagicDNS name
+// (see https://tailscale.com/kb/1153/enabling-https/).
+//
+// Certificates are obtained from Let's Encrypt on first use, cached in the
+// server's state directory and renewed in the background before they expire.
+// TLS handshakes for any SNI name other than one of the node's cert domains
+// are rejected, including MagicDNS short names, which the certificate
+// doesn't cover.
+//
+// It will start the server if it has not been started yet.
+func (s *Server) ListenTLS(network, addr string) (net.Listener, error) {
+	ln, err := s.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(ln, &tls.Config{
+		GetCertificate: s.getCert,
+	}), nil
+}
+
+// certRenewWindow is how long before a cached certificate's expiry
+// getCert goes back to LocalBackend.GetCertPEM, which kicks off an
+// asynchronous renewal. It matches the window used by ipnlocal.
+const certRenewWindow = 14 * 24 * time.Hour
+
+// getCert is the tls.Config.GetCertificate func used by ListenTLS.
+func (s *Server) getCert(hi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hi == nil || hi.ServerName == "" {
+		return nil, errors.New("no SNI ServerName")
+	}
+	domain, ok := certDomainForSNI(s.lb.StatusWithoutPeers().CertDomains, hi.ServerName)
+	if !ok {
+		return nil, fmt.Errorf("tsnet: no certificate for SNI name %q", hi.ServerName)
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	cert, ok := s.certs[domain]
+	s.mu.Unlock()
+	if ok && now.Before(cert.Leaf.NotAfter.Add(-certRenewWindow)) {
+		return cert, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	pair, err := s.lb.GetCertPEM(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	c, err := tls.X509KeyPair(pair.CertPEM, pair.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	c.Leaf, err = x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	mak.Set(&s.certs, domain, &c)
+	s.mu.Unlock()
+	return &c, nil
+}
+
+// certDomainForSNI returns the element of certDomains that the TLS SNI
+// name sni is, ignoring case.
+func certDomainForSNI(certDomains []string, sni string) (domain string, ok bool) {
+	sni = strings.ToLower(sni)
+	for _, d := range certDomains {
+		if d == sni {
+			return d, true
+		}
+	}
+	return "", false
+}
+
 type listenKey struct {
 	network string
 	host    string
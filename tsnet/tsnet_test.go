@@ -5,10 +5,34 @@
 package tsnet
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"tailscale.com/health"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store/mem"
+	"tailscale.com/logtail"
+	"tailscale.com/net/netns"
+	"tailscale.com/tstest/integration"
+	"tailscale.com/tstest/integration/testcontrol"
+	"tailscale.com/types/logger"
+	"tailscale.com/util/clientmetric"
 )
 
+var verboseNodes = flag.Bool("verbose-nodes", false, "if set, print tsnet.Server logs")
+
 // TestListener_Server ensures that the listener type always keeps the Server
 // method, which is used by some external applications to identify a tsnet.Listener
 // from other net.Listeners, as well as access the underlying Server.
@@ -45,3 +69,395 @@ func TestListenerPort(t *testing.T) {
 		}
 	}
 }
+
+func TestListenPacketAddr(t *testing.T) {
+	errNone := errors.New("sentinel start error")
+
+	tests := []struct {
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{"udp", "100.64.0.1:53", false},
+		{"udp4", "100.64.0.1:53", false},
+		{"udp6", "[fd7a:115c:a1e0::1]:53", false},
+		{"tcp", "100.64.0.1:53", true},
+		{"udp", ":53", false}, // all of the node's Tailscale IPs
+		{"udp6", ":53", false},
+		{"udp", "foo:53", true}, // IP or nothing required
+		{"udp", "100.64.0.1:domain", true},
+	}
+	for _, tt := range tests {
+		s := &Server{}
+		s.initOnce.Do(func() { s.initErr = errNone })
+		_, err := s.ListenPacket(tt.network, tt.addr)
+		gotErr := err != nil && err != errNone
+		if gotErr != tt.wantErr {
+			t.Errorf("ListenPacket(%q, %q) error = %v, want %v", tt.network, tt.addr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCertDomainForSNI(t *testing.T) {
+	certDomains := []string{"foo.tail-scale.ts.net", "bar.tail-scale.ts.net"}
+	tests := []struct {
+		sni    string
+		want   string
+		wantOK bool
+	}{
+		{"foo.tail-scale.ts.net", "foo.tail-scale.ts.net", true},
+		{"FOO.tail-scale.ts.net", "foo.tail-scale.ts.net", true},
+		{"bar", "", false}, // the cert doesn't cover short names
+		{"baz", "", false},
+		{"foo.example.com", "", false},
+		{"tail-scale.ts.net", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := certDomainForSNI(certDomains, tt.sni)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("certDomainForSNI(%q) = %q, %v; want %q, %v", tt.sni, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if _, ok := certDomainForSNI(nil, "foo"); ok {
+		t.Errorf("certDomainForSNI with no cert domains succeeded")
+	}
+}
+
+func startControl(t *testing.T) *testcontrol.Server {
+	// Corp#4520: don't use netns for tests.
+	netns.SetEnabled(false)
+	t.Cleanup(func() {
+		netns.SetEnabled(true)
+	})
+	// Don't upload test logs to log.tailscale.io.
+	logtail.Disable()
+
+	derpMap := integration.RunDERPAndSTUN(t, logger.Discard, "127.0.0.1")
+	control := &testcontrol.Server{
+		DERPMap: derpMap,
+	}
+	control.HTTPTestServer = httptest.NewUnstartedServer(control)
+	control.HTTPTestServer.Start()
+	t.Cleanup(control.HTTPTestServer.Close)
+	t.Logf("testcontrol listening on %s", control.BaseURL())
+	return control
+}
+
+// newServer returns a new, unstarted ephemeral tsnet.Server named hostname
+// that uses controlURL. It's closed when the test completes.
+func newServer(t *testing.T, controlURL, hostname string) *Server {
+	t.Helper()
+
+	tmp := filepath.Join(t.TempDir(), hostname)
+	os.MkdirAll(tmp, 0755)
+	s := &Server{
+		Dir:        tmp,
+		ControlURL: controlURL,
+		Hostname:   hostname,
+		Store:      new(mem.Store),
+		Ephemeral:  true,
+	}
+	if !*verboseNodes {
+		s.Logf = logger.Discard
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// startServer starts an ephemeral tsnet.Server named hostname against
+// controlURL and waits for it to be running, returning the server and
+// its Tailscale IPv4 address.
+func startServer(t *testing.T, ctx context.Context, controlURL, hostname string) (*Server, netip.Addr) {
+	t.Helper()
+
+	s := newServer(t, controlURL, hostname)
+	st, err := s.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, st.TailscaleIPs[0]
+}
+
+func TestUpNeedsLogin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	control := startControl(t)
+	control.RequireAuth = true
+	s := newServer(t, control.BaseURL(), "s1")
+
+	// Up returns as soon as the auth URL is known, without waiting for
+	// ctx to be done.
+	_, err := s.Up(ctx)
+	var nle *NeedsLoginError
+	if !errors.As(err, &nle) {
+		t.Fatalf("Up error = %v; want NeedsLoginError", err)
+	}
+	if nle.Err != nil {
+		t.Errorf("NeedsLoginError.Err = %v; want nil", nle.Err)
+	}
+	if nle.AuthURL == "" {
+		t.Fatal("NeedsLoginError has empty AuthURL")
+	}
+
+	// Called again, Up waits for the login rather than returning the
+	// same URL.
+	shortCtx, shortCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer shortCancel()
+	_, err = s.Up(shortCtx)
+	if !errors.As(err, &nle) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second Up error = %v; want NeedsLoginError wrapping DeadlineExceeded", err)
+	}
+	if !control.CompleteAuth(nle.AuthURL) {
+		t.Fatalf("CompleteAuth(%q) failed", nle.AuthURL)
+	}
+
+	st, err := s.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.BackendState != ipn.Running.String() {
+		t.Errorf("BackendState = %q; want %q", st.BackendState, ipn.Running)
+	}
+	if len(st.TailscaleIPs) == 0 {
+		t.Error("no Tailscale IPs")
+	}
+}
+
+func TestUDPConn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL := startControl(t).BaseURL()
+	s1, s1ip := startServer(t, ctx, controlURL, "s1")
+	s2, _ := startServer(t, ctx, controlURL, "s2")
+
+	pc, err := s1.ListenPacket("udp", netip.AddrPortFrom(s1ip, 8081).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go runUDPEcho(pc)
+
+	checkUDPEcho(t, ctx, s2, netip.AddrPortFrom(s1ip, 8081))
+}
+
+// runUDPEcho echoes the packets received on pc until it's closed.
+func runUDPEcho(pc net.PacketConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		pc.WriteTo(buf[:n], from)
+	}
+}
+
+// checkUDPEcho checks that a packet sent from s to the UDP echo server at
+// dst comes back.
+func checkUDPEcho(t *testing.T, ctx context.Context, s *Server, dst netip.AddrPort) {
+	t.Helper()
+	c, err := s.Dial(ctx, "udp", dst.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	want := []byte("hello over udp")
+	got := make([]byte, 1500)
+	// The first packets may be lost while the WireGuard handshake and
+	// path discovery complete, so retry until we hear back.
+	for {
+		if _, err := c.Write(want); err != nil {
+			t.Fatal(err)
+		}
+		c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, err := c.Read(got)
+		if err == nil {
+			got = got[:n]
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("timeout waiting for UDP echo from %v; last error: %v", dst, err)
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("from %v: got %q; want %q", dst, got, want)
+	}
+}
+
+func TestUDPConnAllAddrs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL := startControl(t).BaseURL()
+	s1, _ := startServer(t, ctx, controlURL, "s1")
+	s2, _ := startServer(t, ctx, controlURL, "s2")
+
+	pc, err := s1.ListenPacket("udp", ":8082")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go runUDPEcho(pc)
+
+	lc, err := s1.LocalClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := lc.StatusWithoutPeers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.TailscaleIPs) < 2 {
+		t.Fatalf("got Tailscale IPs %v; want IPv4 and IPv6", st.TailscaleIPs)
+	}
+	for _, ip := range st.TailscaleIPs {
+		checkUDPEcho(t, ctx, s2, netip.AddrPortFrom(ip, 8082))
+	}
+}
+
+func TestMultipleServers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	controlURL := startControl(t).BaseURL()
+
+	const numServers = 3
+	var (
+		servers []*Server
+		ips     []netip.Addr
+	)
+	for i := 0; i < numServers; i++ {
+		name := fmt.Sprintf("s%d", i)
+		s, ip := startServer(t, ctx, controlURL, name)
+		ln, err := s.Listen("tcp", ":8081")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				io.WriteString(c, "hello from "+name)
+				c.Close()
+			}
+		}()
+		servers = append(servers, s)
+		ips = append(ips, ip)
+	}
+
+	seen := map[*health.Tracker]bool{health.Global(): true}
+	for i, s := range servers {
+		ht := s.lb.HealthTracker()
+		if seen[ht] {
+			t.Errorf("server %d shares its health.Tracker with another node", i)
+		}
+		seen[ht] = true
+	}
+
+	seenMetrics := map[*clientmetric.Registry]bool{clientmetric.Global(): true}
+	for i, s := range servers {
+		reg := s.lb.ClientMetrics()
+		if seenMetrics[reg] {
+			t.Errorf("server %d shares its clientmetric.Registry with another node", i)
+		}
+		seenMetrics[reg] = true
+		if v := reg.Counter("controlclient_map_requests").Value(); v == 0 {
+			t.Errorf("server %d: controlclient_map_requests = 0; want its own map requests counted", i)
+		}
+	}
+	if clientmetric.HasPublished("controlclient_map_requests") {
+		t.Errorf("controlclient_map_requests published in the process-wide registry")
+	}
+
+	for i, s := range servers {
+		for j, ip := range ips {
+			if i == j {
+				continue
+			}
+			c, err := s.Dial(ctx, "tcp", netip.AddrPortFrom(ip, 8081).String())
+			if err != nil {
+				t.Fatalf("s%d dialing s%d: %v", i, j, err)
+			}
+			got, err := io.ReadAll(c)
+			c.Close()
+			if err != nil {
+				t.Fatalf("s%d reading from s%d: %v", i, j, err)
+			}
+			if want := fmt.Sprintf("hello from s%d", j); string(got) != want {
+				t.Errorf("s%d got %q from s%d; want %q", i, got, j, want)
+			}
+		}
+	}
+
+	// A Server reusing another's state directory must fail to start.
+	dup := &Server{
+		Dir:        servers[0].Dir,
+		ControlURL: controlURL,
+		Store:      new(mem.Store),
+		Ephemeral:  true,
+		Logf:       logger.Discard,
+	}
+	if err := dup.Start(); err == nil {
+		dup.Close()
+		t.Fatal("Start with a Dir already in use succeeded")
+	}
+}
+
+func TestWhoIsHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	controlURL := startControl(t).BaseURL()
+	s1, s1ip := startServer(t, ctx, controlURL, "s1")
+	s2, _ := startServer(t, ctx, controlURL, "s2")
+
+	ln, err := s1.Listen("tcp", ":80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	h := s1.WhoIsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		if !ok {
+			io.WriteString(w, "anonymous")
+			return
+		}
+		fmt.Fprintf(w, "%s %s", id.Node.Hostinfo.Hostname(), id.UserProfile.LoginName)
+	}), &WhoIsOptions{RejectTagged: true})
+	go http.Serve(ln, h)
+
+	res, err := s2.HTTPClient().Get("http://" + s1ip.String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// testcontrol creates a new user per node, in order.
+	const want = "s2 user-2@fake-control.example.net"
+	if res.StatusCode != http.StatusOK || string(got) != want {
+		t.Errorf("got %v %q; want 200 %q", res.Status, got, want)
+	}
+
+	// Callers that aren't tailnet peers have no identity.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	h.ServeHTTP(rec, req)
+	if got := rec.Body.String(); got != "anonymous" {
+		t.Errorf("non-peer request got %q; want %q", got, "anonymous")
+	}
+	rec = httptest.NewRecorder()
+	s1.WhoIsHandler(h, &WhoIsOptions{RejectUnknown: true}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("non-peer request with RejectUnknown got %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
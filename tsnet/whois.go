@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Tailscale Inc & AUTHORS All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tsnet
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+
+	"golang.org/x/exp/slices"
+	"tailscale.com/tailcfg"
+)
+
+// Identity is the tailnet identity of the peer that sent an HTTP request,
+// as resolved by the handler returned by Server.WhoIsHandler.
+type Identity struct {
+	// Node is the peer node that sent the request.
+	Node *tailcfg.Node
+
+	// UserProfile is the profile of the user that owns Node. For tagged
+	// nodes, it's the profile of the synthetic "tagged-devices" user.
+	UserProfile tailcfg.UserProfile
+
+	// Caps are the peer capabilities that the packet filter grants
+	// Node to this server, such as tailcfg.CapabilityFileSharingTarget.
+	Caps []string
+}
+
+// IsTagged reports whether the peer is a tagged node, rather than a node
+// owned by a user.
+func (id *Identity) IsTagged() bool {
+	return len(id.Node.Tags) > 0
+}
+
+// HasCap reports whether the peer has been granted the capability c.
+func (id *Identity) HasCap(c string) bool {
+	return slices.Contains(id.Caps, c)
+}
+
+type identityContextKey struct{}
+
+// IdentityFromContext returns the Identity of the peer that sent the HTTP
+// request whose context is ctx, as stored by Server.WhoIsHandler.
+//
+// It returns false if the handler couldn't identify the peer (only possible
+// if WhoIsOptions.RejectUnknown was false) or ctx isn't from such a request.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(*Identity)
+	return id, ok
+}
+
+// WhoIsOptions are options for Server.WhoIsHandler.
+type WhoIsOptions struct {
+	// RejectUnknown, if true, rejects requests with 403 Forbidden when
+	// the caller can't be identified as a tailnet peer.
+	RejectUnknown bool
+
+	// RejectTagged, if true, rejects requests with 403 Forbidden when
+	// the caller is a tagged node, so only user-owned nodes can access h.
+	RejectTagged bool
+}
+
+// WhoIsHandler returns an http.Handler that resolves the tailnet identity
+// of the caller of each request and makes it available to h via
+// IdentityFromContext.
+//
+// A nil opts is equivalent to a zero WhoIsOptions: unidentified callers
+// are passed through to h without an Identity.
+func (s *Server) WhoIsHandler(h http.Handler, opts *WhoIsOptions) http.Handler {
+	if opts == nil {
+		opts = new(WhoIsOptions)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := s.whoIs(r.RemoteAddr)
+		if !ok {
+			if opts.RejectUnknown {
+				http.Error(w, "unknown tailnet peer", http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		if opts.RejectTagged && id.IsTagged() {
+			http.Error(w, "tagged nodes are not permitted", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, id)))
+	})
+}
+
+// whoIs returns the Identity of the peer at remoteAddr, an "ip:port"
+// as found in http.Request.RemoteAddr.
+func (s *Server) whoIs(remoteAddr string) (*Identity, bool) {
+	if err := s.Start(); err != nil {
+		s.logf("tsnet: WhoIs: %v", err)
+		return nil, false
+	}
+	ipp, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return nil, false
+	}
+	n, up, ok := s.lb.WhoIs(ipp)
+	if !ok {
+		return nil, false
+	}
+	return &Identity{
+		Node:        n,
+		UserProfile: up,
+		Caps:        s.lb.PeerCaps(ipp.Addr()),
+	}, true
+}
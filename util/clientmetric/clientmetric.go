@@ -19,9 +19,16 @@
 	"time"
 )
 
-var (
-	mu          sync.Mutex // guards vars in this block
-	metrics     = map[string]*Metric{}
+// Registry is a set of published metrics that are logged and exported
+// together.
+//
+// Most programs have a single set of metrics per process and use the
+// package-level functions, which operate on the Registry returned by
+// Global. Programs running several Tailscale nodes in one process (such
+// as tsnet) create a Registry per node with NewRegistry.
+type Registry struct {
+	mu          sync.Mutex // guards fields below
+	metrics     map[string]*Metric
 	numWireID   int         // how many wireIDs have been allocated
 	lastDelta   time.Time   // time of last call to EncodeLogTailMetricsDelta
 	sortedDirty bool        // whether sorted needs to be rebuilt
@@ -35,7 +42,20 @@
 	// They're contiguous to reduce cache churn during diff scans.
 	// When out of length, a new backing array is made.
 	valFreeList []int64
-)
+}
+
+// NewRegistry returns a new Registry with no metrics.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]*Metric{}}
+}
+
+// global is the process-wide Registry used by the package-level
+// functions.
+var global = NewRegistry()
+
+// Global returns the process-wide Registry used by the package-level
+// functions.
+func Global() *Registry { return global }
 
 // scanEntry contains the minimal data needed for quickly scanning
 // memory for changed values. It's small to reduce memory pressure.
@@ -61,7 +81,8 @@ type Metric struct {
 	name   string
 	typ    Type
 
-	// The following fields are owned by the package-level 'mu':
+	// The following fields are owned by the mu of the Registry the
+	// Metric is published in:
 
 	// wireID is the lazily-allocated "wire ID". Until a metric is encoded
 	// in the logs (by EncodeLogTailMetricsDelta), it has no wireID. This
@@ -92,56 +113,73 @@ func (m *Metric) Set(v int64) {
 	atomic.StoreInt64(m.v, v)
 }
 
-// Publish registers a metric in the global map.
+// Publish registers a metric in the global Registry.
 // It panics if the name is a duplicate anywhere in the process.
-func (m *Metric) Publish() {
-	mu.Lock()
-	defer mu.Unlock()
+func (m *Metric) Publish() { global.Publish(m) }
+
+// Publish registers m in r.
+// It panics if the name is a duplicate in r.
+func (r *Registry) Publish(m *Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if m.name == "" {
 		panic("unnamed Metric")
 	}
-	if _, dup := metrics[m.name]; dup {
+	if _, dup := r.metrics[m.name]; dup {
 		panic("duplicate metric " + m.name)
 	}
-	metrics[m.name] = m
-	sortedDirty = true
+	r.publishLocked(m)
+}
+
+func (r *Registry) publishLocked(m *Metric) {
+	r.metrics[m.name] = m
+	r.sortedDirty = true
 
-	if len(valFreeList) == 0 {
-		valFreeList = make([]int64, 256)
+	if len(r.valFreeList) == 0 {
+		r.valFreeList = make([]int64, 256)
 	}
-	m.v = &valFreeList[0]
-	valFreeList = valFreeList[1:]
+	m.v = &r.valFreeList[0]
+	r.valFreeList = r.valFreeList[1:]
 
-	m.regIdx = len(unsorted)
-	unsorted = append(unsorted, m)
-	lastLogVal = append(lastLogVal, scanEntry{v: m.v})
+	m.regIdx = len(r.unsorted)
+	r.unsorted = append(r.unsorted, m)
+	r.lastLogVal = append(r.lastLogVal, scanEntry{v: m.v})
 }
 
-// Metrics returns the sorted list of metrics.
+// Metrics returns the sorted list of metrics in the global Registry.
+//
+// The returned slice should not be mutated.
+func Metrics() []*Metric { return global.Metrics() }
+
+// Metrics returns the sorted list of metrics in r.
 //
 // The returned slice should not be mutated.
-func Metrics() []*Metric {
-	mu.Lock()
-	defer mu.Unlock()
-	if sortedDirty {
-		sortedDirty = false
-		sorted = make([]*Metric, 0, len(metrics))
-		for _, m := range metrics {
-			sorted = append(sorted, m)
+func (r *Registry) Metrics() []*Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sortedDirty {
+		r.sortedDirty = false
+		r.sorted = make([]*Metric, 0, len(r.metrics))
+		for _, m := range r.metrics {
+			r.sorted = append(r.sorted, m)
 		}
-		sort.Slice(sorted, func(i, j int) bool {
-			return sorted[i].name < sorted[j].name
+		sort.Slice(r.sorted, func(i, j int) bool {
+			return r.sorted[i].name < r.sorted[j].name
 		})
 	}
-	return sorted
+	return r.sorted
 }
 
 // HasPublished reports whether a metric with the given name has already been
-// published.
-func HasPublished(name string) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	_, ok := metrics[name]
+// published in the global Registry.
+func HasPublished(name string) bool { return global.HasPublished(name) }
+
+// HasPublished reports whether a metric with the given name has already been
+// published in r.
+func (r *Registry) HasPublished(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.metrics[name]
 	return ok
 }
 
@@ -178,12 +216,49 @@ func NewGauge(name string) *Metric {
 	return m
 }
 
-// WritePrometheusExpositionFormat writes all client metrics to w in
-// the Prometheus text-based exposition format.
+// Counter returns the counter with the given name in r, publishing a new
+// one if there isn't one yet. Components that create their metrics per
+// instance use it so that instances sharing a Registry share metrics.
+//
+// It panics if r already has a gauge with that name.
+func (r *Registry) Counter(name string) *Metric {
+	return r.getOrPublish(name, TypeCounter)
+}
+
+// Gauge returns the gauge with the given name in r, publishing a new one
+// if there isn't one yet.
+//
+// It panics if r already has a counter with that name.
+func (r *Registry) Gauge(name string) *Metric {
+	return r.getOrPublish(name, TypeGauge)
+}
+
+func (r *Registry) getOrPublish(name string, typ Type) *Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.metrics[name]; ok {
+		if m.typ != typ {
+			panic("metric " + name + " published with a different type")
+		}
+		return m
+	}
+	m := NewUnpublished(name, typ)
+	r.publishLocked(m)
+	return m
+}
+
+// WritePrometheusExpositionFormat writes all client metrics in the global
+// Registry to w in the Prometheus text-based exposition format.
 //
 // See https://github.com/prometheus/docs/blob/main/content/docs/instrumenting/exposition_formats.md
 func WritePrometheusExpositionFormat(w io.Writer) {
-	for _, m := range Metrics() {
+	global.WritePrometheusExpositionFormat(w)
+}
+
+// WritePrometheusExpositionFormat writes all client metrics in r to w in
+// the Prometheus text-based exposition format.
+func (r *Registry) WritePrometheusExpositionFormat(w io.Writer) {
+	for _, m := range r.Metrics() {
 		switch m.Type() {
 		case TypeGauge:
 			fmt.Fprintf(w, "# TYPE %s gauge\n", m.Name())
@@ -208,8 +283,8 @@ func WritePrometheusExpositionFormat(w io.Writer) {
 	minMetricEncodeInterval = 15 * time.Second
 )
 
-// EncodeLogTailMetricsDelta return an encoded string representing the metrics
-// differences since the previous call.
+// EncodeLogTailMetricsDelta return an encoded string representing the
+// differences in the global Registry's metrics since the previous call.
 //
 // It implements the requirements of a logtail.Config.MetricsDelta
 // func. Notably, its output is safe to embed in a JSON string literal
@@ -222,32 +297,36 @@ func WritePrometheusExpositionFormat(w io.Writer) {
 //     'S' + hex(varint(wireid)) + hex(varint(value))
 //   - increment a metric: (decrements if negative)
 //     'I' + hex(varint(wireid)) + hex(varint(value))
-func EncodeLogTailMetricsDelta() string {
-	mu.Lock()
-	defer mu.Unlock()
+func EncodeLogTailMetricsDelta() string { return global.EncodeLogTailMetricsDelta() }
+
+// EncodeLogTailMetricsDelta is like the package-level
+// EncodeLogTailMetricsDelta, but for the metrics in r.
+func (r *Registry) EncodeLogTailMetricsDelta() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
 	now := time.Now()
-	if !lastDelta.IsZero() && now.Sub(lastDelta) < minMetricEncodeInterval {
+	if !r.lastDelta.IsZero() && now.Sub(r.lastDelta) < minMetricEncodeInterval {
 		return ""
 	}
-	lastDelta = now
+	r.lastDelta = now
 
 	var enc *deltaEncBuf // lazy
-	for i, ent := range lastLogVal {
+	for i, ent := range r.lastLogVal {
 		val := atomic.LoadInt64(ent.v)
 		delta := val - ent.lastLogged
 		if delta == 0 {
 			continue
 		}
-		lastLogVal[i].lastLogged = val
-		m := unsorted[i]
+		r.lastLogVal[i].lastLogged = val
+		m := r.unsorted[i]
 		if enc == nil {
 			enc = deltaPool.Get().(*deltaEncBuf)
 			enc.buf.Reset()
 		}
 		if m.wireID == 0 {
-			numWireID++
-			m.wireID = numWireID
+			r.numWireID++
+			m.wireID = r.numWireID
 		}
 		if m.lastNamed.IsZero() || now.Sub(m.lastNamed) > metricLogNameFrequency {
 			enc.writeName(m.Name(), m.Type())
@@ -326,5 +405,7 @@ func (b *deltaEncBuf) writeHexVarint(v int64) {
 type testHooks struct{}
 
 func (testHooks) ResetLastDelta() {
-	lastDelta = time.Time{}
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.lastDelta = time.Time{}
 }
@@ -29,20 +29,13 @@ func TestDeltaEncBuf(t *testing.T) {
 }
 
 func clearMetrics() {
-	mu.Lock()
-	defer mu.Unlock()
-	metrics = map[string]*Metric{}
-	numWireID = 0
-	lastDelta = time.Time{}
-	sorted = nil
-	lastLogVal = nil
-	unsorted = nil
+	global = NewRegistry()
 }
 
 func advanceTime() {
-	mu.Lock()
-	defer mu.Unlock()
-	lastDelta = time.Time{}
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.lastDelta = time.Time{}
 }
 
 func TestEncodeLogTailMetricsDelta(t *testing.T) {
@@ -73,3 +66,29 @@ func TestEncodeLogTailMetricsDelta(t *testing.T) {
 		t.Errorf("with increments = %q; want %q", got, want)
 	}
 }
+
+func TestRegistry(t *testing.T) {
+	r1 := NewRegistry()
+	r2 := NewRegistry()
+
+	c1 := r1.Counter("foo")
+	c1.Add(1)
+	if got := r1.Counter("foo"); got != c1 {
+		t.Errorf("second Counter call returned a different metric")
+	}
+	c2 := r2.Counter("foo")
+	c2.Add(2)
+	if got, want := c1.Value(), int64(1); got != want {
+		t.Errorf("r1 foo = %v; want %v", got, want)
+	}
+	if got, want := r2.EncodeLogTailMetricsDelta(), "N06fooS0204"; got != want {
+		t.Errorf("r2 delta = %q; want %q", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Gauge with a counter's name didn't panic")
+		}
+	}()
+	r1.Gauge("foo")
+}
@@ -257,6 +257,8 @@ type Conn struct {
 	testOnlyPacketListener nettype.PacketListener
 	noteRecvActivity       func(key.NodePublic) // or nil, see Options.NoteRecvActivity
 	linkMon                *monitor.Mon         // or nil
+	health                 *health.Tracker      // never nil
+	metrics                *metrics             // never nil
 
 	// ================================================================
 	// No locking required to access these fields, either because
@@ -548,6 +550,15 @@ type Options struct {
 	// LinkMonitor is the link monitor to use.
 	// With one, the portmapper won't be used.
 	LinkMonitor *monitor.Mon
+
+	// HealthTracker, if non-nil, is where the Conn reports its
+	// health. If nil, the process-wide health.Global is used.
+	HealthTracker *health.Tracker
+
+	// ClientMetrics, if non-nil, is where the Conn (including its
+	// portmapper and netcheck clients) records its client metrics.
+	// If nil, the process-wide clientmetric.Global is used.
+	ClientMetrics *clientmetric.Registry
 }
 
 func (o *Options) logf() logger.Logf {
@@ -580,6 +591,8 @@ func newConn() *Conn {
 		peerLastDerp: make(map[key.NodePublic]int),
 		peerMap:      newPeerMap(),
 		discoInfo:    make(map[key.DiscoPublic]*discoInfo),
+		health:       health.Global(),
+		metrics:      newMetrics(clientmetric.Global()),
 	}
 	c.bind = &connBind{Conn: c, closed: true}
 	c.receiveBatchPool = sync.Pool{New: func() any {
@@ -623,11 +636,20 @@ func NewConn(opts Options) (*Conn, error) {
 	c.idleFunc = opts.IdleFunc
 	c.testOnlyPacketListener = opts.TestOnlyPacketListener
 	c.noteRecvActivity = opts.NoteRecvActivity
+	clientMetrics := clientmetric.Global()
+	if opts.ClientMetrics != nil {
+		clientMetrics = opts.ClientMetrics
+		c.metrics = newMetrics(clientMetrics)
+	}
 	c.portMapper = portmapper.NewClient(logger.WithPrefix(c.logf, "portmapper: "), c.onPortMapChanged)
+	c.portMapper.SetClientMetrics(clientMetrics)
 	if opts.LinkMonitor != nil {
 		c.portMapper.SetGatewayLookupFunc(opts.LinkMonitor.GatewayAndSelfIP)
 	}
 	c.linkMon = opts.LinkMonitor
+	if opts.HealthTracker != nil {
+		c.health = opts.HealthTracker
+	}
 
 	if err := c.rebind(keepCurrentPort); err != nil {
 		return nil, err
@@ -641,6 +663,7 @@ func NewConn(opts Options) (*Conn, error) {
 		GetSTUNConn6:        func() netcheck.STUNConn { return &c.pconn6 },
 		SkipExternalNetwork: inTest(),
 		PortMapper:          c.portMapper,
+		ClientMetrics:       clientMetrics,
 	}
 
 	c.ignoreSTUNPackets()
@@ -679,7 +702,7 @@ func (c *Conn) stopPeriodicReSTUNTimerLocked() {
 
 // c.mu must NOT be held.
 func (c *Conn) updateEndpoints(why string) {
-	metricUpdateEndpoints.Add(1)
+	c.metrics.updateEndpoints.Add(1)
 	defer func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
@@ -1035,7 +1058,7 @@ func (c *Conn) setNearestDERP(derpNum int) (wantDERP bool) {
 	defer c.mu.Unlock()
 	if !c.wantDerpLocked() {
 		c.myDerp = 0
-		health.SetMagicSockDERPHome(0)
+		c.health.SetMagicSockDERPHome(0)
 		return false
 	}
 	if derpNum == c.myDerp {
@@ -1043,10 +1066,10 @@ func (c *Conn) setNearestDERP(derpNum int) (wantDERP bool) {
 		return true
 	}
 	if c.myDerp != 0 && derpNum != 0 {
-		metricDERPHomeChange.Add(1)
+		c.metrics.derpHomeChange.Add(1)
 	}
 	c.myDerp = derpNum
-	health.SetMagicSockDERPHome(derpNum)
+	c.health.SetMagicSockDERPHome(derpNum)
 
 	if c.privateKey.IsZero() {
 		// No private key yet, so DERP connections won't come up anyway.
@@ -1247,9 +1270,9 @@ func (c *Conn) networkDown() bool { return !c.networkUp.Load() }
 
 func (c *Conn) Send(buffs [][]byte, ep conn.Endpoint) error {
 	n := int64(len(buffs))
-	metricSendData.Add(n)
+	c.metrics.sendData.Add(n)
 	if c.networkDown() {
-		metricSendDataNetworkDown.Add(n)
+		c.metrics.sendDataNetworkDown.Add(n)
 		return errNetworkDown
 	}
 	return ep.(*endpoint).send(buffs)
@@ -1309,10 +1332,10 @@ func (c *Conn) sendUDP(ipp netip.AddrPort, b []byte) (sent bool, err error) {
 	}
 	sent, err = c.sendUDPStd(ipp, b)
 	if err != nil {
-		metricSendUDPError.Add(1)
+		c.metrics.sendUDPError.Add(1)
 	} else {
 		if sent {
-			metricSendUDP.Add(1)
+			c.metrics.sendUDP.Add(1)
 		}
 	}
 	return
@@ -1355,7 +1378,7 @@ func (c *Conn) sendAddr(addr netip.AddrPort, pubKey key.NodePublic, b []byte) (s
 
 	ch := c.derpWriteChanOfAddr(addr, pubKey)
 	if ch == nil {
-		metricSendDERPErrorChan.Add(1)
+		c.metrics.sendDERPErrorChan.Add(1)
 		return false, nil
 	}
 
@@ -1369,13 +1392,13 @@ func (c *Conn) sendAddr(addr netip.AddrPort, pubKey key.NodePublic, b []byte) (s
 
 	select {
 	case <-c.donec:
-		metricSendDERPErrorClosed.Add(1)
+		c.metrics.sendDERPErrorClosed.Add(1)
 		return false, errConnClosed
 	case ch <- derpWriteRequest{addr, pubKey, pkt}:
-		metricSendDERPQueued.Add(1)
+		c.metrics.sendDERPQueued.Add(1)
 		return true, nil
 	default:
-		metricSendDERPErrorQueue.Add(1)
+		c.metrics.sendDERPErrorQueue.Add(1)
 		// Too many writes queued. Drop packet.
 		return false, errDropDerpPacket
 	}
@@ -1492,7 +1515,7 @@ func (c *Conn) derpWriteChanOfAddr(addr netip.AddrPort, peer key.NodePublic) cha
 	*ad.lastWrite = time.Now()
 	ad.createTime = time.Now()
 	c.activeDerp[regionID] = ad
-	metricNumDERPConns.Set(int64(len(c.activeDerp)))
+	c.metrics.numDERPConns.Set(int64(len(c.activeDerp)))
 	c.logActiveDerpLocked()
 	c.setPeerLastDerpLocked(peer, regionID, regionID)
 	c.scheduleCleanStaleDerpLocked()
@@ -1601,8 +1624,8 @@ func (c *Conn) runDerpReader(ctx context.Context, derpFakeAddr netip.AddrPort, d
 		return n
 	}
 
-	defer health.SetDERPRegionConnectedState(regionID, false)
-	defer health.SetDERPRegionHealth(regionID, "")
+	defer c.health.SetDERPRegionConnectedState(regionID, false)
+	defer c.health.SetDERPRegionHealth(regionID, "")
 
 	// peerPresent is the set of senders we know are present on this
 	// connection, based on messages we've received from the server.
@@ -1614,7 +1637,7 @@ func (c *Conn) runDerpReader(ctx context.Context, derpFakeAddr netip.AddrPort, d
 	for {
 		msg, connGen, err := dc.RecvDetail()
 		if err != nil {
-			health.SetDERPRegionConnectedState(regionID, false)
+			c.health.SetDERPRegionConnectedState(regionID, false)
 			// Forget that all these peers have routes.
 			for peer := range peerPresent {
 				delete(peerPresent, peer)
@@ -1652,14 +1675,14 @@ func (c *Conn) runDerpReader(ctx context.Context, derpFakeAddr netip.AddrPort, d
 
 		now := time.Now()
 		if lastPacketTime.IsZero() || now.Sub(lastPacketTime) > 5*time.Second {
-			health.NoteDERPRegionReceivedFrame(regionID)
+			c.health.NoteDERPRegionReceivedFrame(regionID)
 			lastPacketTime = now
 		}
 
 		switch m := msg.(type) {
 		case derp.ServerInfoMessage:
-			health.SetDERPRegionConnectedState(regionID, true)
-			health.SetDERPRegionHealth(regionID, "") // until declared otherwise
+			c.health.SetDERPRegionConnectedState(regionID, true)
+			c.health.SetDERPRegionHealth(regionID, "") // until declared otherwise
 			c.logf("magicsock: derp-%d connected; connGen=%v", regionID, connGen)
 			continue
 		case derp.ReceivedPacket:
@@ -1688,7 +1711,15 @@ func (c *Conn) runDerpReader(ctx context.Context, derpFakeAddr netip.AddrPort, d
 			}()
 			continue
 		case derp.HealthMessage:
-			health.SetDERPRegionHealth(regionID, m.Problem)
+			// The server reports problems with our connection,
+			// such as our node key being in use by another
+			// device. Surface them via the health package (and
+			// thus "tailscale status").
+			if m.Problem != "" {
+				c.logf("magicsock: derp-%d health problem: %s", regionID, m.Problem)
+			}
+			c.health.SetDERPRegionHealth(regionID, m.Problem)
+			continue
 		case derp.PeerGoneMessage:
 			c.removeDerpPeerRoute(key.NodePublic(m), regionID, dc)
 		default:
@@ -1735,9 +1766,9 @@ func (c *Conn) runDerpWriter(ctx context.Context, dc *derphttp.Client, ch <-chan
 			err := dc.Send(wr.pubKey, wr.b)
 			if err != nil {
 				c.logf("magicsock: derp.Send(%v): %v", wr.addr, err)
-				metricSendDERPError.Add(1)
+				c.metrics.sendDERPError.Add(1)
 			} else {
-				metricSendDERP.Add(1)
+				c.metrics.sendDERP.Add(1)
 			}
 		}
 	}
@@ -1760,8 +1791,8 @@ func (c *Conn) putReceiveBatch(batch *receiveBatch) {
 }
 
 func (c *Conn) receiveIPv6(buffs [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
-	health.ReceiveIPv6.Enter()
-	defer health.ReceiveIPv6.Exit()
+	c.health.ReceiveIPv6.Enter()
+	defer c.health.ReceiveIPv6.Exit()
 
 	batch := c.getReceiveBatch()
 	defer c.putReceiveBatch(batch)
@@ -1782,7 +1813,7 @@ func (c *Conn) receiveIPv6(buffs [][]byte, sizes []int, eps []conn.Endpoint) (in
 		for i, msg := range batch.msgs[:numMsgs] {
 			ipp := msg.Addr.(*net.UDPAddr).AddrPort()
 			if ep, ok := c.receiveIP(msg.Buffers[0][:msg.N], ipp, &c.ippEndpoint6, c.closeDisco6 == nil); ok {
-				metricRecvDataIPv6.Add(1)
+				c.metrics.recvDataIPv6.Add(1)
 				eps[i] = ep
 				sizes[i] = msg.N
 				reportToCaller = true
@@ -1798,8 +1829,8 @@ func (c *Conn) receiveIPv6(buffs [][]byte, sizes []int, eps []conn.Endpoint) (in
 }
 
 func (c *Conn) receiveIPv4(buffs [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
-	health.ReceiveIPv4.Enter()
-	defer health.ReceiveIPv4.Exit()
+	c.health.ReceiveIPv4.Enter()
+	defer c.health.ReceiveIPv4.Exit()
 
 	batch := c.getReceiveBatch()
 	defer c.putReceiveBatch(batch)
@@ -1820,7 +1851,7 @@ func (c *Conn) receiveIPv4(buffs [][]byte, sizes []int, eps []conn.Endpoint) (in
 		for i, msg := range batch.msgs[:numMsgs] {
 			ipp := msg.Addr.(*net.UDPAddr).AddrPort()
 			if ep, ok := c.receiveIP(msg.Buffers[0][:msg.N], ipp, &c.ippEndpoint4, c.closeDisco4 == nil); ok {
-				metricRecvDataIPv4.Add(1)
+				c.metrics.recvDataIPv4.Add(1)
 				eps[i] = ep
 				sizes[i] = msg.N
 				reportToCaller = true
@@ -1880,8 +1911,8 @@ func (c *Conn) receiveIP(b []byte, ipp netip.AddrPort, cache *ippEndpointCache,
 }
 
 func (c *connBind) receiveDERP(buffs [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
-	health.ReceiveDERP.Enter()
-	defer health.ReceiveDERP.Exit()
+	c.health.ReceiveDERP.Enter()
+	defer c.health.ReceiveDERP.Exit()
 
 	for dm := range c.derpRecvCh {
 		if c.Closed() {
@@ -1892,7 +1923,7 @@ func (c *connBind) receiveDERP(buffs [][]byte, sizes []int, eps []conn.Endpoint)
 			// No data read occurred. Wait for another packet.
 			continue
 		}
-		metricRecvDataDERP.Add(1)
+		c.metrics.recvDataDERP.Add(1)
 		sizes[0] = n
 		eps[0] = ep
 		return 1, nil
@@ -1981,9 +2012,9 @@ func (c *Conn) sendDiscoMessage(dst netip.AddrPort, dstKey key.NodePublic, dstDi
 	c.mu.Unlock()
 
 	if isDERP {
-		metricSendDiscoDERP.Add(1)
+		c.metrics.sendDiscoDERP.Add(1)
 	} else {
-		metricSendDiscoUDP.Add(1)
+		c.metrics.sendDiscoUDP.Add(1)
 	}
 
 	box := di.sharedKey.Seal(m.AppendMarshal(nil))
@@ -1998,17 +2029,17 @@ func (c *Conn) sendDiscoMessage(dst netip.AddrPort, dstKey key.NodePublic, dstDi
 			c.dlogf("[v1] magicsock: disco: %v->%v (%v, %v) sent %v", c.discoShort, dstDisco.ShortString(), node, derpStr(dst.String()), disco.MessageSummary(m))
 		}
 		if isDERP {
-			metricSentDiscoDERP.Add(1)
+			c.metrics.sentDiscoDERP.Add(1)
 		} else {
-			metricSentDiscoUDP.Add(1)
+			c.metrics.sentDiscoUDP.Add(1)
 		}
 		switch m.(type) {
 		case *disco.Ping:
-			metricSentDiscoPing.Add(1)
+			c.metrics.sentDiscoPing.Add(1)
 		case *disco.Pong:
-			metricSentDiscoPong.Add(1)
+			c.metrics.sentDiscoPong.Add(1)
 		case *disco.CallMeMaybe:
-			metricSentDiscoCallMeMaybe.Add(1)
+			c.metrics.sentDiscoCallMeMaybe.Add(1)
 		}
 	} else if err == nil {
 		// Can't send. (e.g. no IPv6 locally)
@@ -2070,7 +2101,7 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 	}
 
 	if !c.peerMap.anyEndpointForDiscoKey(sender) {
-		metricRecvDiscoBadPeer.Add(1)
+		c.metrics.recvDiscoBadPeer.Add(1)
 		if debugDisco() {
 			c.logf("magicsock: disco: ignoring disco-looking frame, don't know endpoint for %v", sender.ShortString())
 		}
@@ -2098,7 +2129,7 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 		if debugDisco() {
 			c.logf("magicsock: disco: failed to open naclbox from %v (wrong rcpt?)", sender)
 		}
-		metricRecvDiscoBadKey.Add(1)
+		c.metrics.recvDiscoBadKey.Add(1)
 		return
 	}
 
@@ -2112,23 +2143,23 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 		// newer version of Tailscale that we don't
 		// understand. Not even worth logging about, lest it
 		// be too spammy for old clients.
-		metricRecvDiscoBadParse.Add(1)
+		c.metrics.recvDiscoBadParse.Add(1)
 		return
 	}
 
 	isDERP := src.Addr() == derpMagicIPAddr
 	if isDERP {
-		metricRecvDiscoDERP.Add(1)
+		c.metrics.recvDiscoDERP.Add(1)
 	} else {
-		metricRecvDiscoUDP.Add(1)
+		c.metrics.recvDiscoUDP.Add(1)
 	}
 
 	switch dm := dm.(type) {
 	case *disco.Ping:
-		metricRecvDiscoPing.Add(1)
+		c.metrics.recvDiscoPing.Add(1)
 		c.handlePingLocked(dm, src, di, derpNodeSrc)
 	case *disco.Pong:
-		metricRecvDiscoPong.Add(1)
+		c.metrics.recvDiscoPong.Add(1)
 		// There might be multiple nodes for the sender's DiscoKey.
 		// Ask each to handle it, stopping once one reports that
 		// the Pong's TxID was theirs.
@@ -2139,7 +2170,7 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 			}
 		})
 	case *disco.CallMeMaybe:
-		metricRecvDiscoCallMeMaybe.Add(1)
+		c.metrics.recvDiscoCallMeMaybe.Add(1)
 		if !isDERP || derpNodeSrc.IsZero() {
 			// CallMeMaybe messages should only come via DERP.
 			c.logf("[unexpected] CallMeMaybe packets should only come via DERP")
@@ -2148,12 +2179,12 @@ func (c *Conn) handleDiscoMessage(msg []byte, src netip.AddrPort, derpNodeSrc ke
 		nodeKey := derpNodeSrc
 		ep, ok := c.peerMap.endpointForNodeKey(nodeKey)
 		if !ok {
-			metricRecvDiscoCallMeMaybeBadNode.Add(1)
+			c.metrics.recvDiscoCallMeMaybeBadNode.Add(1)
 			c.logf("magicsock: disco: ignoring CallMeMaybe from %v; %v is unknown", sender.ShortString(), derpNodeSrc.ShortString())
 			return
 		}
 		if ep.discoKey != di.discoKey {
-			metricRecvDiscoCallMeMaybeBadDisco.Add(1)
+			c.metrics.recvDiscoCallMeMaybeBadDisco.Add(1)
 			c.logf("[unexpected] CallMeMaybe from peer via DERP whose netmap discokey != disco source")
 			return
 		}
@@ -2502,7 +2533,7 @@ func (c *Conn) SetNetworkMap(nm *netmap.NetworkMap) {
 		return
 	}
 
-	metricNumPeers.Set(int64(len(nm.Peers)))
+	c.metrics.numPeers.Set(int64(len(nm.Peers)))
 
 	c.logf("[v1] magicsock: got updated network map; %d peers", len(nm.Peers))
 	c.netMap = nm
@@ -2668,7 +2699,7 @@ func (c *Conn) closeDerpLocked(regionID int, why string) {
 		go ad.c.Close()
 		ad.cancel()
 		delete(c.activeDerp, regionID)
-		metricNumDERPConns.Set(int64(len(c.activeDerp)))
+		c.metrics.numDERPConns.Set(int64(len(c.activeDerp)))
 	}
 }
 
@@ -2953,7 +2984,7 @@ func (c *Conn) ReSTUN(why string) {
 		// raced with a shutdown.
 		return
 	}
-	metricReSTUNCalls.Add(1)
+	c.metrics.reSTUNCalls.Add(1)
 
 	// If the user stopped the app, stop doing work. (When the
 	// user stops Tailscale via the GUI apps, ipn/local.go
@@ -3048,7 +3079,7 @@ func (c *Conn) bindSocket(ruc *RebindingUDPConn, network string, curPortFate cur
 		// Success.
 		ruc.setConnLocked(pconn, network)
 		if network == "udp4" {
-			health.SetUDP4Unbound(false)
+			c.health.SetUDP4Unbound(false)
 		}
 		return nil
 	}
@@ -3059,7 +3090,7 @@ func (c *Conn) bindSocket(ruc *RebindingUDPConn, network string, curPortFate cur
 	// we get a link change and we can try binding again.
 	ruc.setConnLocked(newBlockForeverConn(), "")
 	if network == "udp4" {
-		health.SetUDP4Unbound(true)
+		c.health.SetUDP4Unbound(true)
 	}
 	return fmt.Errorf("failed to bind any ports (tried %v)", ports)
 }
@@ -3087,7 +3118,7 @@ func (c *Conn) rebind(curPortFate currentPortFate) error {
 // Rebind closes and re-binds the UDP sockets and resets the DERP connection.
 // It should be followed by a call to ReSTUN.
 func (c *Conn) Rebind() {
-	metricRebindCalls.Add(1)
+	c.metrics.rebindCalls.Add(1)
 	if err := c.rebind(keepCurrentPort); err != nil {
 		c.logf("%w", err)
 		return
@@ -4529,56 +4560,100 @@ func (s derpAddrFamSelector) PreferIPv6() bool {
 	return false
 }
 
-var (
-	metricNumPeers     = clientmetric.NewGauge("magicsock_netmap_num_peers")
-	metricNumDERPConns = clientmetric.NewGauge("magicsock_num_derp_conns")
+// metrics are a Conn's client metrics.
+type metrics struct {
+	numPeers     *clientmetric.Metric
+	numDERPConns *clientmetric.Metric
 
-	metricRebindCalls     = clientmetric.NewCounter("magicsock_rebind_calls")
-	metricReSTUNCalls     = clientmetric.NewCounter("magicsock_restun_calls")
-	metricUpdateEndpoints = clientmetric.NewCounter("magicsock_update_endpoints")
+	rebindCalls     *clientmetric.Metric
+	reSTUNCalls     *clientmetric.Metric
+	updateEndpoints *clientmetric.Metric
 
 	// Sends (data or disco)
-	metricSendDERPQueued      = clientmetric.NewCounter("magicsock_send_derp_queued")
-	metricSendDERPErrorChan   = clientmetric.NewCounter("magicsock_send_derp_error_chan")
-	metricSendDERPErrorClosed = clientmetric.NewCounter("magicsock_send_derp_error_closed")
-	metricSendDERPErrorQueue  = clientmetric.NewCounter("magicsock_send_derp_error_queue")
-	metricSendUDP             = clientmetric.NewCounter("magicsock_send_udp")
-	metricSendUDPError        = clientmetric.NewCounter("magicsock_send_udp_error")
-	metricSendDERP            = clientmetric.NewCounter("magicsock_send_derp")
-	metricSendDERPError       = clientmetric.NewCounter("magicsock_send_derp_error")
+	sendDERPQueued      *clientmetric.Metric
+	sendDERPErrorChan   *clientmetric.Metric
+	sendDERPErrorClosed *clientmetric.Metric
+	sendDERPErrorQueue  *clientmetric.Metric
+	sendUDP             *clientmetric.Metric
+	sendUDPError        *clientmetric.Metric
+	sendDERP            *clientmetric.Metric
+	sendDERPError       *clientmetric.Metric
 
 	// Data packets (non-disco)
-	metricSendData            = clientmetric.NewCounter("magicsock_send_data")
-	metricSendDataNetworkDown = clientmetric.NewCounter("magicsock_send_data_network_down")
-	metricRecvDataDERP        = clientmetric.NewCounter("magicsock_recv_data_derp")
-	metricRecvDataIPv4        = clientmetric.NewCounter("magicsock_recv_data_ipv4")
-	metricRecvDataIPv6        = clientmetric.NewCounter("magicsock_recv_data_ipv6")
+	sendData            *clientmetric.Metric
+	sendDataNetworkDown *clientmetric.Metric
+	recvDataDERP        *clientmetric.Metric
+	recvDataIPv4        *clientmetric.Metric
+	recvDataIPv6        *clientmetric.Metric
 
 	// Disco packets
-	metricSendDiscoUDP         = clientmetric.NewCounter("magicsock_disco_send_udp")
-	metricSendDiscoDERP        = clientmetric.NewCounter("magicsock_disco_send_derp")
-	metricSentDiscoUDP         = clientmetric.NewCounter("magicsock_disco_sent_udp")
-	metricSentDiscoDERP        = clientmetric.NewCounter("magicsock_disco_sent_derp")
-	metricSentDiscoPing        = clientmetric.NewCounter("magicsock_disco_sent_ping")
-	metricSentDiscoPong        = clientmetric.NewCounter("magicsock_disco_sent_pong")
-	metricSentDiscoCallMeMaybe = clientmetric.NewCounter("magicsock_disco_sent_callmemaybe")
-	metricRecvDiscoBadPeer     = clientmetric.NewCounter("magicsock_disco_recv_bad_peer")
-	metricRecvDiscoBadKey      = clientmetric.NewCounter("magicsock_disco_recv_bad_key")
-	metricRecvDiscoBadParse    = clientmetric.NewCounter("magicsock_disco_recv_bad_parse")
-
-	metricRecvDiscoUDP                 = clientmetric.NewCounter("magicsock_disco_recv_udp")
-	metricRecvDiscoDERP                = clientmetric.NewCounter("magicsock_disco_recv_derp")
-	metricRecvDiscoPing                = clientmetric.NewCounter("magicsock_disco_recv_ping")
-	metricRecvDiscoPong                = clientmetric.NewCounter("magicsock_disco_recv_pong")
-	metricRecvDiscoCallMeMaybe         = clientmetric.NewCounter("magicsock_disco_recv_callmemaybe")
-	metricRecvDiscoCallMeMaybeBadNode  = clientmetric.NewCounter("magicsock_disco_recv_callmemaybe_bad_node")
-	metricRecvDiscoCallMeMaybeBadDisco = clientmetric.NewCounter("magicsock_disco_recv_callmemaybe_bad_disco")
-
-	// metricDERPHomeChange is how many times our DERP home region DI has
+	sendDiscoUDP         *clientmetric.Metric
+	sendDiscoDERP        *clientmetric.Metric
+	sentDiscoUDP         *clientmetric.Metric
+	sentDiscoDERP        *clientmetric.Metric
+	sentDiscoPing        *clientmetric.Metric
+	sentDiscoPong        *clientmetric.Metric
+	sentDiscoCallMeMaybe *clientmetric.Metric
+	recvDiscoBadPeer     *clientmetric.Metric
+	recvDiscoBadKey      *clientmetric.Metric
+	recvDiscoBadParse    *clientmetric.Metric
+
+	recvDiscoUDP                 *clientmetric.Metric
+	recvDiscoDERP                *clientmetric.Metric
+	recvDiscoPing                *clientmetric.Metric
+	recvDiscoPong                *clientmetric.Metric
+	recvDiscoCallMeMaybe         *clientmetric.Metric
+	recvDiscoCallMeMaybeBadNode  *clientmetric.Metric
+	recvDiscoCallMeMaybeBadDisco *clientmetric.Metric
+
+	// derpHomeChange is how many times our DERP home region DI has
 	// changed from non-zero to a different non-zero.
-	metricDERPHomeChange = clientmetric.NewCounter("derp_home_change")
+	derpHomeChange *clientmetric.Metric
 
 	// Disco packets received bpf read path
-	metricRecvDiscoPacketIPv4 = clientmetric.NewCounter("magicsock_disco_recv_bpf_ipv4")
-	metricRecvDiscoPacketIPv6 = clientmetric.NewCounter("magicsock_disco_recv_bpf_ipv6")
-)
+	recvDiscoPacketIPv4 *clientmetric.Metric
+	recvDiscoPacketIPv6 *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		numPeers:                     r.Gauge("magicsock_netmap_num_peers"),
+		numDERPConns:                 r.Gauge("magicsock_num_derp_conns"),
+		rebindCalls:                  r.Counter("magicsock_rebind_calls"),
+		reSTUNCalls:                  r.Counter("magicsock_restun_calls"),
+		updateEndpoints:              r.Counter("magicsock_update_endpoints"),
+		sendDERPQueued:               r.Counter("magicsock_send_derp_queued"),
+		sendDERPErrorChan:            r.Counter("magicsock_send_derp_error_chan"),
+		sendDERPErrorClosed:          r.Counter("magicsock_send_derp_error_closed"),
+		sendDERPErrorQueue:           r.Counter("magicsock_send_derp_error_queue"),
+		sendUDP:                      r.Counter("magicsock_send_udp"),
+		sendUDPError:                 r.Counter("magicsock_send_udp_error"),
+		sendDERP:                     r.Counter("magicsock_send_derp"),
+		sendDERPError:                r.Counter("magicsock_send_derp_error"),
+		sendData:                     r.Counter("magicsock_send_data"),
+		sendDataNetworkDown:          r.Counter("magicsock_send_data_network_down"),
+		recvDataDERP:                 r.Counter("magicsock_recv_data_derp"),
+		recvDataIPv4:                 r.Counter("magicsock_recv_data_ipv4"),
+		recvDataIPv6:                 r.Counter("magicsock_recv_data_ipv6"),
+		sendDiscoUDP:                 r.Counter("magicsock_disco_send_udp"),
+		sendDiscoDERP:                r.Counter("magicsock_disco_send_derp"),
+		sentDiscoUDP:                 r.Counter("magicsock_disco_sent_udp"),
+		sentDiscoDERP:                r.Counter("magicsock_disco_sent_derp"),
+		sentDiscoPing:                r.Counter("magicsock_disco_sent_ping"),
+		sentDiscoPong:                r.Counter("magicsock_disco_sent_pong"),
+		sentDiscoCallMeMaybe:         r.Counter("magicsock_disco_sent_callmemaybe"),
+		recvDiscoBadPeer:             r.Counter("magicsock_disco_recv_bad_peer"),
+		recvDiscoBadKey:              r.Counter("magicsock_disco_recv_bad_key"),
+		recvDiscoBadParse:            r.Counter("magicsock_disco_recv_bad_parse"),
+		recvDiscoUDP:                 r.Counter("magicsock_disco_recv_udp"),
+		recvDiscoDERP:                r.Counter("magicsock_disco_recv_derp"),
+		recvDiscoPing:                r.Counter("magicsock_disco_recv_ping"),
+		recvDiscoPong:                r.Counter("magicsock_disco_recv_pong"),
+		recvDiscoCallMeMaybe:         r.Counter("magicsock_disco_recv_callmemaybe"),
+		recvDiscoCallMeMaybeBadNode:  r.Counter("magicsock_disco_recv_callmemaybe_bad_node"),
+		recvDiscoCallMeMaybeBadDisco: r.Counter("magicsock_disco_recv_callmemaybe_bad_disco"),
+		derpHomeChange:               r.Counter("derp_home_change"),
+		recvDiscoPacketIPv4:          r.Counter("magicsock_disco_recv_bpf_ipv4"),
+		recvDiscoPacketIPv6:          r.Counter("magicsock_disco_recv_bpf_ipv6"),
+	}
+}
@@ -254,9 +254,9 @@ func (c *Conn) receiveDisco(pc net.PacketConn, isIPV6 bool) {
 		srcPort := binary.BigEndian.Uint16(buf[:2])
 
 		if srcIP.Is4() {
-			metricRecvDiscoPacketIPv4.Add(1)
+			c.metrics.recvDiscoPacketIPv4.Add(1)
 		} else {
-			metricRecvDiscoPacketIPv6.Add(1)
+			c.metrics.recvDiscoPacketIPv6.Add(1)
 		}
 
 		c.handleDiscoMessage(buf[udpHeaderSize:n], netip.AddrPortFrom(srcIP, srcPort), key.NodePublic{})
@@ -441,6 +441,50 @@ func (ns *Impl) DialContextUDP(ctx context.Context, ipp netip.AddrPort) (*gonet.
 	return gonet.DialUDP(ns.ipstack, nil, remoteAddress, ipType)
 }
 
+// ListenPacket listens for incoming UDP packets on the provided local address,
+// which must be a Tailscale IP of this node, bypassing the UDP forwarder.
+//
+// The network must be "udp4" or "udp6" and match the address family of
+// address.
+func (ns *Impl) ListenPacket(network, address string) (net.PacketConn, error) {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("netstack: ParseAddrPort(%q): %v", address, err)
+	}
+
+	var networkProto tcpip.NetworkProtocolNumber
+	switch network {
+	case "udp4":
+		if !ap.Addr().Is4() {
+			return nil, fmt.Errorf("netstack: udp4 requires an IPv4 address, got %v", ap.Addr())
+		}
+		networkProto = ipv4.ProtocolNumber
+	case "udp6":
+		if !ap.Addr().Is6() {
+			return nil, fmt.Errorf("netstack: udp6 requires an IPv6 address, got %v", ap.Addr())
+		}
+		networkProto = ipv6.ProtocolNumber
+	default:
+		return nil, fmt.Errorf("netstack: unsupported network %q", network)
+	}
+
+	var wq waiter.Queue
+	ep, nserr := ns.ipstack.NewEndpoint(udp.ProtocolNumber, networkProto, &wq)
+	if nserr != nil {
+		return nil, fmt.Errorf("netstack: NewEndpoint: %v", nserr)
+	}
+	localAddress := tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.Address(ap.Addr().AsSlice()),
+		Port: ap.Port(),
+	}
+	if nserr := ep.Bind(localAddress); nserr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("netstack: Bind(%v): %v", ap, nserr)
+	}
+	return gonet.NewUDPConn(ns.ipstack, &wq, ep), nil
+}
+
 // The inject goroutine reads in packets that netstack generated, and delivers
 // them to the correct path.
 func (ns *Impl) inject() {
@@ -106,6 +106,9 @@ type userspaceEngine struct {
 	linkMonOwned      bool       // whether we created linkMon (and thus need to close it)
 	linkMonUnregister func()     // unsubscribes from changes; used regardless of linkMonOwned
 	birdClient        BIRDClient // or nil
+	health            *health.Tracker
+	clientMetrics     *clientmetric.Registry
+	metrics           *metrics // from clientMetrics
 
 	testMaybeReconfigHook func() // for tests; if non-nil, fires if maybeReconfigWireguardLocked called
 
@@ -226,6 +229,15 @@ type Config struct {
 	// BIRDClient, if non-nil, will be used to configure BIRD whenever
 	// this node is a primary subnet router.
 	BIRDClient BIRDClient
+
+	// HealthTracker, if non-nil, is where the engine and its magicsock
+	// report their health. If nil, the process-wide health.Global is used.
+	HealthTracker *health.Tracker
+
+	// ClientMetrics, if non-nil, is where the engine and its TUN wrapper,
+	// magicsock and DNS manager record their client metrics. If nil, the
+	// process-wide clientmetric.Global is used.
+	ClientMetrics *clientmetric.Registry
 }
 
 func NewFakeUserspaceEngine(logf logger.Logf, listenPort uint16) (Engine, error) {
@@ -294,6 +306,12 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 	if conf.Dialer == nil {
 		conf.Dialer = &tsdial.Dialer{Logf: logf}
 	}
+	if conf.HealthTracker == nil {
+		conf.HealthTracker = health.Global()
+	}
+	if conf.ClientMetrics == nil {
+		conf.ClientMetrics = clientmetric.Global()
+	}
 
 	var tsTUNDev *tstun.Wrapper
 	if conf.IsTAP {
@@ -301,6 +319,7 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 	} else {
 		tsTUNDev = tstun.Wrap(logf, conf.Tun)
 	}
+	tsTUNDev.SetClientMetrics(conf.ClientMetrics)
 	closePool.add(tsTUNDev)
 
 	e := &userspaceEngine{
@@ -312,6 +331,9 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 		router:         conf.Router,
 		confListenPort: conf.ListenPort,
 		birdClient:     conf.BIRDClient,
+		health:         conf.HealthTracker,
+		clientMetrics:  conf.ClientMetrics,
+		metrics:        newMetrics(conf.ClientMetrics),
 	}
 
 	if e.birdClient != nil {
@@ -338,7 +360,7 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 	tunName, _ := conf.Tun.Name()
 	conf.Dialer.SetTUNName(tunName)
 	conf.Dialer.SetLinkMonitor(e.linkMon)
-	e.dns = dns.NewManager(logf, conf.DNS, e.linkMon, conf.Dialer, fwdDNSLinkSelector{e, tunName})
+	e.dns = dns.NewManager(logf, conf.DNS, e.health, e.clientMetrics, e.linkMon, conf.Dialer, fwdDNSLinkSelector{e, tunName})
 
 	logf("link state: %+v", e.linkMon.InterfaceState())
 
@@ -364,6 +386,8 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 		IdleFunc:         e.tundev.IdleDuration,
 		NoteRecvActivity: e.noteRecvActivity,
 		LinkMonitor:      e.linkMon,
+		HealthTracker:    e.health,
+		ClientMetrics:    e.clientMetrics,
 	}
 
 	var err error
@@ -500,7 +524,7 @@ func (e *userspaceEngine) handleLocalPackets(p *packet.Parsed, t *tstun.Wrapper)
 		if err != nil {
 			e.logf("dns: enqueue: %v", err)
 		}
-		metricMagicDNSPacketIn.Add(1)
+		e.metrics.magicDNSPacketIn.Add(1)
 		return filter.Drop
 	}
 
@@ -515,7 +539,7 @@ func (e *userspaceEngine) handleLocalPackets(p *packet.Parsed, t *tstun.Wrapper)
 			// notice that an outbound packet is actually destined for
 			// ourselves, and loop it back into macOS.
 			t.InjectInboundCopy(p.Buffer())
-			metricReflectToOS.Add(1)
+			e.metrics.reflectToOS.Add(1)
 			return filter.Drop
 		}
 	}
@@ -966,7 +990,7 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 		e.logf("wgengine: Reconfig: configuring router")
 		e.networkLogger.ReconfigRoutes(routerCfg)
 		err := e.router.Set(routerCfg)
-		health.SetRouterHealth(err)
+		e.health.SetRouterHealth(err)
 		if err != nil {
 			return err
 		}
@@ -975,7 +999,7 @@ func (e *userspaceEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config,
 		// assigned address.
 		e.logf("wgengine: Reconfig: configuring DNS")
 		err = e.dns.Set(*dnsCfg)
-		health.SetDNSHealth(err)
+		e.health.SetDNSHealth(err)
 		if err != nil {
 			return err
 		}
@@ -1162,6 +1186,14 @@ func (e *userspaceEngine) GetLinkMonitor() *monitor.Mon {
 	return e.linkMon
 }
 
+func (e *userspaceEngine) GetHealthTracker() *health.Tracker {
+	return e.health
+}
+
+func (e *userspaceEngine) GetClientMetrics() *clientmetric.Registry {
+	return e.clientMetrics
+}
+
 // LinkChange signals a network change event. It's currently
 // (2021-03-03) only called on Android. On other platforms, linkMon
 // generates link change events for us.
@@ -1179,7 +1211,7 @@ func (e *userspaceEngine) linkChange(changed bool, cur *interfaces.State) {
 		e.logf("[v1] LinkChange: minor")
 	}
 
-	health.SetAnyInterfaceUp(up)
+	e.health.SetAnyInterfaceUp(up)
 	e.magicConn.SetNetworkUp(up)
 	if !up || changed {
 		if err := e.dns.FlushCaches(); err != nil {
@@ -1210,10 +1242,10 @@ func (e *userspaceEngine) linkChange(changed bool, cur *interfaces.State) {
 	why := "link-change-minor"
 	if changed {
 		why = "link-change-major"
-		metricNumMajorChanges.Add(1)
+		e.metrics.numMajorChanges.Add(1)
 		e.magicConn.Rebind()
 	} else {
-		metricNumMinorChanges.Add(1)
+		e.metrics.numMinorChanges.Add(1)
 	}
 	e.magicConn.ReSTUN(why)
 }
@@ -1617,10 +1649,20 @@ func (ls fwdDNSLinkSelector) PickLink(ip netip.Addr) (linkName string) {
 	return ""
 }
 
-var (
-	metricMagicDNSPacketIn = clientmetric.NewCounter("magicdns_packet_in") // for 100.100.100.100
-	metricReflectToOS      = clientmetric.NewCounter("packet_reflect_to_os")
+// metrics are a userspaceEngine's client metrics.
+type metrics struct {
+	magicDNSPacketIn *clientmetric.Metric // for 100.100.100.100
+	reflectToOS      *clientmetric.Metric
 
-	metricNumMajorChanges = clientmetric.NewCounter("wgengine_major_changes")
-	metricNumMinorChanges = clientmetric.NewCounter("wgengine_minor_changes")
-)
+	numMajorChanges *clientmetric.Metric
+	numMinorChanges *clientmetric.Metric
+}
+
+func newMetrics(r *clientmetric.Registry) *metrics {
+	return &metrics{
+		magicDNSPacketIn: r.Counter("magicdns_packet_in"),
+		reflectToOS:      r.Counter("packet_reflect_to_os"),
+		numMajorChanges:  r.Counter("wgengine_major_changes"),
+		numMinorChanges:  r.Counter("wgengine_minor_changes"),
+	}
+}
@@ -16,6 +16,7 @@
 	"time"
 
 	"tailscale.com/envknob"
+	"tailscale.com/health"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/dns"
 	"tailscale.com/net/dns/resolver"
@@ -23,6 +24,7 @@
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
 	"tailscale.com/types/netmap"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/wgengine/filter"
 	"tailscale.com/wgengine/magicsock"
 	"tailscale.com/wgengine/monitor"
@@ -129,6 +131,12 @@ func (e *watchdogEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config, d
 func (e *watchdogEngine) GetLinkMonitor() *monitor.Mon {
 	return e.wrap.GetLinkMonitor()
 }
+func (e *watchdogEngine) GetHealthTracker() *health.Tracker {
+	return e.wrap.GetHealthTracker()
+}
+func (e *watchdogEngine) GetClientMetrics() *clientmetric.Registry {
+	return e.wrap.GetClientMetrics()
+}
 func (e *watchdogEngine) GetFilter() *filter.Filter {
 	return e.wrap.GetFilter()
 }
@@ -9,11 +9,13 @@
 	"net/netip"
 	"time"
 
+	"tailscale.com/health"
 	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/net/dns"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
 	"tailscale.com/types/netmap"
+	"tailscale.com/util/clientmetric"
 	"tailscale.com/wgengine/filter"
 	"tailscale.com/wgengine/monitor"
 	"tailscale.com/wgengine/router"
@@ -95,6 +97,14 @@ type Engine interface {
 	// GetLinkMonitor returns the link monitor.
 	GetLinkMonitor() *monitor.Mon
 
+	// GetHealthTracker returns the health tracker the engine
+	// reports to.
+	GetHealthTracker() *health.Tracker
+
+	// GetClientMetrics returns the registry the engine records its
+	// client metrics in.
+	GetClientMetrics() *clientmetric.Registry
+
 	// RequestStatus requests a WireGuard status update right
 	// away, sent to the callback registered via SetStatusCallback.
 	RequestStatus()